@@ -172,7 +172,7 @@ display_summary() {
     echo "   • Password: ${ZITADEL_ADMIN_PASS}"
     echo
     echo "🔧 TACACS+ Configuration:"
-    echo "   • Shared Secret: $(grep TACACS_SECRET .env | cut -d'=' -f2 2>/dev/null || echo 'testing123')"
+    echo "   • Shared Secret: $(grep TACACS_SECRET .env | cut -d'=' -f2 2>/dev/null || echo 'not set')"
     echo "   • Listen Address: $(grep TACACS_LISTEN_ADDRESS .env | cut -d'=' -f2 2>/dev/null || echo '0.0.0.0:49')"
     echo
     echo "⚙️  Management Commands:"
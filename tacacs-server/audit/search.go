@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageSize is used when a query does not set a limit
+	DefaultPageSize = 100
+	// MaxPageSize caps the rows returned by a single query
+	MaxPageSize = 1000
+	// MaxPatternLength caps the length of substring and regex filters
+	MaxPatternLength = 256
+	// maxRepeat is the largest {m,n} count PostgreSQL regular expressions accept
+	maxRepeat = 255
+)
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidQuery is returned when query filters are rejected
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// CommandQuery filters recorded commands; zero values match everything.
+// Regex is run by Go's RE2 in the memory and SQLite stores and by
+// PostgreSQL's ~ operator, so only the syntax both read alike is accepted:
+// literals, escaped punctuation, ., [...] classes including [:alpha:],
+// groups, |, ^, $ and greedy *, +, ? and {m,n} up to 255.
+type CommandQuery struct {
+	Username      string
+	NAS           string
+	From          time.Time
+	To            time.Time
+	Contains      string
+	Regex         string
+	Allowed       *bool
+	SessionStatus string
+	Cursor        string
+	Limit         int
+}
+
+// SessionQuery filters recorded sessions; zero values match everything
+type SessionQuery struct {
+	Username string
+	NAS      string
+	From     time.Time
+	To       time.Time
+	Status   string
+	AuthMode string
+	Provider string
+	Cursor   string
+	Limit    int
+}
+
+// CommandRecord is a command joined with its session
+type CommandRecord struct {
+	ID            int64     `json:"id"`
+	SessionID     string    `json:"session_id"`
+	Username      string    `json:"username"`
+	NAS           string    `json:"nas"`
+	Command       string    `json:"command"`
+	Timestamp     time.Time `json:"timestamp"`
+	Allowed       bool      `json:"allowed"`
+	SessionStatus string    `json:"session_status"`
+}
+
+// SessionRecord is a stored session
+type SessionRecord struct {
+	ID        string     `json:"id"`
+	Username  string     `json:"username"`
+	NAS       string     `json:"nas"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Status    string     `json:"status"`
+	AuthMode  string     `json:"auth_mode"`
+	Provider  string     `json:"provider"`
+}
+
+// Searcher streams audit records matching a query, newest first. It calls fn
+// for at most Limit rows and returns the cursor of the next page, or "" when
+// there are no more rows.
+type Searcher interface {
+	SearchCommands(ctx context.Context, q CommandQuery, fn func(CommandRecord) error) (string, error)
+	SearchSessions(ctx context.Context, q SessionQuery, fn func(SessionRecord) error) (string, error)
+}
+
+// Validate normalises the limit and rejects unsafe filters
+func (q *CommandQuery) Validate() error {
+	q.Limit = clampLimit(q.Limit)
+	if len(q.Contains) > MaxPatternLength || len(q.Regex) > MaxPatternLength {
+		return fmt.Errorf("%w: command filter is too long", ErrInvalidQuery)
+	}
+	if q.Regex != "" {
+		if _, err := regexp.Compile(q.Regex); err != nil {
+			return fmt.Errorf("%w: invalid command regex", ErrInvalidQuery)
+		}
+		if err := checkPortableRegex(q.Regex); err != nil {
+			return fmt.Errorf("%w: unsupported command regex: %v", ErrInvalidQuery, err)
+		}
+	}
+	return validateRange(q.From, q.To)
+}
+
+// checkPortableRegex rejects the syntax of a compiled pattern that RE2 and
+// PostgreSQL advanced regular expressions read differently or only one of
+// them accepts: escapes of letters and digits such as \d, \b or \1, (?...)
+// flags and groups, non-greedy quantifiers and counts above maxRepeat
+func checkPortableRegex(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+			if i < len(pattern) && isAlnum(pattern[i]) {
+				return fmt.Errorf("escape \\%c is not supported, use a bracket expression", pattern[i])
+			}
+		case c == '[':
+			end, err := skipClass(pattern, i)
+			if err != nil {
+				return err
+			}
+			i = end
+		case c == '(' && i+1 < len(pattern) && pattern[i+1] == '?':
+			return fmt.Errorf("(? groups and flags are not supported")
+		}
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	return walkRegex(re)
+}
+
+// skipClass returns the index of the ] closing the bracket expression at start
+func skipClass(pattern string, start int) (int, error) {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return i, nil
+		case pattern[i] == '\\':
+			i++
+			if i < len(pattern) && isAlnum(pattern[i]) {
+				return 0, fmt.Errorf("escape \\%c is not supported, use a bracket expression", pattern[i])
+			}
+		case pattern[i] == '[' && i+1 < len(pattern) && pattern[i+1] == ':':
+			end := strings.Index(pattern[i:], ":]")
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated character class")
+			}
+			i += end + 1
+		}
+	}
+	return 0, fmt.Errorf("unterminated bracket expression")
+}
+
+func walkRegex(re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if re.Flags&syntax.NonGreedy != 0 {
+			return fmt.Errorf("non-greedy quantifiers are not supported")
+		}
+		if re.Op == syntax.OpRepeat && (re.Min > maxRepeat || re.Max > maxRepeat) {
+			return fmt.Errorf("repeat counts above %d are not supported", maxRepeat)
+		}
+	}
+	for _, sub := range re.Sub {
+		if err := walkRegex(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Validate normalises the limit and rejects invalid ranges
+func (q *SessionQuery) Validate() error {
+	q.Limit = clampLimit(q.Limit)
+	return validateRange(q.From, q.To)
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+func validateRange(from, to time.Time) error {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("%w: time range end is before start", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// Cursor marks the last row of a page in (time, id) order
+type Cursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// EncodeCursor returns the opaque form of c handed to clients
+func EncodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses an opaque cursor; an empty string yields nil
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
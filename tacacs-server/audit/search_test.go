@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandQueryValidateRegex(t *testing.T) {
+	tests := []struct {
+		regex string
+		ok    bool
+	}{
+		{"^conf", true},
+		{"^(show|ping) ", true},
+		{`interface [A-Za-z]+[0-9/]+\.[0-9]+$`, true},
+		{"[[:digit:]]{1,3}", true},
+		{`[^\]]+`, true},
+		{"a{255}", true},
+		{"[", false},
+		{`\d+`, false},
+		{`\bshow`, false},
+		{`[\w]`, false},
+		{`(a)\1`, false},
+		{"(?i)show", false},
+		{"(?:show|ping)", false},
+		{"show.*?run", false},
+		{"a+?", false},
+		{"a{256}", false},
+		{"a{1,1000}", false},
+		{"[[:alpha:]", false},
+		{strings.Repeat("a", MaxPatternLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.regex, func(t *testing.T) {
+			q := CommandQuery{Regex: tt.regex}
+			err := q.Validate()
+			if tt.ok && err != nil {
+				t.Fatalf("Validate rejected %q: %v", tt.regex, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("Validate(%q) = %v, want ErrInvalidQuery", tt.regex, err)
+			}
+		})
+	}
+}
+
+func TestQueryValidateLimitAndRange(t *testing.T) {
+	q := SessionQuery{}
+	if err := q.Validate(); err != nil || q.Limit != DefaultPageSize {
+		t.Fatalf("Validate = %v with limit %d, want nil and %d", err, q.Limit, DefaultPageSize)
+	}
+	q = SessionQuery{Limit: MaxPageSize + 1}
+	if err := q.Validate(); err != nil || q.Limit != MaxPageSize {
+		t.Fatalf("Validate = %v with limit %d, want nil and %d", err, q.Limit, MaxPageSize)
+	}
+
+	now := time.Now()
+	q = SessionQuery{From: now, To: now.Add(-time.Hour)}
+	if err := q.Validate(); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Validate with an inverted range = %v, want ErrInvalidQuery", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/store"
+)
+
+const auditUsage = `Usage: tacacs-server audit export [commands|sessions] [flags]
+
+  export  write every matching record from the database as JSON lines or CSV
+`
+
+// runAudit implements the audit subcommand and returns the process exit code
+func runAudit(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprint(os.Stderr, auditUsage)
+		return 2
+	}
+	args = args[1:]
+	kind := "commands"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		kind, args = args[0], args[1:]
+	}
+	if kind != "commands" && kind != "sessions" {
+		fmt.Fprint(os.Stderr, auditUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("audit export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, auditUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	format := fs.String("format", "jsonl", "output format: jsonl or csv")
+	output := fs.String("o", "-", "output file, - for standard output")
+	user := fs.String("user", "", "only records of this user")
+	nas := fs.String("nas", "", "only records from this NAS")
+	from := fs.String("from", "", "only records at or after this RFC 3339 time")
+	to := fs.String("to", "", "only records before this RFC 3339 time")
+	status := fs.String("status", "", "only sessions with this status")
+	authMode := fs.String("auth-mode", "", "only sessions authenticated this way: online, offline or break_glass")
+	provider := fs.String("provider", "", "only sessions accepted by this authentication provider")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "jsonl" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "audit: unknown format %q\n", *format)
+		return 2
+	}
+
+	var fromTime, toTime time.Time
+	for _, t := range []struct {
+		value  string
+		target *time.Time
+	}{{*from, &fromTime}, {*to, &toTime}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "audit: invalid time %q: expected RFC 3339\n", t.value)
+			return 2
+		}
+		*t.target = parsed
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	if cfg.StoreBackend == store.BackendMemory {
+		fmt.Fprintln(os.Stderr, "audit: the memory backend keeps no records outside the running server")
+		return 1
+	}
+	// Exports never change the schema; an outdated database is reported instead
+	cfg.DBAutoMigrate = false
+
+	ctx := context.Background()
+	st, err := store.Open(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	defer st.Close()
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	var n int
+	if kind == "commands" {
+		n, err = exportCommands(ctx, st, audit.CommandQuery{Username: *user, NAS: *nas, From: fromTime, To: toTime, SessionStatus: *status}, *format, buffered)
+	} else {
+		n, err = exportSessions(ctx, st, audit.SessionQuery{Username: *user, NAS: *nas, From: fromTime, To: toTime, Status: *status, AuthMode: *authMode, Provider: *provider}, *format, buffered)
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d %s\n", n, kind)
+	return 0
+}
+
+// recordWriter encodes records as JSON lines or CSV rows
+type recordWriter struct {
+	json *json.Encoder
+	csv  *csv.Writer
+}
+
+func newRecordWriter(format string, w io.Writer, header []string) (*recordWriter, error) {
+	if format == "jsonl" {
+		return &recordWriter{json: json.NewEncoder(w)}, nil
+	}
+	rw := &recordWriter{csv: csv.NewWriter(w)}
+	return rw, rw.csv.Write(header)
+}
+
+func (rw *recordWriter) write(record interface{}, row []string) error {
+	if rw.json != nil {
+		return rw.json.Encode(record)
+	}
+	return rw.csv.Write(row)
+}
+
+func (rw *recordWriter) flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+func exportCommands(ctx context.Context, searcher audit.Searcher, q audit.CommandQuery, format string, w io.Writer) (int, error) {
+	rw, err := newRecordWriter(format, w, []string{"id", "session_id", "username", "nas", "command", "timestamp", "allowed", "session_status"})
+	if err != nil {
+		return 0, err
+	}
+	q.Limit = audit.MaxPageSize
+	n := 0
+	for {
+		q.Cursor, err = searcher.SearchCommands(ctx, q, func(rec audit.CommandRecord) error {
+			n++
+			return rw.write(rec, []string{
+				strconv.FormatInt(rec.ID, 10),
+				rec.SessionID,
+				rec.Username,
+				rec.NAS,
+				rec.Command,
+				rec.Timestamp.Format(time.RFC3339),
+				strconv.FormatBool(rec.Allowed),
+				rec.SessionStatus,
+			})
+		})
+		if err != nil {
+			return n, err
+		}
+		if q.Cursor == "" {
+			return n, rw.flush()
+		}
+	}
+}
+
+func exportSessions(ctx context.Context, searcher audit.Searcher, q audit.SessionQuery, format string, w io.Writer) (int, error) {
+	rw, err := newRecordWriter(format, w, []string{"id", "username", "nas", "start_time", "end_time", "status", "auth_mode", "provider"})
+	if err != nil {
+		return 0, err
+	}
+	q.Limit = audit.MaxPageSize
+	n := 0
+	for {
+		q.Cursor, err = searcher.SearchSessions(ctx, q, func(rec audit.SessionRecord) error {
+			n++
+			endTime := ""
+			if rec.EndTime != nil {
+				endTime = rec.EndTime.Format(time.RFC3339)
+			}
+			return rw.write(rec, []string{rec.ID, rec.Username, rec.NAS, rec.StartTime.Format(time.RFC3339), endTime, rec.Status, rec.AuthMode, rec.Provider})
+		})
+		if err != nil {
+			return n, err
+		}
+		if q.Cursor == "" {
+			return n, rw.flush()
+		}
+	}
+}
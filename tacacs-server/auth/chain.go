@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"tacacs-zitadel-server/metrics"
+)
+
+// ErrNoProvider is returned when no provider of a chain matches a login
+var ErrNoProvider = errors.New("no authentication provider matches the login")
+
+type nasGroupKey struct{}
+
+// WithNASGroup returns a context carrying the client group of the NAS a
+// login comes from, which chain rules can match on
+func WithNASGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, nasGroupKey{}, group)
+}
+
+// NASGroup returns the NAS client group set by WithNASGroup, or ""
+func NASGroup(ctx context.Context) string {
+	group, _ := ctx.Value(nasGroupKey{}).(string)
+	return group
+}
+
+// Rule selects the logins a provider of a chain is asked about. Every
+// non-empty list must match, and within a list any entry may. Suffixes and
+// realms, the part of the username after its last @, ignore case.
+type Rule struct {
+	Suffixes  []string
+	Realms    []string
+	NASGroups []string
+	// StripRealm passes the username to the provider without its @realm
+	StripRealm bool
+}
+
+func (r Rule) matches(username, nasGroup string) bool {
+	lower := strings.ToLower(username)
+	if len(r.Suffixes) > 0 && !anyOf(r.Suffixes, func(s string) bool { return strings.HasSuffix(lower, strings.ToLower(s)) }) {
+		return false
+	}
+	if len(r.Realms) > 0 {
+		_, realm := splitRealm(username)
+		if !anyOf(r.Realms, func(s string) bool { return realm != "" && strings.EqualFold(realm, s) }) {
+			return false
+		}
+	}
+	if len(r.NASGroups) > 0 && !anyOf(r.NASGroups, func(s string) bool { return s == nasGroup }) {
+		return false
+	}
+	return true
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRealm splits user@realm at the last @
+func splitRealm(username string) (string, string) {
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		return username[:i], username[i+1:]
+	}
+	return username, ""
+}
+
+// Link is one provider of a chain
+type Link struct {
+	Name     string
+	Provider AuthProvider
+	Rule     Rule
+}
+
+// Chain tries providers in order. Providers whose rule does not match a
+// login are skipped and an unavailable provider passes the login on to the
+// next one; any other answer, accept or reject, is final. The name of the
+// provider that accepted a login is set in UserInfo.Provider.
+type Chain struct {
+	links []Link
+}
+
+func NewChain(links ...Link) *Chain {
+	return &Chain{links: links}
+}
+
+// ProviderError is the error of one provider of a chain
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Provider + ": " + e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// ProviderErr returns the error the provider named name gave for a login
+// answered by a chain, or nil if it was not asked or did not fail
+func ProviderErr(err error, name string) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *ProviderError:
+		if e.Provider == name {
+			return e.Err
+		}
+		return nil
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if found := ProviderErr(inner, name); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return ProviderErr(errors.Unwrap(err), name)
+}
+
+// AuthenticateUser implements AuthProvider. Errors are ProviderErrors; when
+// every matching provider is unavailable the error joins all of theirs, so
+// ErrUnavailable and the providers' own errors can still be tested with
+// errors.Is and found with ProviderErr.
+func (c *Chain) AuthenticateUser(ctx context.Context, username, password string) (*UserInfo, error) {
+	nasGroup := NASGroup(ctx)
+	var unavailable []error
+	for _, link := range c.links {
+		if !link.Rule.matches(username, nasGroup) {
+			continue
+		}
+		name := username
+		if link.Rule.StripRealm {
+			name, _ = splitRealm(username)
+		}
+
+		info, err := link.Provider.AuthenticateUser(ctx, name, password)
+		switch {
+		case err == nil:
+			metrics.ProviderAuthentications.WithLabelValues(link.Name, "pass").Inc()
+			info.Provider = link.Name
+			return info, nil
+		case errors.Is(err, ErrUnavailable):
+			metrics.ProviderAuthentications.WithLabelValues(link.Name, "unavailable").Inc()
+			unavailable = append(unavailable, &ProviderError{Provider: link.Name, Err: err})
+		default:
+			metrics.ProviderAuthentications.WithLabelValues(link.Name, "fail").Inc()
+			return nil, &ProviderError{Provider: link.Name, Err: err}
+		}
+	}
+	if len(unavailable) > 0 {
+		return nil, errors.Join(unavailable...)
+	}
+	return nil, ErrNoProvider
+}
+
+// CleanupCache implements AuthProvider for every provider of the chain
+func (c *Chain) CleanupCache() {
+	for _, link := range c.links {
+		link.Provider.CleanupCache()
+	}
+}
+
+// Provider returns the first provider named name, or nil
+func (c *Chain) Provider(name string) AuthProvider {
+	for _, link := range c.links {
+		if link.Name == name {
+			return link.Provider
+		}
+	}
+	return nil
+}
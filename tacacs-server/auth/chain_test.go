@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errRejected = errors.New("invalid credentials")
+
+type stubProvider struct {
+	err error
+}
+
+func (p stubProvider) AuthenticateUser(_ context.Context, username, _ string) (*UserInfo, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &UserInfo{Username: username}, nil
+}
+
+func (p stubProvider) CleanupCache() {}
+
+func unavailable(reason string) error {
+	return fmt.Errorf("%w: %s", ErrUnavailable, reason)
+}
+
+func TestChainProviderErr(t *testing.T) {
+	tests := []struct {
+		name         string
+		links        []Link
+		provider     string
+		wantProvider string
+		wantErr      error
+		zitadelErr   error
+		oidcErr      error
+	}{
+		{
+			name:         "first accepts",
+			links:        []Link{{Name: "zitadel", Provider: stubProvider{}}, {Name: "oidc", Provider: stubProvider{}}},
+			wantProvider: "zitadel",
+		},
+		{
+			name:         "unavailable passes on",
+			links:        []Link{{Name: "zitadel", Provider: stubProvider{err: unavailable("timeout")}}, {Name: "oidc", Provider: stubProvider{}}},
+			wantProvider: "oidc",
+		},
+		{
+			name:       "rejection is final",
+			links:      []Link{{Name: "zitadel", Provider: stubProvider{err: errRejected}}, {Name: "oidc", Provider: stubProvider{}}},
+			wantErr:    errRejected,
+			zitadelErr: errRejected,
+		},
+		{
+			name:       "only the other provider is down",
+			links:      []Link{{Name: "oidc", Provider: stubProvider{err: unavailable("oidc down")}}, {Name: "zitadel", Provider: stubProvider{err: errRejected}}},
+			wantErr:    errRejected,
+			zitadelErr: errRejected,
+		},
+		{
+			name:    "zitadel not asked",
+			links:   []Link{{Name: "oidc", Provider: stubProvider{err: unavailable("oidc down")}}, {Name: "zitadel", Provider: stubProvider{}, Rule: Rule{Suffixes: []string{"@corp"}}}},
+			wantErr: ErrUnavailable,
+			oidcErr: ErrUnavailable,
+		},
+		{
+			name:       "all down",
+			links:      []Link{{Name: "zitadel", Provider: stubProvider{err: unavailable("timeout")}}, {Name: "oidc", Provider: stubProvider{err: unavailable("oidc down")}}},
+			wantErr:    ErrUnavailable,
+			zitadelErr: ErrUnavailable,
+			oidcErr:    ErrUnavailable,
+		},
+		{
+			name:    "no match",
+			links:   []Link{{Name: "zitadel", Provider: stubProvider{}, Rule: Rule{Realms: []string{"corp"}}}},
+			wantErr: ErrNoProvider,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := NewChain(tt.links...).AuthenticateUser(context.Background(), "alice", "password")
+			if tt.wantErr == nil {
+				if err != nil || info.Provider != tt.wantProvider {
+					t.Fatalf("AuthenticateUser = %+v, %v, want provider %s", info, err, tt.wantProvider)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AuthenticateUser = %v, want %v", err, tt.wantErr)
+			}
+			for name, want := range map[string]error{"zitadel": tt.zitadelErr, "oidc": tt.oidcErr} {
+				got := ProviderErr(err, name)
+				if (want == nil) != (got == nil) || (want != nil && !errors.Is(got, want)) {
+					t.Errorf("ProviderErr(%s) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderErrThroughWrapping(t *testing.T) {
+	inner := &ProviderError{Provider: "zitadel", Err: unavailable("circuit open")}
+	err := fmt.Errorf("login: %w", errors.Join(&ProviderError{Provider: "oidc", Err: errRejected}, inner))
+	if got := ProviderErr(err, "zitadel"); got != inner.Err {
+		t.Errorf("ProviderErr = %v, want %v", got, inner.Err)
+	}
+	if got := ProviderErr(nil, "zitadel"); got != nil {
+		t.Errorf("ProviderErr(nil) = %v", got)
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimPath locates a claim nested in objects, such as realm_access.roles.
+// It is written as dotted keys with an optional leading $, and keys that
+// contain dots are quoted in brackets: resource_access['tacacs'].roles or
+// ["urn:zitadel:iam:org:project:roles"].
+type ClaimPath []string
+
+// ParseClaimPath parses the JSONPath-like syntax described on ClaimPath
+func ParseClaimPath(expr string) (ClaimPath, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return nil, fmt.Errorf("empty claim path")
+	}
+
+	var path ClaimPath
+	for s != "" {
+		var key string
+		if s[0] == '[' {
+			end := strings.IndexByte(s, ']')
+			if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+				quote := strings.IndexByte(s[2:], s[1])
+				if quote < 0 {
+					return nil, fmt.Errorf("unterminated quote in claim path %q", expr)
+				}
+				end = quote + 3
+				if end >= len(s) || s[end] != ']' {
+					return nil, fmt.Errorf("missing ] after quoted key in claim path %q", expr)
+				}
+				key = s[2 : end-1]
+			} else if end > 0 {
+				key = s[1:end]
+			} else {
+				return nil, fmt.Errorf("missing ] in claim path %q", expr)
+			}
+			s = s[end+1:]
+		} else {
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			key, s = s[:end], s[end:]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty key in claim path %q", expr)
+		}
+		path = append(path, key)
+
+		if strings.HasPrefix(s, ".") {
+			s = s[1:]
+			if s == "" {
+				return nil, fmt.Errorf("trailing dot in claim path %q", expr)
+			}
+		} else if s != "" && s[0] != '[' {
+			return nil, fmt.Errorf("unexpected %q in claim path %q", s[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// Strings returns the values of the claim at the path with RolesFromClaims,
+// and whether the claim is present at all
+func (p ClaimPath) Strings(claims map[string]interface{}) ([]string, bool) {
+	if len(p) == 0 {
+		return nil, false
+	}
+	for _, key := range p[:len(p)-1] {
+		nested, ok := claims[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		claims = nested
+	}
+	last := p[len(p)-1]
+	if _, ok := claims[last]; !ok {
+		return nil, false
+	}
+	return RolesFromClaims(claims, []string{last}), true
+}
@@ -1,18 +1,19 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnavailable marks authentication errors caused by the provider being
+// unreachable or unhealthy rather than by the credentials
+var ErrUnavailable = errors.New("authentication provider unavailable")
 
 // AuthProvider defines the interface for authentication providers
 type AuthProvider interface {
 	// AuthenticateUser authenticates a user with username and password
 	AuthenticateUser(ctx context.Context, username, password string) (*UserInfo, error)
 	
-	// GetPrivilegeLevel returns the privilege level for the given roles
-	GetPrivilegeLevel(roles []string) int
-	
-	// IsAuthorized checks if the user with given roles is authorized to execute the command
-	IsAuthorized(roles []string, command string) bool
-	
 	// CleanupCache cleans up expired tokens from cache
 	CleanupCache()
 }
@@ -22,4 +23,6 @@ type UserInfo struct {
 	Username string
 	Roles    []string
 	Groups   []string
+	// Provider names the provider that authenticated the user
+	Provider string
 }
\ No newline at end of file
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksCacheTTL is how long fetched keys are trusted before a refresh
+	jwksCacheTTL = time.Hour
+	// jwksMinRefresh rate-limits refreshes triggered by unknown key IDs
+	jwksMinRefresh = time.Minute
+)
+
+// ErrUnknownKey is returned for a key ID the JWKS does not publish, as
+// opposed to a failure to fetch the set
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWKS fetches and caches the public signing keys published at a JWKS URL
+type JWKS struct {
+	url        string
+	httpClient *http.Client
+	keys       map[string]interface{}
+	fetchedAt  time.Time
+	mutex      sync.Mutex
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewJWKS(url string, httpClient *http.Client) *JWKS {
+	return &JWKS{
+		url:        url,
+		httpClient: httpClient,
+		keys:       make(map[string]interface{}),
+	}
+}
+
+// Key returns the public key with the given key ID, refreshing the set if needed
+func (k *JWKS) Key(ctx context.Context, kid string) (interface{}, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, exists := k.keys[kid]
+	age := time.Since(k.fetchedAt)
+	if exists && age < jwksCacheTTL {
+		return key, nil
+	}
+
+	if !exists && !k.fetchedAt.IsZero() && age < jwksMinRefresh {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		if exists {
+			// Keep serving the stale key rather than failing closed on a fetch blip
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, exists = k.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+func (k *JWKS) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", k.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS request failed with status: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys we cannot use instead of rejecting the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key material: %w", err)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key material: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
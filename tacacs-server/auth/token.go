@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningMethods are the JWT algorithms accepted from identity providers
+var SigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// TokenClaims holds the identity extracted from a validated bearer token
+type TokenClaims struct {
+	Subject  string
+	Username string
+	Roles    []string
+}
+
+// HasRole reports whether the token grants role
+func (c *TokenClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenValidator verifies JWT signature, issuer, audience and expiry
+type TokenValidator struct {
+	keys       *JWKS
+	parser     *jwt.Parser
+	audience   string
+	roleClaims []string
+}
+
+// NewTokenValidator creates a validator for tokens signed by keys. The
+// issuer is only checked when non-empty, while the audience is always
+// checked: with an empty audience every token is rejected. Roles are read
+// from each of roleClaims, which may hold either a string array or an
+// object keyed by role.
+func NewTokenValidator(keys *JWKS, issuer, audience string, roleClaims []string) *TokenValidator {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(SigningMethods), jwt.WithAudience(audience)}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+
+	return &TokenValidator{
+		keys:       keys,
+		parser:     jwt.NewParser(opts...),
+		audience:   audience,
+		roleClaims: roleClaims,
+	}
+}
+
+// Validate parses and verifies a raw JWT and returns its claims
+func (v *TokenValidator) Validate(ctx context.Context, raw string) (*TokenClaims, error) {
+	if v.audience == "" {
+		return nil, errors.New("invalid token: no audience configured")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("invalid token: missing expiry")
+	}
+
+	subject, _ := claims.GetSubject()
+	username, _ := claims["preferred_username"].(string)
+
+	return &TokenClaims{
+		Subject:  subject,
+		Username: username,
+		Roles:    RolesFromClaims(claims, v.roleClaims),
+	}, nil
+}
+
+// RolesFromClaims collects role names from the named claims, accepting
+// string arrays and Zitadel-style objects keyed by role name
+func RolesFromClaims(claims map[string]interface{}, names []string) []string {
+	var roles []string
+	for _, name := range names {
+		switch value := claims[name].(type) {
+		case map[string]interface{}:
+			for role := range value {
+				roles = append(roles, role)
+			}
+		case []interface{}:
+			for _, role := range value {
+				if roleStr, ok := role.(string); ok {
+					roles = append(roles, roleStr)
+				}
+			}
+		case string:
+			roles = append(roles, value)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://zitadel.test"
+	testAudience = "project-1"
+)
+
+// testKey is a locally generated signing key and its key ID
+type testKey struct {
+	kid    string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodRS256, signer: key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodES256, signer: key}
+}
+
+func (k testKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	raw, err := token.SignedString(k.signer)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return raw
+}
+
+func (k testKey) jwk() map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig",
+			"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256",
+			"x": b64(pub.X.Bytes()), "y": b64(pub.Y.Bytes())}
+	}
+	panic("unsupported test key")
+}
+
+// jwksServer is a stub JWKS endpoint whose key set can change during a test
+type jwksServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	keys    []testKey
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...testKey) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		set := struct {
+			Keys []map[string]string `json:"keys"`
+		}{}
+		for _, k := range s.keys {
+			set.Keys = append(set.Keys, k.jwk())
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...testKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = keys
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                testIssuer,
+		"aud":                []string{testAudience},
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"urn:zitadel:iam:org:project:roles": map[string]interface{}{
+			"tacacs-admin": map[string]interface{}{"org": "acme"},
+		},
+		"roles": []string{"tacacs-auditor"},
+	}
+}
+
+func newTestValidator(server *jwksServer, audience string) *TokenValidator {
+	return NewTokenValidator(NewJWKS(server.URL, server.Client()), testIssuer, audience,
+		[]string{"urn:zitadel:iam:org:project:roles", "roles"})
+}
+
+func TestTokenValidatorValidate(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1")
+	otherKey := newRSAKey(t, "rsa-1")
+	server := newJWKSServer(t, rsaKey, ecKey)
+
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		key     testKey
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{"valid RSA token", rsaKey, validClaims(), false},
+		{"valid EC token", ecKey, validClaims(), false},
+		{"audience as a string", rsaKey, with("aud", testAudience), false},
+		{"wrong issuer", rsaKey, with("iss", "https://evil.test"), true},
+		{"wrong audience", rsaKey, with("aud", []string{"other-project"}), true},
+		{"missing audience", rsaKey, with("aud", nil), true},
+		{"expired", rsaKey, with("exp", time.Now().Add(-time.Minute).Unix()), true},
+		{"missing expiry", rsaKey, with("exp", nil), true},
+		{"signed by another key with the same kid", otherKey, validClaims(), true},
+	}
+
+	validator := newTestValidator(server, testAudience)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := validator.Validate(context.Background(), tt.key.sign(t, tt.claims))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Validate accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			sort.Strings(claims.Roles)
+			if claims.Subject != "user-1" || claims.Username != "alice" {
+				t.Errorf("identity = %q/%q, want user-1/alice", claims.Subject, claims.Username)
+			}
+			if len(claims.Roles) != 2 || claims.Roles[0] != "tacacs-admin" || claims.Roles[1] != "tacacs-auditor" {
+				t.Errorf("roles = %v, want [tacacs-admin tacacs-auditor]", claims.Roles)
+			}
+		})
+	}
+}
+
+func TestTokenValidatorRejectsEmptyAudience(t *testing.T) {
+	key := newRSAKey(t, "rsa-1")
+	server := newJWKSServer(t, key)
+	validator := newTestValidator(server, "")
+
+	for _, aud := range []interface{}{nil, "", []string{testAudience}} {
+		claims := validClaims()
+		if aud == nil {
+			delete(claims, "aud")
+		} else {
+			claims["aud"] = aud
+		}
+		if _, err := validator.Validate(context.Background(), key.sign(t, claims)); err == nil {
+			t.Errorf("validator without audience accepted a token with aud %v", aud)
+		}
+	}
+}
+
+func TestJWKSRefreshesOnUnknownKeyID(t *testing.T) {
+	oldKey := newRSAKey(t, "old")
+	newKey := newECKey(t, "new")
+	server := newJWKSServer(t, oldKey)
+	validator := newTestValidator(server, testAudience)
+
+	if _, err := validator.Validate(context.Background(), oldKey.sign(t, validClaims())); err != nil {
+		t.Fatalf("Validate with the published key: %v", err)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+
+	// Keys rotate; an unknown kid right after a fetch is rate limited
+	server.publish(oldKey, newKey)
+	if _, err := validator.Validate(context.Background(), newKey.sign(t, validClaims())); err == nil {
+		t.Fatal("unknown kid accepted within the minimum refresh interval")
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times within the minimum refresh interval, want 1", got)
+	}
+
+	// Once the interval has passed the unknown kid triggers a refresh
+	validator.keys.mutex.Lock()
+	validator.keys.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	validator.keys.mutex.Unlock()
+	if _, err := validator.Validate(context.Background(), newKey.sign(t, validClaims())); err != nil {
+		t.Fatalf("Validate with the rotated key: %v", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", got)
+	}
+
+	// A kid the refreshed set does not have either is still rejected
+	validator.keys.mutex.Lock()
+	validator.keys.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	validator.keys.mutex.Unlock()
+	if _, err := validator.Validate(context.Background(), newRSAKey(t, "unknown").sign(t, validClaims())); err == nil {
+		t.Fatal("token with a kid missing from the JWKS accepted")
+	}
+}
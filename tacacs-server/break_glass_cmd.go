@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"tacacs-zitadel-server/breakglass"
+)
+
+const breakGlassUsage = `Usage: tacacs-server break-glass hash -user <name> [flags] < password
+
+  hash  read a password from standard input and print a break_glass.users_file line
+`
+
+// runBreakGlass implements the break-glass subcommand and returns the process exit code
+func runBreakGlass(args []string) int {
+	if len(args) == 0 || args[0] != "hash" {
+		fmt.Fprint(os.Stderr, breakGlassUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("break-glass hash", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, breakGlassUsage)
+		fs.PrintDefaults()
+	}
+	user := fs.String("user", "", "account name")
+	roles := fs.String("roles", "", "comma-separated roles, break_glass.roles when empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *user == "" || strings.Contains(*user, ":") {
+		fmt.Fprintln(os.Stderr, "break-glass: -user is required and must not contain ':'")
+		return 2
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "break-glass: no password on standard input (%v)\n", err)
+		return 1
+	}
+
+	hash, err := breakglass.Hash(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "break-glass: %v\n", err)
+		return 1
+	}
+	line := *user + ":" + hash
+	if *roles != "" {
+		line += ":" + *roles
+	}
+	fmt.Println(line)
+	return 0
+}
@@ -0,0 +1,194 @@
+package breakglass
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrMismatch is returned when a password does not match the account
+var ErrMismatch = errors.New("password does not match")
+
+// HashCost is the bcrypt cost of hashes created by Hash
+const HashCost = bcrypt.DefaultCost + 2
+
+type account struct {
+	hash  string
+	roles []string
+}
+
+// Accounts are emergency local users read from a file with one
+// username:hash[:role,...] entry per line. Hashes are bcrypt ($2a$, $2b$,
+// $2y$) or argon2id in PHC format ($argon2id$v=19$m=...,t=...,p=...$salt$key).
+// Blank lines and lines starting with # are ignored.
+type Accounts struct {
+	users  map[string]account
+	digest string
+}
+
+// Load reads and checks the accounts in path
+func Load(path string) (*Accounts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read break-glass accounts: %w", err)
+	}
+
+	a := &Accounts{users: make(map[string]account)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("%s:%d: expected username:hash[:roles]", path, n)
+		}
+		username, hash := fields[0], fields[1]
+		if err := checkHash(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if _, exists := a.users[username]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate account %q", path, n, username)
+		}
+		var roles []string
+		if len(fields) == 3 {
+			for _, role := range strings.Split(fields[2], ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					roles = append(roles, role)
+				}
+			}
+		}
+		a.users[username] = account{hash: hash, roles: roles}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read break-glass accounts: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	a.digest = hex.EncodeToString(sum[:6])
+	return a, nil
+}
+
+// Digest identifies the file contents the accounts were loaded from
+func (a *Accounts) Digest() string {
+	return a.digest
+}
+
+// Has reports whether username is a break-glass account
+func (a *Accounts) Has(username string) bool {
+	_, ok := a.users[username]
+	return ok
+}
+
+// Len returns the number of accounts
+func (a *Accounts) Len() int {
+	return len(a.users)
+}
+
+// Verify checks the password of a break-glass account and returns the roles
+// listed for it, which are nil when the line has none
+func (a *Accounts) Verify(username, password string) ([]string, error) {
+	acc, ok := a.users[username]
+	if !ok {
+		return nil, fmt.Errorf("no break-glass account %q", username)
+	}
+	if strings.HasPrefix(acc.hash, "$argon2id$") {
+		if err := compareArgon2id(acc.hash, password); err != nil {
+			return nil, err
+		}
+		return acc.roles, nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(acc.hash), []byte(password)); err != nil {
+		return nil, ErrMismatch
+	}
+	return acc.roles, nil
+}
+
+// Hash returns a bcrypt hash of password for an accounts file
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), HashCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func checkHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, _, _, err := parseArgon2id(hash)
+		return err
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("unsupported password hash, use bcrypt or argon2id: %w", err)
+	}
+	return nil
+}
+
+// Limits on argon2id parameters, so that a bad or hostile accounts file is
+// rejected at load instead of stalling or exhausting memory at login
+const (
+	maxArgon2Memory = 1 << 20 // KiB, 1 GiB
+	maxArgon2Time   = 16
+)
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2id splits $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	switch {
+	case p.time < 1 || p.time > maxArgon2Time:
+		return p, nil, nil, fmt.Errorf("argon2id t=%d: must be between 1 and %d", p.time, maxArgon2Time)
+	case p.threads < 1:
+		return p, nil, nil, fmt.Errorf("argon2id p=%d: must be at least 1", p.threads)
+	case p.memory < 8*uint32(p.threads) || p.memory > maxArgon2Memory:
+		return p, nil, nil, fmt.Errorf("argon2id m=%d: must be between 8*p and %d KiB", p.memory, maxArgon2Memory)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id key")
+	}
+	return p, salt, key, nil
+}
+
+func compareArgon2id(hash, password string) error {
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	derived := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
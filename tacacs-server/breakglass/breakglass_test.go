@@ -0,0 +1,97 @@
+package breakglass
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func argon2idHash(password string, m, t uint32, p uint8) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, t, m, p, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, m, t, p,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func writeAccounts(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "break-glass")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write accounts: %v", err)
+	}
+	return path
+}
+
+func TestLoadAndVerify(t *testing.T) {
+	bcryptHash, err := Hash("bcrypt-password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	path := writeAccounts(t, strings.Join([]string{
+		"# emergency accounts",
+		"",
+		"oncall:" + bcryptHash + ":admin, operator",
+		"backup:" + argon2idHash("argon-password", 64, 1, 1),
+	}, "\n"))
+
+	accounts, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accounts.Len() != 2 || !accounts.Has("oncall") || accounts.Has("alice") {
+		t.Fatalf("loaded %d accounts", accounts.Len())
+	}
+
+	tests := []struct {
+		username, password string
+		roles              []string
+		wantErr            bool
+	}{
+		{"oncall", "bcrypt-password", []string{"admin", "operator"}, false},
+		{"oncall", "wrong", nil, true},
+		{"backup", "argon-password", nil, false},
+		{"backup", "wrong", nil, true},
+		{"alice", "bcrypt-password", nil, true},
+	}
+	for _, tt := range tests {
+		roles, err := accounts.Verify(tt.username, tt.password)
+		if (err != nil) != tt.wantErr || strings.Join(roles, ",") != strings.Join(tt.roles, ",") {
+			t.Errorf("Verify(%q, %q) = %v, %v", tt.username, tt.password, roles, err)
+		}
+	}
+}
+
+func TestLoadRejectsBadArgon2idParameters(t *testing.T) {
+	valid := argon2idHash("password", 64, 1, 1)
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr string
+	}{
+		{"zero passes", strings.Replace(valid, "t=1", "t=0", 1), "t=0"},
+		{"too many passes", strings.Replace(valid, "t=1", "t=1000000", 1), "t=1000000"},
+		{"zero threads", strings.Replace(valid, "p=1", "p=0", 1), "p=0"},
+		{"threads overflow", strings.Replace(valid, "p=1", "p=300", 1), "invalid argon2id parameters"},
+		{"memory below 8 per thread", strings.Replace(valid, "m=64,t=1,p=1", "m=8,t=1,p=4", 1), "m=8"},
+		{"too much memory", strings.Replace(valid, "m=64", "m=4294967295", 1), "m=4294967295"},
+		{"other version", strings.Replace(valid, "v=19", "v=16", 1), "unsupported argon2id version"},
+		{"bad salt", strings.Replace(valid, "$MDEy", "$!!!!", 1), "invalid argon2id salt"},
+		{"not a hash", "plaintext", "unsupported password hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeAccounts(t, "oncall:"+tt.hash+"\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), ":1:") {
+				t.Errorf("error %q does not name the line", err)
+			}
+		})
+	}
+}
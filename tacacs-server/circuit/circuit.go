@@ -0,0 +1,132 @@
+package circuit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/metrics"
+)
+
+// ErrOpen is returned while the breaker fails calls fast
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a breaker; the values are exported as the circuit_state metric
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Breaker stops calls to an unhealthy dependency. After threshold
+// consecutive failures it opens and fails every call for openFor; then it
+// lets a single trial call through and closes again if that succeeds.
+type Breaker struct {
+	name      string
+	threshold int
+	openFor   time.Duration
+
+	mutex     sync.Mutex
+	state     State
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func NewBreaker(name string, threshold int, openFor time.Duration) *Breaker {
+	b := &Breaker{name: name, threshold: threshold, openFor: openFor}
+	metrics.CircuitState.WithLabelValues(name).Set(float64(Closed))
+	return b
+}
+
+// Allow returns ErrOpen unless a call may proceed; every allowed call must
+// be followed by Success, Failure or Abandon
+func (b *Breaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Now().Before(b.openUntil) {
+			return ErrOpen
+		}
+		b.transition(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a call that reached a healthy dependency
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != Closed {
+		b.transition(Closed)
+	}
+}
+
+// Failure records a call that found the dependency unavailable
+func (b *Breaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		b.openUntil = time.Now().Add(b.openFor)
+		b.transition(Open)
+	}
+}
+
+// Abandon records an allowed call that ended without showing whether the
+// dependency is healthy, such as one cancelled by its caller
+func (b *Breaker) Abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+func (b *Breaker) transition(state State) {
+	b.state = state
+	metrics.CircuitState.WithLabelValues(b.name).Set(float64(state))
+	metrics.CircuitTransitions.WithLabelValues(b.name, state.String()).Inc()
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// Check is a readiness probe that fails while the breaker is open
+func (b *Breaker) Check(ctx context.Context) error {
+	if b.State() == Open {
+		return ErrOpen
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package circuit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// openBreaker returns a breaker opened by threshold failures whose open
+// period has already run out, so the next Allow starts the half-open trial
+func openBreaker(t *testing.T) *Breaker {
+	t.Helper()
+	b := NewBreaker("test", 2, 0)
+	b.Failure()
+	b.Failure()
+	if state := b.State(); state != Open {
+		t.Fatalf("breaker %s after threshold failures, want open", state)
+	}
+	return b
+}
+
+func TestBreakerOpensAtThreshold(t *testing.T) {
+	b := NewBreaker("test", 3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		b.Failure()
+		if state := b.State(); state != Closed {
+			t.Fatalf("breaker %s after %d failures, want closed", state, i+1)
+		}
+	}
+	b.Failure()
+	if state := b.State(); state != Open {
+		t.Fatalf("breaker %s after 3 failures, want open", state)
+	}
+}
+
+func TestBreakerSuccessResetsFailureCount(t *testing.T) {
+	b := NewBreaker("test", 2, time.Hour)
+
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if state := b.State(); state != Closed {
+		t.Fatalf("breaker %s, want failures counted only while consecutive", state)
+	}
+}
+
+func TestBreakerFailsFastWhileOpen(t *testing.T) {
+	b := NewBreaker("test", 1, time.Hour)
+	b.Failure()
+
+	for i := 0; i < 3; i++ {
+		if err := b.Allow(); !errors.Is(err, ErrOpen) {
+			t.Fatalf("Allow = %v while open, want ErrOpen", err)
+		}
+	}
+	if err := b.Check(context.Background()); !errors.Is(err, ErrOpen) {
+		t.Errorf("Check = %v while open, want ErrOpen", err)
+	}
+}
+
+func TestBreakerAllowsOneHalfOpenTrial(t *testing.T) {
+	b := openBreaker(t)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow = %v after the open period, want the trial call", err)
+	}
+	if state := b.State(); state != HalfOpen {
+		t.Fatalf("breaker %s during the trial, want half_open", state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second Allow = %v during the trial, want ErrOpen", err)
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := openBreaker(t)
+	b.Allow()
+
+	b.Failure()
+	if state := b.State(); state != Open {
+		t.Errorf("breaker %s after a failed trial, want open", state)
+	}
+}
+
+func TestBreakerAbandonReleasesTrial(t *testing.T) {
+	b := openBreaker(t)
+	b.Allow()
+
+	b.Abandon()
+	if state := b.State(); state != HalfOpen {
+		t.Fatalf("breaker %s after an abandoned trial, want half_open", state)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow = %v after an abandoned trial, want a new trial", err)
+	}
+}
+
+func TestBreakerHalfOpenSuccessCloses(t *testing.T) {
+	b := openBreaker(t)
+	b.Allow()
+
+	b.Success()
+	if state := b.State(); state != Closed {
+		t.Fatalf("breaker %s after a successful trial, want closed", state)
+	}
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Errorf("Allow = %v once closed, want every call through", err)
+		}
+	}
+}
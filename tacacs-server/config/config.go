@@ -1,61 +1,537 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/viper"
-	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
 	TACACSListenAddress string `mapstructure:"tacacs_listen_address"`
 	HTTPListenAddress   string `mapstructure:"http_listen_address"`
-	TACACSSecret        string `mapstructure:"tacacs_secret"`
-	LogLevel            string `mapstructure:"log_level"`
-	
-	// Zitadel Configuration
-	ZitadelURL          string `mapstructure:"zitadel_url"`
-	ZitadelProjectID    string `mapstructure:"zitadel_project_id"`
-	ZitadelClientID     string `mapstructure:"zitadel_client_id"`
-	ZitadelClientSecret string `mapstructure:"zitadel_client_secret"`
+	// TACACSSecret is used for NAS addresses not covered by Clients
+	TACACSSecret string `mapstructure:"tacacs_secret"`
+	LogLevel     string `mapstructure:"log_level"`
+
+	// Listeners default to a single listener on TACACSListenAddress
+	Listeners []ListenerConfig `mapstructure:"listeners"`
+	Clients   []ClientConfig   `mapstructure:"clients"`
+	// Policies default to DefaultPolicies
+	Policies  []PolicyConfig  `mapstructure:"policies"`
+	Providers ProvidersConfig `mapstructure:"providers"`
+	Exporters ExportersConfig `mapstructure:"exporters"`
+	Secrets   SecretsConfig   `mapstructure:"secrets"`
+	Lockout   LockoutConfig   `mapstructure:"lockout"`
+	// RateLimits throttle packets per NAS and overall
+	RateLimits RateLimitsConfig `mapstructure:"rate_limits"`
+	Offline    OfflineConfig    `mapstructure:"offline"`
+	BreakGlass BreakGlassConfig `mapstructure:"break_glass"`
+
+	// HTTP API authentication (Zitadel-issued bearer tokens)
+	AdminJWKSURL     string `mapstructure:"admin_jwks_url"`
+	AdminIssuer      string `mapstructure:"admin_issuer"`
+	AdminAudience    string `mapstructure:"admin_audience"`
+	AdminRole        string `mapstructure:"admin_role"`
+	AdminAuditorRole string `mapstructure:"admin_auditor_role"`
 	
+	// Storage backend: postgres, sqlite or memory
+	StoreBackend string `mapstructure:"store_backend"`
+	SQLitePath   string `mapstructure:"sqlite_path"`
+
 	DBHost     string `mapstructure:"db_host"`
 	DBPort     string `mapstructure:"db_port"`
 	DBName     string `mapstructure:"db_name"`
 	DBUser     string `mapstructure:"db_user"`
 	DBPassword string `mapstructure:"db_password"`
+	// Dedicated PostgreSQL schema so our tables stay out of Zitadel's public schema
+	DBSchema      string `mapstructure:"db_schema"`
+	DBAutoMigrate bool   `mapstructure:"db_auto_migrate"`
 	
+	// Asynchronous audit writer; failed batches are spooled to AuditSpoolDir
+	AuditQueueSize       int    `mapstructure:"audit_queue_size"`
+	AuditBatchSize       int    `mapstructure:"audit_batch_size"`
+	AuditFlushIntervalMS int    `mapstructure:"audit_flush_interval_ms"`
+	AuditRetryInterval   int    `mapstructure:"audit_retry_interval"`
+	AuditSpoolDir        string `mapstructure:"audit_spool_dir"`
+
+	// Retention in days per table, 0 keeps rows forever; expired rows are
+	// archived to RetentionArchiveDir before deletion
+	RetentionSessionsDays   int    `mapstructure:"retention_sessions_days"`
+	RetentionCommandsDays   int    `mapstructure:"retention_commands_days"`
+	RetentionAccountingDays int    `mapstructure:"retention_accounting_days"`
+	RetentionInterval       int    `mapstructure:"retention_interval"`
+	RetentionBatchSize      int    `mapstructure:"retention_batch_size"`
+	RetentionArchiveDir     string `mapstructure:"retention_archive_dir"`
+
 	SessionTimeout        int `mapstructure:"session_timeout"`
 	TokenCacheTimeout     int `mapstructure:"token_cache_timeout"`
 	MaxConcurrentSessions int `mapstructure:"max_concurrent_sessions"`
+	// MaxSessionsPerUser caps active sessions of one username, 0 is unlimited
+	MaxSessionsPerUser int `mapstructure:"max_sessions_per_user"`
+
+	// ShutdownTimeout is how long in-flight requests may take to finish on shutdown (seconds)
+	ShutdownTimeout int `mapstructure:"shutdown_timeout"`
+
+	// Readiness probe configuration (seconds)
+	ReadinessCacheTTL     int `mapstructure:"readiness_cache_ttl"`
+	ReadinessProbeTimeout int `mapstructure:"readiness_probe_timeout"`
+}
+
+// ListenerConfig is a TACACS+ listening socket. Clients and Policies name
+// the clients and policies served on it; empty lists mean all of them.
+type ListenerConfig struct {
+	Name    string `mapstructure:"name"`
+	Address string `mapstructure:"address"`
+	// Interface binds the socket to a network device such as a management
+	// VRF (Linux only)
+	Interface string   `mapstructure:"interface"`
+	Clients   []string `mapstructure:"clients"`
+	Policies  []string `mapstructure:"policies"`
+	// TLS serves TACACS+ over TLS 1.3 (RFC 9887) instead of the obfuscated legacy protocol
+	TLS *ListenerTLSConfig `mapstructure:"tls"`
+	// ProxyProtocol accepts PROXY protocol headers from trusted load balancers
+	ProxyProtocol *ProxyProtocolConfig `mapstructure:"proxy_protocol"`
+}
+
+// ProxyProtocolConfig lists the load balancer networks whose connections must
+// start with a PROXY protocol v1 or v2 header naming the original NAS address.
+// Connections from other addresses are served directly.
+type ProxyProtocolConfig struct {
+	TrustedNetworks []string `mapstructure:"trusted_networks"`
+}
+
+// ListenerTLSConfig holds the server certificate of a TLS listener. With
+// ClientCAFile set, NAS certificates signed by that CA are verified and mapped
+// to clients by their identities.
+type ListenerTLSConfig struct {
+	CertFile          string `mapstructure:"cert_file"`
+	KeyFile           string `mapstructure:"key_file"`
+	ClientCAFile      string `mapstructure:"client_ca_file"`
+	RequireClientCert bool   `mapstructure:"require_client_cert"`
+}
+
+// ClientConfig is a group of NAS devices sharing a secret, matched by source
+// address or, on TLS listeners, by the names in their client certificate
+type ClientConfig struct {
+	Name     string   `mapstructure:"name"`
+	Networks []string `mapstructure:"networks"`
+	Secret   string   `mapstructure:"secret"`
+	// Identities are certificate DNS, URI or IP subject alternative names, or
+	// the subject common name, that identify the client under mutual TLS
+	Identities []string `mapstructure:"identities"`
+}
+
+// PolicyConfig maps roles to a privilege level and the commands they may run.
+// Commands and DenyCommands are regular expressions matched against the full
+// command line; a role of "*" matches every role.
+type PolicyConfig struct {
+	Name           string   `mapstructure:"name"`
+	Roles          []string `mapstructure:"roles"`
+	PrivilegeLevel int      `mapstructure:"privilege_level"`
+	Commands       []string `mapstructure:"commands"`
+	DenyCommands   []string `mapstructure:"deny_commands"`
+}
+
+// Authentication provider names usable in a chain
+const (
+	ProviderZitadel = "zitadel"
+	ProviderOIDC    = "oidc"
+)
+
+type ProvidersConfig struct {
+	Zitadel ZitadelConfig `mapstructure:"zitadel"`
+	OIDC    OIDCConfig    `mapstructure:"oidc"`
+	// Chain lists the providers to try in order; empty means Zitadel alone
+	Chain []ProviderLinkConfig `mapstructure:"chain"`
+}
+
+// Links returns the chain, or Zitadel alone when none is configured
+func (p ProvidersConfig) Links() []ProviderLinkConfig {
+	if len(p.Chain) == 0 {
+		return []ProviderLinkConfig{{Provider: ProviderZitadel}}
+	}
+	return p.Chain
+}
+
+// Uses reports whether the provider named name is part of the chain
+func (p ProvidersConfig) Uses(name string) bool {
+	for _, link := range p.Links() {
+		if link.Provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProviderLinkConfig is one provider of the chain and the logins it is asked
+// about. Every non-empty match list must match, and within a list any entry
+// may; a provider that is unavailable passes the login on to the next one.
+type ProviderLinkConfig struct {
+	Provider string              `mapstructure:"provider"`
+	Match    ProviderMatchConfig `mapstructure:"match"`
+	// StripRealm passes the username to the provider without its @realm
+	StripRealm bool `mapstructure:"strip_realm"`
+}
+
+// ProviderMatchConfig selects logins by username suffix, by realm (the part
+// of the username after its last @) and by the client the NAS belongs to
+type ProviderMatchConfig struct {
+	Suffixes  []string `mapstructure:"suffixes"`
+	Realms    []string `mapstructure:"realms"`
+	NASGroups []string `mapstructure:"nas_groups"`
+}
+
+type ZitadelConfig struct {
+	URL          string `mapstructure:"url"`
+	ProjectID    string `mapstructure:"project_id"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// Timeouts bound every attempt of a call, per endpoint
+	Timeouts ZitadelTimeouts `mapstructure:"timeouts"`
+	// Retries of idempotent calls after a transport error, 429 or 5xx; the
+	// password grant is never retried
+	Retries        int                  `mapstructure:"retries"`
+	RetryBackoffMS int                  `mapstructure:"retry_backoff_ms"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// OIDCConfig points at any OpenID Connect provider that allows the password
+// grant, such as Keycloak or Authentik. Its endpoints are discovered from
+// Issuer. Roles and groups are read from the access token, the ID token or
+// userinfo, whichever first has the claim.
+type OIDCConfig struct {
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// Scopes are requested in addition to openid
+	Scopes []string `mapstructure:"scopes"`
+	// RoleClaim and GroupsClaim are claim paths such as realm_access.roles
+	// or resource_access['tacacs'].roles; an empty GroupsClaim reads no groups
+	RoleClaim   string `mapstructure:"role_claim"`
+	GroupsClaim string `mapstructure:"groups_claim"`
+	// Timeout bounds every call in milliseconds; calls are not retried
+	Timeout        int                  `mapstructure:"timeout"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// ZitadelTimeouts are in milliseconds. Token and userinfo calls are made
+// while a NAS waits, so together they must stay below its TACACS+ timeout.
+type ZitadelTimeouts struct {
+	Token      int `mapstructure:"token"`
+	UserInfo   int `mapstructure:"userinfo"`
+	Discovery  int `mapstructure:"discovery"`
+	Management int `mapstructure:"management"`
+}
+
+// CircuitBreakerConfig opens the breaker after FailureThreshold consecutive
+// failed calls; calls then fail fast for OpenSeconds before one is let through
+type CircuitBreakerConfig struct {
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	OpenSeconds      int `mapstructure:"open_seconds"`
+}
+
+// SecretsConfig configures external secret stores used by secret references
+type SecretsConfig struct {
+	Vault VaultConfig `mapstructure:"vault"`
+}
+
+// VaultConfig points at a Vault server with KV v1 or v2 engines. Token may itself
+// be a file:// or env: reference.
+type VaultConfig struct {
+	Address   string `mapstructure:"address"`
+	Token     string `mapstructure:"token"`
+	Namespace string `mapstructure:"namespace"`
+	Timeout   int    `mapstructure:"timeout"`
+}
+
+// LockoutConfig throttles password guessing. Failed logins are counted per
+// username, per NAS and per rem_addr; Threshold failures within Window
+// seconds lock that key for BaseDuration seconds, doubled on each repeated
+// lockout up to MaxDuration. A threshold of 0 turns its scope off.
+type LockoutConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	UserThreshold    int  `mapstructure:"user_threshold"`
+	NASThreshold     int  `mapstructure:"nas_threshold"`
+	RemAddrThreshold int  `mapstructure:"rem_addr_threshold"`
+	Window           int  `mapstructure:"window"`
+	BaseDuration     int  `mapstructure:"base_duration"`
+	MaxDuration      int  `mapstructure:"max_duration"`
 }
 
-func Load() *Config {
-	viper.SetDefault("tacacs_listen_address", "0.0.0.0:49")
-	viper.SetDefault("http_listen_address", "0.0.0.0:8090")
-	viper.SetDefault("tacacs_secret", "testing123")
-	viper.SetDefault("log_level", "info")
+// OfflineConfig lets users who logged in through Zitadel within the last
+// WindowHours log in again while the Zitadel circuit breaker is open. Their
+// passwords are kept as bcrypt hashes with their last known roles in
+// CacheFile, and offline sessions are only granted policies of at most
+// MaxPrivilegeLevel.
+type OfflineConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	CacheFile         string `mapstructure:"cache_file"`
+	WindowHours       int    `mapstructure:"window_hours"`
+	MaxPrivilegeLevel int    `mapstructure:"max_privilege_level"`
+}
+
+// BreakGlassConfig enables emergency local accounts read from UsersFile.
+// They can log in only while Active is set or, with WhenZitadelUnavailable,
+// while the Zitadel provider cannot be reached. Accounts listed without roles get Roles.
+type BreakGlassConfig struct {
+	Enabled                bool     `mapstructure:"enabled"`
+	UsersFile              string   `mapstructure:"users_file"`
+	Active                 bool     `mapstructure:"active"`
+	WhenZitadelUnavailable bool     `mapstructure:"when_zitadel_unavailable"`
+	Roles                  []string `mapstructure:"roles"`
+}
+
+// RateLimitsConfig holds token buckets per packet type shared by all NAS
+// (Global) and kept for each NAS (PerNAS), and a cap on authentications
+// waiting on Zitadel at once. Packets over a limit get an error reply.
+type RateLimitsConfig struct {
+	Global PacketRates `mapstructure:"global"`
+	PerNAS PacketRates `mapstructure:"per_nas"`
+	// ZitadelConcurrency is the most outstanding Zitadel calls, 0 is unlimited
+	ZitadelConcurrency int `mapstructure:"zitadel_concurrency"`
+}
+
+type PacketRates struct {
+	Authentication Rate `mapstructure:"authentication"`
+	Authorization  Rate `mapstructure:"authorization"`
+	Accounting     Rate `mapstructure:"accounting"`
+}
+
+// For returns the rate of a packet type: authentication, authorization or accounting
+func (p PacketRates) For(packetType string) Rate {
+	switch packetType {
+	case "authentication":
+		return p.Authentication
+	case "authorization":
+		return p.Authorization
+	case "accounting":
+		return p.Accounting
+	}
+	return Rate{}
+}
+
+// Rate is a sustained number of packets per second and the burst allowed
+// above it; a rate of 0 is unlimited
+type Rate struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+type ExportersConfig struct {
+	Tracing TracingConfig `mapstructure:"tracing"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	File        string  `mapstructure:"file"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// DefaultPolicies reproduce the built-in role mapping used when no policies are configured
+func DefaultPolicies() []PolicyConfig {
+	return []PolicyConfig{
+		{Name: "admin", Roles: []string{"network-admin", "admin", "zitadel.admin"}, PrivilegeLevel: 15, Commands: []string{".*"}},
+		{Name: "user", Roles: []string{"network-user", "user", "zitadel.user"}, PrivilegeLevel: 1, Commands: []string{".*"}},
+		{Name: "readonly", Roles: []string{"*"}, PrivilegeLevel: 0, Commands: []string{"(?i)^(show|ping|traceroute|telnet|ssh)"}},
+	}
+}
+
+// envBindings keeps the flat environment variable names for nested keys
+var envBindings = map[string]string{
+	"providers.zitadel.url":                               "ZITADEL_URL",
+	"providers.zitadel.project_id":                        "ZITADEL_PROJECT_ID",
+	"providers.zitadel.client_id":                         "ZITADEL_CLIENT_ID",
+	"providers.zitadel.client_secret":                     "ZITADEL_CLIENT_SECRET",
+	"providers.zitadel.timeouts.token":                    "ZITADEL_TIMEOUT_TOKEN_MS",
+	"providers.zitadel.timeouts.userinfo":                 "ZITADEL_TIMEOUT_USERINFO_MS",
+	"providers.zitadel.timeouts.discovery":                "ZITADEL_TIMEOUT_DISCOVERY_MS",
+	"providers.zitadel.timeouts.management":               "ZITADEL_TIMEOUT_MANAGEMENT_MS",
+	"providers.zitadel.retries":                           "ZITADEL_RETRIES",
+	"providers.zitadel.retry_backoff_ms":                  "ZITADEL_RETRY_BACKOFF_MS",
+	"providers.zitadel.circuit_breaker.failure_threshold": "ZITADEL_CIRCUIT_FAILURE_THRESHOLD",
+	"providers.zitadel.circuit_breaker.open_seconds":      "ZITADEL_CIRCUIT_OPEN_SECONDS",
+	"providers.oidc.issuer":                               "OIDC_ISSUER",
+	"providers.oidc.client_id":                            "OIDC_CLIENT_ID",
+	"providers.oidc.client_secret":                        "OIDC_CLIENT_SECRET",
+	"providers.oidc.role_claim":                           "OIDC_ROLE_CLAIM",
+	"providers.oidc.groups_claim":                         "OIDC_GROUPS_CLAIM",
+	"providers.oidc.timeout":                              "OIDC_TIMEOUT_MS",
+	"exporters.tracing.exporter":                          "TRACING_EXPORTER",
+	"exporters.tracing.endpoint":                          "TRACING_ENDPOINT",
+	"exporters.tracing.insecure":                          "TRACING_INSECURE",
+	"exporters.tracing.file":                              "TRACING_FILE",
+	"exporters.tracing.sample_ratio":                      "TRACING_SAMPLE_RATIO",
+	"secrets.vault.address":                               "VAULT_ADDR",
+	"secrets.vault.token":                                 "VAULT_TOKEN",
+	"secrets.vault.namespace":                             "VAULT_NAMESPACE",
+}
+
+// Load reads defaults, then the YAML or TOML file at path if set, then
+// environment variables, each layer overriding the previous one. Secret
+// references are resolved here, so every reload picks up rotated secrets. The
+// result is not validated; call Validate before using it to serve.
+func Load(path string) (*Config, error) {
+	v := viper.New()
+
+	v.SetDefault("tacacs_listen_address", "0.0.0.0:49")
+	v.SetDefault("http_listen_address", "0.0.0.0:8090")
+	v.SetDefault("tacacs_secret", "")
+	v.SetDefault("log_level", "info")
 	
 	// Zitadel defaults
-	viper.SetDefault("zitadel_url", "http://localhost:8080")
-	viper.SetDefault("zitadel_project_id", "")
-	viper.SetDefault("zitadel_client_id", "")
-	viper.SetDefault("zitadel_client_secret", "")
+	v.SetDefault("providers.zitadel.url", "http://localhost:8080")
+	v.SetDefault("providers.zitadel.project_id", "")
+	v.SetDefault("providers.zitadel.client_id", "")
+	v.SetDefault("providers.zitadel.client_secret", "")
+	v.SetDefault("providers.zitadel.timeouts.token", 2000)
+	v.SetDefault("providers.zitadel.timeouts.userinfo", 1000)
+	v.SetDefault("providers.zitadel.timeouts.discovery", 2000)
+	v.SetDefault("providers.zitadel.timeouts.management", 5000)
+	v.SetDefault("providers.zitadel.retries", 1)
+	v.SetDefault("providers.zitadel.retry_backoff_ms", 100)
+	v.SetDefault("providers.zitadel.circuit_breaker.failure_threshold", 5)
+	v.SetDefault("providers.zitadel.circuit_breaker.open_seconds", 30)
+
+	// Generic OIDC defaults, used only when the chain lists oidc
+	v.SetDefault("providers.oidc.issuer", "")
+	v.SetDefault("providers.oidc.client_id", "")
+	v.SetDefault("providers.oidc.client_secret", "")
+	v.SetDefault("providers.oidc.scopes", []string{"profile", "email"})
+	v.SetDefault("providers.oidc.role_claim", "roles")
+	v.SetDefault("providers.oidc.groups_claim", "groups")
+	v.SetDefault("providers.oidc.timeout", 2000)
+	v.SetDefault("providers.oidc.circuit_breaker.failure_threshold", 5)
+	v.SetDefault("providers.oidc.circuit_breaker.open_seconds", 30)
+
+	// Empty JWKS URL, issuer and audience derive from the Zitadel settings
+	v.SetDefault("admin_jwks_url", "")
+	v.SetDefault("admin_issuer", "")
+	v.SetDefault("admin_audience", "")
+	v.SetDefault("admin_role", "tacacs-admin")
+	v.SetDefault("admin_auditor_role", "tacacs-auditor")
 	
-	viper.SetDefault("db_host", "localhost")
-	viper.SetDefault("db_port", "5432")
-	viper.SetDefault("db_name", "zitadel")
-	viper.SetDefault("db_user", "zitadel")
-	viper.SetDefault("db_password", "zitadel")
+	v.SetDefault("store_backend", "postgres")
+	v.SetDefault("sqlite_path", "tacacs.db")
+
+	v.SetDefault("db_host", "localhost")
+	v.SetDefault("db_port", "5432")
+	v.SetDefault("db_name", "zitadel")
+	v.SetDefault("db_user", "zitadel")
+	v.SetDefault("db_password", defaultDBPassword)
+	v.SetDefault("db_schema", "tacacs")
+	v.SetDefault("db_auto_migrate", true)
 	
-	viper.SetDefault("session_timeout", 3600)
-	viper.SetDefault("token_cache_timeout", 300)
-	viper.SetDefault("max_concurrent_sessions", 1000)
+	v.SetDefault("audit_queue_size", 10000)
+	v.SetDefault("audit_batch_size", 100)
+	v.SetDefault("audit_flush_interval_ms", 200)
+	v.SetDefault("audit_retry_interval", 10)
+	v.SetDefault("audit_spool_dir", "spool")
+
+	v.SetDefault("retention_sessions_days", 0)
+	v.SetDefault("retention_commands_days", 0)
+	v.SetDefault("retention_accounting_days", 0)
+	v.SetDefault("retention_interval", 3600)
+	v.SetDefault("retention_batch_size", 5000)
+	v.SetDefault("retention_archive_dir", "archive")
+
+	v.SetDefault("session_timeout", 3600)
+	v.SetDefault("token_cache_timeout", 300)
+	v.SetDefault("max_concurrent_sessions", 1000)
+	v.SetDefault("max_sessions_per_user", 0)
+
+	v.SetDefault("shutdown_timeout", 10)
+
+	v.SetDefault("lockout.enabled", true)
+	v.SetDefault("lockout.user_threshold", 5)
+	v.SetDefault("lockout.nas_threshold", 100)
+	v.SetDefault("lockout.rem_addr_threshold", 10)
+	v.SetDefault("lockout.window", 900)
+	v.SetDefault("lockout.base_duration", 60)
+	v.SetDefault("lockout.max_duration", 3600)
+
+	v.SetDefault("offline.enabled", false)
+	v.SetDefault("offline.cache_file", "offline/credentials.json")
+	v.SetDefault("offline.window_hours", 24)
+	v.SetDefault("offline.max_privilege_level", 1)
+
+	v.SetDefault("break_glass.enabled", false)
+	v.SetDefault("break_glass.users_file", "")
+	v.SetDefault("break_glass.active", false)
+	v.SetDefault("break_glass.when_zitadel_unavailable", true)
+	v.SetDefault("break_glass.roles", []string{"network-admin"})
+
+	// Packets per second and burst; a rate of 0 is unlimited
+	v.SetDefault("rate_limits.global.authentication.rate", 500)
+	v.SetDefault("rate_limits.global.authentication.burst", 1000)
+	v.SetDefault("rate_limits.global.authorization.rate", 2000)
+	v.SetDefault("rate_limits.global.authorization.burst", 4000)
+	v.SetDefault("rate_limits.global.accounting.rate", 2000)
+	v.SetDefault("rate_limits.global.accounting.burst", 4000)
+	v.SetDefault("rate_limits.per_nas.authentication.rate", 50)
+	v.SetDefault("rate_limits.per_nas.authentication.burst", 100)
+	v.SetDefault("rate_limits.per_nas.authorization.rate", 200)
+	v.SetDefault("rate_limits.per_nas.authorization.burst", 400)
+	v.SetDefault("rate_limits.per_nas.accounting.rate", 200)
+	v.SetDefault("rate_limits.per_nas.accounting.burst", 400)
+	v.SetDefault("rate_limits.zitadel_concurrency", 100)
+
+	v.SetDefault("readiness_cache_ttl", 5)
+	v.SetDefault("readiness_probe_timeout", 2)
+
+	// Tracing defaults: exporter is one of none, otlp, stdout, file
+	v.SetDefault("exporters.tracing.exporter", "none")
+	v.SetDefault("exporters.tracing.endpoint", "localhost:4318")
+	v.SetDefault("exporters.tracing.insecure", true)
+	v.SetDefault("exporters.tracing.file", "traces.json")
+	v.SetDefault("exporters.tracing.sample_ratio", 1.0)
 
-	viper.AutomaticEnv()
+	v.SetDefault("secrets.vault.address", "")
+	v.SetDefault("secrets.vault.token", "")
+	v.SetDefault("secrets.vault.namespace", "")
+	v.SetDefault("secrets.vault.timeout", 5)
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	}
+
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, env := range envBindings {
+		if err := v.BindEnv(key, env); err != nil {
+			return nil, fmt.Errorf("failed to bind %s: %w", env, err)
+		}
+	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		logrus.WithError(err).Fatal("Failed to unmarshal configuration")
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
+	}
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	zitadel := config.Providers.Zitadel
+	if config.AdminJWKSURL == "" {
+		config.AdminJWKSURL = zitadel.URL + "/oauth/v2/keys"
+	}
+	if config.AdminIssuer == "" {
+		config.AdminIssuer = zitadel.URL
+	}
+	if config.AdminAudience == "" {
+		config.AdminAudience = zitadel.ProjectID
+	}
+	if len(config.Listeners) == 0 {
+		config.Listeners = []ListenerConfig{{Name: "default", Address: config.TACACSListenAddress}}
+	}
+	if len(config.Policies) == 0 {
+		config.Policies = DefaultPolicies()
 	}
 
-	return &config
+	return &config, nil
 }
\ No newline at end of file
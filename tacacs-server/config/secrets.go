@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tacacs-zitadel-server/secrets"
+)
+
+// resolveSecrets replaces secret references (file:///path, env:NAME,
+// vault:mount/path#key) in secret settings with the values they point to
+func (c *Config) resolveSecrets() error {
+	timeout := time.Duration(c.Secrets.Vault.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*timeout)
+	defer cancel()
+
+	registry := secrets.NewRegistry()
+	token, err := registry.Resolve(ctx, c.Secrets.Vault.Token)
+	if err != nil {
+		return fmt.Errorf("failed to resolve secrets.vault.token: %w", err)
+	}
+	registry.Register("vault", secrets.NewVaultResolver(c.Secrets.Vault.Address, token, c.Secrets.Vault.Namespace, timeout))
+
+	fields := []struct {
+		key   string
+		value *string
+	}{
+		{"tacacs_secret", &c.TACACSSecret},
+		{"providers.zitadel.client_secret", &c.Providers.Zitadel.ClientSecret},
+		{"providers.oidc.client_secret", &c.Providers.OIDC.ClientSecret},
+		{"db_password", &c.DBPassword},
+	}
+	for i := range c.Clients {
+		fields = append(fields, struct {
+			key   string
+			value *string
+		}{fmt.Sprintf("clients[%d].secret", i), &c.Clients[i].Secret})
+	}
+
+	var errs []error
+	for _, field := range fields {
+		resolved, err := registry.Resolve(ctx, *field.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve %s: %w", field.key, err))
+			continue
+		}
+		*field.value = resolved
+	}
+	return errors.Join(errs...)
+}
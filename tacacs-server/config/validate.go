@@ -0,0 +1,384 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/breakglass"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minSecretLength is the shortest TACACS+ shared secret accepted
+const minSecretLength = 8
+
+// defaultDBPassword is the example password of the bundled Zitadel database
+const defaultDBPassword = "zitadel"
+
+// weakSecrets are well-known example secrets that must never reach production
+var weakSecrets = map[string]bool{
+	"testing123": true,
+	"secret":     true,
+	"changeme":   true,
+	"tacacs":     true,
+	"cisco":      true,
+}
+
+// Validate checks the configuration and returns every problem found joined
+// into one error. Unsafe settings such as example secrets or missing
+// credentials are errors rather than silent fallbacks.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		fail("log_level: %v", err)
+	}
+	if _, _, err := net.SplitHostPort(c.HTTPListenAddress); err != nil {
+		fail("http_listen_address: %v", err)
+	}
+
+	if len(c.Listeners) == 0 {
+		fail("at least one listener is required")
+	}
+	definedClients := make(map[string]bool)
+	for _, client := range c.Clients {
+		definedClients[client.Name] = true
+	}
+	definedPolicies := make(map[string]bool)
+	for _, policy := range c.Policies {
+		definedPolicies[policy.Name] = true
+	}
+	listenerNames := make(map[string]bool)
+	listenerAddresses := make(map[string]bool)
+	for i, l := range c.Listeners {
+		switch {
+		case l.Name == "":
+			fail("listeners[%d]: name is required", i)
+		case listenerNames[l.Name]:
+			fail("listeners[%d]: duplicate name %q", i, l.Name)
+		}
+		listenerNames[l.Name] = true
+		// The same address may be bound once per interface
+		binding := l.Interface + "/" + l.Address
+		if _, _, err := net.SplitHostPort(l.Address); err != nil {
+			fail("listeners[%d] (%s): address: %v", i, l.Name, err)
+		} else if listenerAddresses[binding] {
+			fail("listeners[%d] (%s): address %s is already used", i, l.Name, l.Address)
+		}
+		listenerAddresses[binding] = true
+		for _, name := range l.Clients {
+			if !definedClients[name] {
+				fail("listeners[%d] (%s): unknown client %q", i, l.Name, name)
+			}
+		}
+		for _, name := range l.Policies {
+			if !definedPolicies[name] {
+				fail("listeners[%d] (%s): unknown policy %q", i, l.Name, name)
+			}
+		}
+		if l.ProxyProtocol != nil {
+			if len(l.ProxyProtocol.TrustedNetworks) == 0 {
+				fail("listeners[%d] (%s): proxy_protocol: at least one trusted network is required", i, l.Name)
+			}
+			for _, network := range l.ProxyProtocol.TrustedNetworks {
+				if _, _, err := net.ParseCIDR(network); err != nil {
+					fail("listeners[%d] (%s): proxy_protocol: %v", i, l.Name, err)
+				}
+			}
+		}
+		if l.TLS != nil {
+			for _, err := range checkListenerTLS(l.TLS) {
+				fail("listeners[%d] (%s): tls: %v", i, l.Name, err)
+			}
+		}
+	}
+
+	if c.TACACSSecret == "" && len(c.Clients) == 0 {
+		fail("no TACACS+ secret configured: set tacacs_secret or define clients")
+	}
+	if c.TACACSSecret != "" {
+		if err := checkSecret(c.TACACSSecret); err != nil {
+			fail("tacacs_secret: %v", err)
+		}
+	}
+	clientNames := make(map[string]bool)
+	clientIdentities := make(map[string]string)
+	for i, client := range c.Clients {
+		switch {
+		case client.Name == "":
+			fail("clients[%d]: name is required", i)
+		case clientNames[client.Name]:
+			fail("clients[%d]: duplicate name %q", i, client.Name)
+		}
+		clientNames[client.Name] = true
+		if len(client.Networks) == 0 && len(client.Identities) == 0 {
+			fail("clients[%d] (%s): at least one network or identity is required", i, client.Name)
+		}
+		for _, network := range client.Networks {
+			if _, _, err := net.ParseCIDR(network); err != nil {
+				fail("clients[%d] (%s): %v", i, client.Name, err)
+			}
+		}
+		for _, identity := range client.Identities {
+			if owner, ok := clientIdentities[strings.ToLower(identity)]; ok {
+				fail("clients[%d] (%s): identity %q is already used by %s", i, client.Name, identity, owner)
+			}
+			clientIdentities[strings.ToLower(identity)] = client.Name
+		}
+		// Clients known only by certificate identity use TLS, which needs no secret
+		if len(client.Networks) > 0 || client.Secret != "" {
+			if err := checkSecret(client.Secret); err != nil {
+				fail("clients[%d] (%s): secret: %v", i, client.Name, err)
+			}
+		}
+	}
+
+	for i, policy := range c.Policies {
+		label := policy.Name
+		if label == "" {
+			label = fmt.Sprint(i)
+		}
+		if len(policy.Roles) == 0 {
+			fail("policies[%s]: at least one role is required", label)
+		}
+		if policy.PrivilegeLevel < 0 || policy.PrivilegeLevel > 15 {
+			fail("policies[%s]: privilege_level must be between 0 and 15", label)
+		}
+		for _, pattern := range append(append([]string{}, policy.Commands...), policy.DenyCommands...) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				fail("policies[%s]: invalid command pattern %q: %v", label, pattern, err)
+			}
+		}
+	}
+
+	for i, link := range c.Providers.Chain {
+		switch link.Provider {
+		case ProviderZitadel, ProviderOIDC:
+		default:
+			fail("providers.chain[%d]: unknown provider %q", i, link.Provider)
+		}
+		for _, group := range link.Match.NASGroups {
+			if !clientNames[group] {
+				fail("providers.chain[%d]: nas_groups: unknown client %q", i, group)
+			}
+		}
+	}
+
+	if c.Providers.Uses(ProviderZitadel) {
+		zitadel := c.Providers.Zitadel
+		if u, err := url.Parse(zitadel.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("providers.zitadel.url: must be an http or https URL, got %q", zitadel.URL)
+		}
+		if zitadel.ProjectID == "" {
+			fail("providers.zitadel.project_id is required")
+		}
+		if zitadel.ClientID == "" {
+			fail("providers.zitadel.client_id is required")
+		}
+		if zitadel.ClientSecret == "" {
+			fail("providers.zitadel.client_secret is required")
+		}
+	}
+
+	if c.Providers.Uses(ProviderOIDC) {
+		oidc := c.Providers.OIDC
+		if u, err := url.Parse(oidc.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("providers.oidc.issuer: must be an http or https URL, got %q", oidc.Issuer)
+		}
+		if oidc.ClientID == "" {
+			fail("providers.oidc.client_id is required")
+		}
+		if _, err := auth.ParseClaimPath(oidc.RoleClaim); err != nil {
+			fail("providers.oidc.role_claim: %v", err)
+		}
+		if oidc.GroupsClaim != "" {
+			if _, err := auth.ParseClaimPath(oidc.GroupsClaim); err != nil {
+				fail("providers.oidc.groups_claim: %v", err)
+			}
+		}
+	}
+
+	if vault := c.Secrets.Vault.Address; vault != "" {
+		if u, err := url.Parse(vault); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("secrets.vault.address: must be an http or https URL, got %q", vault)
+		}
+	}
+
+	if c.AdminRole == "" || c.AdminAuditorRole == "" {
+		fail("admin_role and admin_auditor_role must not be empty")
+	}
+	// An empty audience would let any token of the issuer into the API
+	if c.AdminAudience == "" {
+		fail("admin_audience is required: set it or providers.zitadel.project_id")
+	}
+
+	switch c.StoreBackend {
+	case "postgres":
+		if c.DBHost == "" || c.DBName == "" || c.DBUser == "" {
+			fail("db_host, db_name and db_user are required for the postgres backend")
+		}
+		if c.DBPassword == defaultDBPassword {
+			fail("db_password: must not be the default example password %q", defaultDBPassword)
+		}
+	case "sqlite":
+		if c.SQLitePath == "" {
+			fail("sqlite_path is required for the sqlite backend")
+		}
+	case "memory":
+	default:
+		fail("store_backend: unknown backend %q", c.StoreBackend)
+	}
+
+	tracing := c.Exporters.Tracing
+	switch strings.ToLower(tracing.Exporter) {
+	case "none", "stdout":
+	case "otlp":
+		if tracing.Endpoint == "" {
+			fail("exporters.tracing.endpoint is required for the otlp exporter")
+		}
+	case "file":
+		if tracing.File == "" {
+			fail("exporters.tracing.file is required for the file exporter")
+		}
+	default:
+		fail("exporters.tracing.exporter: unknown exporter %q", tracing.Exporter)
+	}
+	if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+		fail("exporters.tracing.sample_ratio must be between 0 and 1")
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value int
+		min   int
+	}{
+		{"session_timeout", c.SessionTimeout, 1},
+		{"token_cache_timeout", c.TokenCacheTimeout, 1},
+		{"max_concurrent_sessions", c.MaxConcurrentSessions, 1},
+		{"readiness_probe_timeout", c.ReadinessProbeTimeout, 1},
+		{"shutdown_timeout", c.ShutdownTimeout, 1},
+		{"secrets.vault.timeout", c.Secrets.Vault.Timeout, 1},
+		{"providers.zitadel.timeouts.token", c.Providers.Zitadel.Timeouts.Token, 1},
+		{"providers.zitadel.timeouts.userinfo", c.Providers.Zitadel.Timeouts.UserInfo, 1},
+		{"providers.zitadel.timeouts.discovery", c.Providers.Zitadel.Timeouts.Discovery, 1},
+		{"providers.zitadel.timeouts.management", c.Providers.Zitadel.Timeouts.Management, 1},
+		{"providers.zitadel.retries", c.Providers.Zitadel.Retries, 0},
+		{"providers.zitadel.retry_backoff_ms", c.Providers.Zitadel.RetryBackoffMS, 1},
+		{"providers.zitadel.circuit_breaker.failure_threshold", c.Providers.Zitadel.CircuitBreaker.FailureThreshold, 1},
+		{"providers.zitadel.circuit_breaker.open_seconds", c.Providers.Zitadel.CircuitBreaker.OpenSeconds, 1},
+		{"providers.oidc.timeout", c.Providers.OIDC.Timeout, 1},
+		{"providers.oidc.circuit_breaker.failure_threshold", c.Providers.OIDC.CircuitBreaker.FailureThreshold, 1},
+		{"providers.oidc.circuit_breaker.open_seconds", c.Providers.OIDC.CircuitBreaker.OpenSeconds, 1},
+		{"max_sessions_per_user", c.MaxSessionsPerUser, 0},
+		{"rate_limits.zitadel_concurrency", c.RateLimits.ZitadelConcurrency, 0},
+		{"lockout.user_threshold", c.Lockout.UserThreshold, 0},
+		{"lockout.nas_threshold", c.Lockout.NASThreshold, 0},
+		{"lockout.rem_addr_threshold", c.Lockout.RemAddrThreshold, 0},
+		{"lockout.window", c.Lockout.Window, 1},
+		{"lockout.base_duration", c.Lockout.BaseDuration, 1},
+		{"lockout.max_duration", c.Lockout.MaxDuration, 1},
+		{"offline.window_hours", c.Offline.WindowHours, 1},
+		{"audit_queue_size", c.AuditQueueSize, 1},
+		{"audit_batch_size", c.AuditBatchSize, 1},
+		{"audit_flush_interval_ms", c.AuditFlushIntervalMS, 1},
+		{"audit_retry_interval", c.AuditRetryInterval, 1},
+		{"retention_interval", c.RetentionInterval, 1},
+		{"retention_batch_size", c.RetentionBatchSize, 1},
+		{"retention_sessions_days", c.RetentionSessionsDays, 0},
+		{"retention_commands_days", c.RetentionCommandsDays, 0},
+		{"retention_accounting_days", c.RetentionAccountingDays, 0},
+	} {
+		if setting.value < setting.min {
+			fail("%s must be at least %d", setting.key, setting.min)
+		}
+	}
+
+	for scope, rates := range map[string]PacketRates{"global": c.RateLimits.Global, "per_nas": c.RateLimits.PerNAS} {
+		for _, packetType := range []string{"authentication", "authorization", "accounting"} {
+			r := rates.For(packetType)
+			switch {
+			case r.Rate < 0:
+				fail("rate_limits.%s.%s.rate must not be negative", scope, packetType)
+			case r.Rate > 0 && r.Burst < 1:
+				fail("rate_limits.%s.%s.burst must be at least 1", scope, packetType)
+			}
+		}
+	}
+
+	if c.Lockout.MaxDuration < c.Lockout.BaseDuration {
+		fail("lockout.max_duration must be at least lockout.base_duration")
+	}
+
+	if c.Offline.Enabled && c.Offline.CacheFile == "" {
+		fail("offline.cache_file is required when offline.enabled is set")
+	}
+	if c.BreakGlass.Enabled {
+		if c.BreakGlass.UsersFile == "" {
+			fail("break_glass.users_file is required when break_glass.enabled is set")
+		} else if _, err := breakglass.Load(c.BreakGlass.UsersFile); err != nil {
+			fail("break_glass.users_file: %v", err)
+		}
+		if !c.BreakGlass.Active && !c.BreakGlass.WhenZitadelUnavailable {
+			fail("break_glass needs active or when_zitadel_unavailable, otherwise its accounts can never log in")
+		}
+	}
+
+	if c.Offline.MaxPrivilegeLevel < 0 || c.Offline.MaxPrivilegeLevel > 15 {
+		fail("offline.max_privilege_level must be between 0 and 15")
+	}
+
+	return errors.Join(errs...)
+}
+
+func checkListenerTLS(t *ListenerTLSConfig) []error {
+	var errs []error
+	if t.CertFile == "" || t.KeyFile == "" {
+		errs = append(errs, fmt.Errorf("cert_file and key_file are required"))
+	} else if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+		errs = append(errs, fmt.Errorf("failed to load certificate: %w", err))
+	}
+	if t.ClientCAFile != "" {
+		if _, err := LoadCertPool(t.ClientCAFile); err != nil {
+			errs = append(errs, err)
+		}
+	} else if t.RequireClientCert {
+		errs = append(errs, fmt.Errorf("require_client_cert needs client_ca_file"))
+	}
+	return errs
+}
+
+// LoadCertPool reads PEM certificates from path into a new pool
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func checkSecret(secret string) error {
+	switch {
+	case secret == "":
+		return fmt.Errorf("must not be empty")
+	case weakSecrets[strings.ToLower(secret)]:
+		return fmt.Errorf("must not be a well-known example secret")
+	case len(secret) < minSecretLength:
+		return fmt.Errorf("must be at least %d characters", minSecretLength)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// loadValid loads the defaults with the minimum environment a valid
+// configuration needs
+func loadValid(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("TACACS_SECRET", "averylongsecret")
+	t.Setenv("ZITADEL_PROJECT_ID", "project-1")
+	t.Setenv("ZITADEL_CLIENT_ID", "client")
+	t.Setenv("ZITADEL_CLIENT_SECRET", "secret")
+	t.Setenv("STORE_BACKEND", "memory")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("base configuration is invalid: %v", err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"empty admin audience", func(c *Config) { c.AdminAudience = "" }, "admin_audience is required"},
+		{"default db password with postgres", func(c *Config) { c.StoreBackend = "postgres" }, "db_password: must not be the default"},
+		{"db password with postgres", func(c *Config) { c.StoreBackend = "postgres"; c.DBPassword = "s3cret-db-pass" }, ""},
+		{"default db password without postgres", func(c *Config) { c.StoreBackend = "sqlite" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadValid(t)
+			tt.modify(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("Validate: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Fatalf("Validate = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDefaultsAdminAudienceToProject(t *testing.T) {
+	cfg := loadValid(t)
+	if cfg.AdminAudience != "project-1" {
+		t.Errorf("AdminAudience = %q, want the Zitadel project ID", cfg.AdminAudience)
+	}
+}
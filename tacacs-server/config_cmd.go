@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"tacacs-zitadel-server/config"
+)
+
+const configUsage = `Usage: tacacs-server config validate [flags]
+
+  validate  load the configuration file and environment and report every problem
+`
+
+// runConfig implements the config subcommand and returns the process exit code
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "configuration is invalid:")
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			for _, e := range joined.Unwrap() {
+				fmt.Fprintf(os.Stderr, "  - %v\n", e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "  - %v\n", err)
+		}
+		return 1
+	}
+
+	fmt.Printf("configuration is valid: %d listener(s), %d client(s), %d policy(ies)\n",
+		len(cfg.Listeners), len(cfg.Clients), len(cfg.Policies))
+	return 0
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"tacacs-zitadel-server/lockout"
+	"tacacs-zitadel-server/tacacs_tacquito"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionManager exposes the live TACACS+ sessions to the admin API
+type SessionManager interface {
+	ListSessions(filter tacacs_tacquito.SessionFilter) []tacacs_tacquito.Session
+	GetSession(id string) (tacacs_tacquito.Session, error)
+	TerminateSession(ctx context.Context, id string) error
+}
+
+// ConfigReporter exposes the active configuration version to the admin API
+type ConfigReporter interface {
+	ConfigStatus() tacacs_tacquito.ConfigStatus
+}
+
+// LockoutManager exposes brute-force lockouts to the admin API
+type LockoutManager interface {
+	ListLockouts() []lockout.Lockout
+	Unlock(ctx context.Context, key lockout.Key) error
+}
+
+type ConfigResponse struct {
+	Version     string     `json:"version"`
+	Generation  int        `json:"generation"`
+	LoadedAt    time.Time  `json:"loaded_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type SessionResponse struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	NAS       string    `json:"nas"`
+	Roles     []string  `json:"roles"`
+	StartTime time.Time `json:"start_time"`
+	Commands  int       `json:"commands"`
+	Active    bool      `json:"active"`
+	AuthMode  string    `json:"auth_mode"`
+	Provider  string    `json:"provider"`
+}
+
+type CommandResponse struct {
+	Command   string    `json:"command"`
+	Timestamp time.Time `json:"timestamp"`
+	Allowed   bool      `json:"allowed"`
+}
+
+type LockoutResponse struct {
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// AdminHandler serves the session administration endpoints
+type AdminHandler struct {
+	sessions SessionManager
+	configs  ConfigReporter
+	lockouts LockoutManager
+}
+
+func NewAdminHandler(sessions SessionManager, configs ConfigReporter, lockouts LockoutManager) *AdminHandler {
+	return &AdminHandler{sessions: sessions, configs: configs, lockouts: lockouts}
+}
+
+// Register mounts the admin endpoints on router
+func (h *AdminHandler) Register(router *mux.Router) {
+	router.HandleFunc("/sessions", h.ListSessions).Methods("GET")
+	router.HandleFunc("/sessions/{id}", h.GetSession).Methods("GET")
+	router.HandleFunc("/sessions/{id}/commands", h.GetSessionCommands).Methods("GET")
+	router.HandleFunc("/sessions/{id}", h.TerminateSession).Methods("DELETE")
+	router.HandleFunc("/config", h.GetConfig).Methods("GET")
+	router.HandleFunc("/lockouts", h.ListLockouts).Methods("GET")
+	router.HandleFunc("/lockouts/{scope}/{key:.+}", h.Unlock).Methods("DELETE")
+}
+
+// ListLockouts returns the usernames, NAS and rem_addr values currently locked
+func (h *AdminHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts := h.lockouts.ListLockouts()
+	response := make([]LockoutResponse, 0, len(lockouts))
+	for _, l := range lockouts {
+		response = append(response, LockoutResponse{
+			Scope:       l.Scope,
+			Key:         l.Value,
+			Lockouts:    l.Lockouts,
+			LockedUntil: l.LockedUntil,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Unlock lifts a lockout; scope is user, nas, rem_addr or break_glass
+func (h *AdminHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := lockout.Key{Scope: vars["scope"], Value: vars["key"]}
+	if err := h.lockouts.Unlock(r.Context(), key); err != nil {
+		if errors.Is(err, lockout.ErrNotLocked) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetConfig reports the active configuration version and the last reload error
+func (h *AdminHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	status := h.configs.ConfigStatus()
+	writeJSON(w, http.StatusOK, ConfigResponse{
+		Version:     status.Version,
+		Generation:  status.Generation,
+		LoadedAt:    status.LoadedAt,
+		LastError:   status.LastError,
+		LastErrorAt: status.LastErrorAt,
+	})
+}
+
+func (h *AdminHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sessions := h.sessions.ListSessions(tacacs_tacquito.SessionFilter{
+		Username: query.Get("user"),
+		NAS:      query.Get("nas"),
+		Role:     query.Get("role"),
+	})
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(session))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sessions.GetSession(mux.Vars(r)["id"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSessionResponse(session))
+}
+
+func (h *AdminHandler) GetSessionCommands(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sessions.GetSession(mux.Vars(r)["id"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	response := make([]CommandResponse, 0, len(session.Commands))
+	for _, cmd := range session.Commands {
+		response = append(response, CommandResponse{
+			Command:   cmd.Command,
+			Timestamp: cmd.Timestamp,
+			Allowed:   cmd.Allowed,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) TerminateSession(w http.ResponseWriter, r *http.Request) {
+	if err := h.sessions.TerminateSession(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newSessionResponse(session tacacs_tacquito.Session) SessionResponse {
+	return SessionResponse{
+		ID:        session.ID,
+		Username:  session.Username,
+		NAS:       session.ClientIP,
+		Roles:     session.Roles,
+		StartTime: session.StartTime,
+		Commands:  len(session.Commands),
+		Active:    session.Active,
+		AuthMode:  session.AuthMode,
+		Provider:  session.Provider,
+	}
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, tacacs_tacquito.ErrSessionNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+
+	"github.com/gorilla/mux"
+)
+
+// auditQueryTimeout bounds how long a single audit query may run
+const auditQueryTimeout = 30 * time.Second
+
+type CommandPage struct {
+	Items      []audit.CommandRecord `json:"items"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+type SessionPage struct {
+	Items      []audit.SessionRecord `json:"items"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// AuditHandler serves the audit search endpoints
+type AuditHandler struct {
+	searcher audit.Searcher
+}
+
+func NewAuditHandler(searcher audit.Searcher) *AuditHandler {
+	return &AuditHandler{searcher: searcher}
+}
+
+// Register mounts the audit endpoints on router
+func (h *AuditHandler) Register(router *mux.Router) {
+	router.HandleFunc("/commands", h.SearchCommands).Methods("GET")
+	router.HandleFunc("/sessions", h.SearchSessions).Methods("GET")
+}
+
+func (h *AuditHandler) SearchCommands(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := audit.CommandQuery{
+		Username:      params.Get("user"),
+		NAS:           params.Get("nas"),
+		Contains:      params.Get("command"),
+		Regex:         params.Get("command_regex"),
+		SessionStatus: params.Get("session_status"),
+		Cursor:        params.Get("cursor"),
+	}
+
+	var err error
+	if q.From, q.To, q.Limit, err = parseCommonParams(params); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	switch params.Get("decision") {
+	case "":
+	case "allow":
+		allowed := true
+		q.Allowed = &allowed
+	case "deny":
+		allowed := false
+		q.Allowed = &allowed
+	default:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "decision must be allow or deny"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), auditQueryTimeout)
+	defer cancel()
+
+	page := CommandPage{Items: []audit.CommandRecord{}}
+	page.NextCursor, err = h.searcher.SearchCommands(ctx, q, func(rec audit.CommandRecord) error {
+		page.Items = append(page.Items, rec)
+		return nil
+	})
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	if !wantsCSV(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	rows := make([][]string, 0, len(page.Items))
+	for _, rec := range page.Items {
+		rows = append(rows, []string{
+			strconv.FormatInt(rec.ID, 10),
+			rec.SessionID,
+			rec.Username,
+			rec.NAS,
+			rec.Command,
+			rec.Timestamp.Format(time.RFC3339),
+			strconv.FormatBool(rec.Allowed),
+			rec.SessionStatus,
+		})
+	}
+	writeCSV(w, r, "commands.csv", page.NextCursor,
+		[]string{"id", "session_id", "username", "nas", "command", "timestamp", "allowed", "session_status"}, rows)
+}
+
+func (h *AuditHandler) SearchSessions(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := audit.SessionQuery{
+		Username: params.Get("user"),
+		NAS:      params.Get("nas"),
+		Status:   params.Get("status"),
+		AuthMode: params.Get("auth_mode"),
+		Provider: params.Get("provider"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	var err error
+	if q.From, q.To, q.Limit, err = parseCommonParams(params); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), auditQueryTimeout)
+	defer cancel()
+
+	page := SessionPage{Items: []audit.SessionRecord{}}
+	page.NextCursor, err = h.searcher.SearchSessions(ctx, q, func(rec audit.SessionRecord) error {
+		page.Items = append(page.Items, rec)
+		return nil
+	})
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	if !wantsCSV(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	rows := make([][]string, 0, len(page.Items))
+	for _, rec := range page.Items {
+		endTime := ""
+		if rec.EndTime != nil {
+			endTime = rec.EndTime.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			rec.ID,
+			rec.Username,
+			rec.NAS,
+			rec.StartTime.Format(time.RFC3339),
+			endTime,
+			rec.Status,
+			rec.AuthMode,
+			rec.Provider,
+		})
+	}
+	writeCSV(w, r, "sessions.csv", page.NextCursor,
+		[]string{"id", "username", "nas", "start_time", "end_time", "status", "auth_mode", "provider"}, rows)
+}
+
+func parseCommonParams(params url.Values) (from, to time.Time, limit int, err error) {
+	if v := params.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, 0, fmt.Errorf("from must be an RFC 3339 timestamp")
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, 0, fmt.Errorf("to must be an RFC 3339 timestamp")
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return from, to, 0, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	return from, to, limit, nil
+}
+
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+func writeCSV(w http.ResponseWriter, r *http.Request, filename, nextCursor string, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if nextCursor != "" {
+		next := *r.URL
+		query := next.Query()
+		query.Set("cursor", nextCursor)
+		next.RawQuery = query.Encode()
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	writer.WriteAll(rows)
+}
+
+func writeSearchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, audit.ErrInvalidCursor) || errors.Is(err, audit.ErrInvalidQuery) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeJSON(w, http.StatusGatewayTimeout, ErrorResponse{Error: "query timed out, narrow the filters"})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "audit query failed"})
+}
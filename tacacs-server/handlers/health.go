@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"tacacs-zitadel-server/health"
+
+	"github.com/gorilla/mux"
 )
 
 type HealthResponse struct {
@@ -24,16 +29,41 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func MetricsHandler(w http.ResponseWriter, r *http.Request) {
-	// Simple metrics endpoint
-	metrics := map[string]interface{}{
-		"tacacs_requests_total":     0,
-		"tacacs_auth_success_total": 0,
-		"tacacs_auth_failed_total":  0,
-		"uptime_seconds":           time.Now().Unix(),
+// LivenessHandler reports that the process is running without checking dependencies
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{
+		Status:    "alive",
+		Timestamp: time.Now(),
+		Version:   "1.0.0",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(metrics)
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReadinessHandler reports per-component dependency status and returns 503 when any is down
+func ReadinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Probe results are cached and shared, so a client hanging up must not cancel them
+		report := checker.Check(context.WithoutCancel(r.Context()))
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// RegisterHealth serves liveness on public, for load balancers and
+// orchestrators, and readiness on protected: its report names the database
+// and identity provider hosts and carries their error text
+func RegisterHealth(public, protected *mux.Router, checker *health.Checker) {
+	public.HandleFunc("/health", HealthHandler).Methods("GET")
+	public.HandleFunc("/livez", LivenessHandler).Methods("GET")
+	protected.HandleFunc("/readyz", ReadinessHandler(checker)).Methods("GET")
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/health"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOnlyLivenessIsPublic(t *testing.T) {
+	validator, sign := newTestValidator(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	checker := health.NewChecker(time.Minute, time.Second)
+	checker.Register("database", func(context.Context) error {
+		return errors.New("dial tcp db.internal:5432: connection refused")
+	})
+	router := mux.NewRouter()
+	protected := router.NewRoute().Subrouter()
+	protected.Use(RequireRoles(validator, "tacacs-admin", "tacacs-auditor", logger))
+	RegisterHealth(router, protected, checker)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"liveness", "/livez", "", http.StatusOK},
+		{"legacy health", "/health", "", http.StatusOK},
+		{"readiness without a token", "/readyz", "", http.StatusUnauthorized},
+		{"readiness without a role", "/readyz", "Bearer " + sign([]string{"network-admin"}, testAudience), http.StatusForbidden},
+		{"readiness for an auditor", "/readyz", "Bearer " + sign([]string{"tacacs-auditor"}, testAudience), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if leaked := strings.Contains(rec.Body.String(), "db.internal"); leaked != (tt.want == http.StatusServiceUnavailable) {
+				t.Errorf("probe error in the response = %v: %s", leaked, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadinessHandlerStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"ready", nil, http.StatusOK},
+		{"not ready", errors.New("connection refused"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(time.Minute, time.Second)
+			checker.Register("database", func(context.Context) error { return tt.err })
+
+			rec := httptest.NewRecorder()
+			ReadinessHandler(checker)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			var report health.Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatalf("decoding report: %v", err)
+			}
+			if report.Ready() != (tt.want == http.StatusOK) {
+				t.Errorf("report status %q with HTTP %d", report.Status, rec.Code)
+			}
+			if _, ok := report.Components["database"]; !ok {
+				t.Error("report lacks the database component")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"tacacs-zitadel-server/auth"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type claimsContextKey struct{}
+
+// TokenValidator verifies bearer tokens presented to the HTTP API
+type TokenValidator interface {
+	Validate(ctx context.Context, raw string) (*auth.TokenClaims, error)
+}
+
+// RequireRoles authenticates requests with a bearer token and authorizes them
+// by role: read-only methods need auditorRole or adminRole, everything else
+// needs adminRole
+func RequireRoles(validator TokenValidator, adminRole, auditorRole string, logger *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="tacacs-admin"`)
+				writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "missing bearer token"})
+				return
+			}
+
+			claims, err := validator.Validate(r.Context(), strings.TrimPrefix(header, "Bearer "))
+			if err != nil {
+				logger.WithError(err).WithField("path", r.URL.Path).Warn("Rejected admin API token")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="tacacs-admin", error="invalid_token"`)
+				writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "invalid token"})
+				return
+			}
+
+			allowed := claims.HasRole(adminRole)
+			if !allowed && isReadOnly(r.Method) {
+				allowed = claims.HasRole(auditorRole)
+			}
+			if !allowed {
+				logger.WithFields(logrus.Fields{
+					"subject": claims.Subject,
+					"method":  r.Method,
+					"path":    r.URL.Path,
+				}).Warn("Admin API access denied")
+				writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "insufficient role"})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClaimsFromContext returns the token claims attached by RequireRoles
+func ClaimsFromContext(ctx context.Context) (*auth.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*auth.TokenClaims)
+	return claims, ok
+}
+
+func isReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testIssuer   = "https://zitadel.test"
+	testAudience = "project-1"
+)
+
+func newTestValidator(t *testing.T) (*auth.TokenValidator, func(roles []string, aud string) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	validator := auth.NewTokenValidator(auth.NewJWKS(jwks.URL, jwks.Client()), testIssuer, testAudience, []string{"roles"})
+	sign := func(roles []string, aud string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   testIssuer,
+			"aud":   aud,
+			"sub":   "user-1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": roles,
+		})
+		token.Header["kid"] = "k1"
+		raw, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return raw
+	}
+	return validator, sign
+}
+
+func TestRequireRoles(t *testing.T) {
+	validator, sign := newTestValidator(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := mux.NewRouter()
+	router.Use(RequireRoles(validator, "tacacs-admin", "tacacs-auditor", logger))
+	router.HandleFunc("/admin/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ClaimsFromContext(r.Context()); !ok {
+			t.Error("claims missing from the request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		want   int
+	}{
+		{"no token", http.MethodGet, "", http.StatusUnauthorized},
+		{"not a bearer token", http.MethodGet, "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized},
+		{"malformed token", http.MethodGet, "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"wrong audience", http.MethodGet, "Bearer " + sign([]string{"tacacs-admin"}, "other"), http.StatusUnauthorized},
+		{"admin reads", http.MethodGet, "Bearer " + sign([]string{"tacacs-admin"}, testAudience), http.StatusOK},
+		{"admin changes", http.MethodDelete, "Bearer " + sign([]string{"tacacs-admin"}, testAudience), http.StatusOK},
+		{"auditor reads", http.MethodGet, "Bearer " + sign([]string{"tacacs-auditor"}, testAudience), http.StatusOK},
+		{"auditor changes", http.MethodDelete, "Bearer " + sign([]string{"tacacs-auditor"}, testAudience), http.StatusForbidden},
+		{"missing role", http.MethodGet, "Bearer " + sign([]string{"network-admin"}, testAudience), http.StatusForbidden},
+		{"no roles", http.MethodGet, "Bearer " + sign(nil, testAudience), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/sessions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Probe checks a single dependency and returns an error if it is unavailable
+type Probe func(ctx context.Context) error
+
+// ComponentStatus is the cached result of a single probe
+type ComponentStatus struct {
+	Status    string    `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the aggregated readiness state of all registered probes
+type Report struct {
+	Status     string                     `json:"status"`
+	Timestamp  time.Time                  `json:"timestamp"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ready reports whether every component is up
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+type namedProbe struct {
+	name  string
+	probe Probe
+}
+
+// Checker runs registered probes and caches their results so frequent
+// load balancer polls do not hammer the dependencies
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+	probes  []namedProbe
+	results map[string]ComponentStatus
+	mutex   sync.Mutex
+}
+
+// NewChecker creates a checker caching results for ttl and bounding each probe by timeout
+func NewChecker(ttl, timeout time.Duration) *Checker {
+	return &Checker{
+		ttl:     ttl,
+		timeout: timeout,
+		results: make(map[string]ComponentStatus),
+	}
+}
+
+// Register adds a named probe to the checker
+func (c *Checker) Register(name string, probe Probe) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.probes = append(c.probes, namedProbe{name: name, probe: probe})
+}
+
+// Check returns the readiness report, re-running probes whose cached result is stale
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	var stale []namedProbe
+	for _, p := range c.probes {
+		if result, ok := c.results[p.name]; !ok || now.Sub(result.CheckedAt) >= c.ttl {
+			stale = append(stale, p)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var resultsMutex sync.Mutex
+	for _, p := range stale {
+		wg.Add(1)
+		go func(p namedProbe) {
+			defer wg.Done()
+			result := c.run(ctx, p.probe)
+			resultsMutex.Lock()
+			c.results[p.name] = result
+			resultsMutex.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:     StatusReady,
+		Timestamp:  now,
+		Components: make(map[string]ComponentStatus, len(c.probes)),
+	}
+	for _, p := range c.probes {
+		result := c.results[p.name]
+		report.Components[p.name] = result
+		if result.Status != StatusUp {
+			report.Status = StatusNotReady
+		}
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, probe Probe) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := probe(ctx)
+	result := ComponentStatus{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
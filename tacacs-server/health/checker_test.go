@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func up(context.Context) error { return nil }
+
+func TestCheckCachesWithinTTL(t *testing.T) {
+	c := NewChecker(50*time.Millisecond, time.Second)
+	var calls atomic.Int32
+	c.Register("database", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	ctx := context.Background()
+	first := c.Check(ctx)
+	second := c.Check(ctx)
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("probe ran %d times within the TTL, want 1", n)
+	}
+	if !second.Components["database"].CheckedAt.Equal(first.Components["database"].CheckedAt) {
+		t.Error("second report does not carry the cached result")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	c.Check(ctx)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("probe ran %d times after the TTL, want 2", n)
+	}
+}
+
+func TestCheckReportsEachComponent(t *testing.T) {
+	c := NewChecker(time.Minute, time.Second)
+	c.Register("database", func(context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	c.Register("zitadel", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	report := c.Check(context.Background())
+	if len(report.Components) != 2 {
+		t.Fatalf("report has %d components, want 2", len(report.Components))
+	}
+
+	database := report.Components["database"]
+	if database.Status != StatusUp || database.Error != "" {
+		t.Errorf("database = %+v, want up without error", database)
+	}
+	if database.LatencyMS < 10 {
+		t.Errorf("database latency %vms, want at least the 10ms the probe took", database.LatencyMS)
+	}
+
+	zitadel := report.Components["zitadel"]
+	if zitadel.Status != StatusDown || zitadel.Error != "connection refused" {
+		t.Errorf("zitadel = %+v, want down with the probe error", zitadel)
+	}
+}
+
+func TestCheckNotReadyWhenAnyProbeFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		probes map[string]Probe
+		want   string
+	}{
+		{"all up", map[string]Probe{"database": up, "zitadel": up}, StatusReady},
+		{"one down", map[string]Probe{"database": up, "zitadel": func(context.Context) error {
+			return errors.New("503")
+		}}, StatusNotReady},
+		{"no probes", nil, StatusReady},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Minute, time.Second)
+			for name, probe := range tt.probes {
+				c.Register(name, probe)
+			}
+			report := c.Check(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("status = %q, want %q", report.Status, tt.want)
+			}
+			if report.Ready() != (tt.want == StatusReady) {
+				t.Errorf("Ready() = %v with status %q", report.Ready(), report.Status)
+			}
+		})
+	}
+}
+
+func TestCheckBoundsProbesByTimeout(t *testing.T) {
+	c := NewChecker(time.Minute, 20*time.Millisecond)
+	c.Register("hanging", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := c.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Check took %v, want the probe cut off by the timeout", elapsed)
+	}
+	if result := report.Components["hanging"]; result.Status != StatusDown {
+		t.Errorf("hanging probe = %+v, want down", result)
+	}
+}
@@ -0,0 +1,116 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxResponseSize bounds the provider responses buffered in memory
+const MaxResponseSize = 1 << 20
+
+// probeKey marks the context of a readiness probe, whose calls bypass the
+// circuit breaker: an open circuit does not hide whether the provider is
+// back, and probes neither take the half-open trial call nor count as
+// failures
+type probeKey struct{}
+
+// WithProbe marks ctx as belonging to a readiness probe
+func WithProbe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+// Upstream sends the requests of one identity provider client
+type Upstream struct {
+	// Name prefixes the span of every call
+	Name    string
+	Client  *http.Client
+	Breaker *circuit.Breaker
+	// Observe records the latency and status code of a call, with "error"
+	// when no HTTP response was received
+	Observe func(endpoint, code string, start time.Time)
+	// Refused counts a call failed fast by the open breaker
+	Refused func(endpoint string)
+}
+
+// Do executes one HTTP request inside a client span. The call is guarded by
+// the circuit breaker, unless it is a readiness probe, and bounded by
+// timeout, which covers reading the body, so the body is buffered before
+// returning. Transport errors, 429 and 5xx responses count against the
+// breaker and are returned as auth.ErrUnavailable.
+func (u *Upstream) Do(req *http.Request, endpoint string, timeout time.Duration) (*http.Response, error) {
+	guarded := req.Context().Value(probeKey{}) == nil
+	if guarded {
+		if err := u.Breaker.Allow(); err != nil {
+			u.Refused(endpoint)
+			return nil, fmt.Errorf("%w: %w", auth.ErrUnavailable, err)
+		}
+	}
+
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	ctx, span := tracing.Tracer().Start(ctx, u.Name+" "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+		),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := u.Client.Do(req)
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+		resp.Body.Close()
+	}
+	if err != nil {
+		u.Observe(endpoint, "error", start)
+		tracing.RecordError(span, err)
+		switch {
+		case !guarded:
+		case parent.Err() != nil:
+			u.Breaker.Abandon()
+		default:
+			u.Breaker.Failure()
+		}
+		return nil, fmt.Errorf("%w: %w", auth.ErrUnavailable, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	u.Observe(endpoint, strconv.Itoa(resp.StatusCode), start)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		if guarded {
+			u.Breaker.Failure()
+		}
+		return nil, fmt.Errorf("%w: %s request failed with status: %d", auth.ErrUnavailable, endpoint, resp.StatusCode)
+	}
+	if guarded {
+		u.Breaker.Success()
+	}
+	return resp, nil
+}
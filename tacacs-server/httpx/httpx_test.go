@@ -0,0 +1,79 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+)
+
+func newTestUpstream(t *testing.T, status int) (*Upstream, string, *[]string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	var codes []string
+	upstream := &Upstream{
+		Name:    "test",
+		Client:  server.Client(),
+		Breaker: circuit.NewBreaker("httpx_test", 1, time.Minute),
+		Observe: func(endpoint, code string, start time.Time) { codes = append(codes, code) },
+		Refused: func(endpoint string) { codes = append(codes, "circuit_open") },
+	}
+	return upstream, server.URL, &codes
+}
+
+func TestDoOpensBreakerOnServerError(t *testing.T) {
+	upstream, url, codes := newTestUpstream(t, http.StatusServiceUnavailable)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", url, nil)
+		_, err := upstream.Do(req, "token", time.Second)
+		if !errors.Is(err, auth.ErrUnavailable) {
+			t.Fatalf("call %d: expected ErrUnavailable, got %v", i, err)
+		}
+	}
+	if upstream.Breaker.State() != circuit.Open {
+		t.Fatalf("expected open breaker, got %s", upstream.Breaker.State())
+	}
+	if len(*codes) != 2 || (*codes)[0] != "503" || (*codes)[1] != "circuit_open" {
+		t.Fatalf("unexpected observed codes: %v", *codes)
+	}
+}
+
+func TestDoProbeBypassesBreaker(t *testing.T) {
+	upstream, url, _ := newTestUpstream(t, http.StatusOK)
+	upstream.Breaker.Failure()
+
+	req, _ := http.NewRequestWithContext(WithProbe(context.Background()), "GET", url, nil)
+	resp, err := upstream.Do(req, "discovery", time.Second)
+	if err != nil {
+		t.Fatalf("probe refused by open breaker: %v", err)
+	}
+	resp.Body.Close()
+	if upstream.Breaker.State() != circuit.Open {
+		t.Fatalf("probe changed breaker state to %s", upstream.Breaker.State())
+	}
+}
+
+func TestDoAbandonsCancelledCall(t *testing.T) {
+	upstream, url, _ := newTestUpstream(t, http.StatusOK)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if _, err := upstream.Do(req, "token", time.Second); err == nil {
+		t.Fatal("expected error for cancelled call")
+	}
+	if upstream.Breaker.State() != circuit.Closed {
+		t.Fatalf("cancelled call counted as failure: breaker %s", upstream.Breaker.State())
+	}
+}
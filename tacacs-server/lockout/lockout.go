@@ -0,0 +1,220 @@
+package lockout
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/metrics"
+)
+
+// Scopes failed logins are counted in
+const (
+	ScopeUser    = "user"
+	ScopeNAS     = "nas"
+	ScopeRemAddr = "rem_addr"
+	// ScopeBreakGlass counts a break-glass username per NAS and rem_addr
+	// with the user threshold
+	ScopeBreakGlass = "break_glass"
+)
+
+// ErrNotLocked is returned when unlocking a key that is not locked
+var ErrNotLocked = errors.New("not locked")
+
+// Key identifies what failures are counted against, such as a username
+type Key struct {
+	Scope string
+	Value string
+}
+
+// Lockout describes a locked key
+type Lockout struct {
+	Key
+	// Lockouts is the number of consecutive lockouts that set the current duration
+	Lockouts    int
+	LockedUntil time.Time
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockouts    int
+	lockedUntil time.Time
+}
+
+// Tracker counts failed logins per key and locks keys that reach their
+// threshold within the window. Each repeated lockout of a key doubles its
+// duration up to the maximum; a key that stays quiet for a window after its
+// lockout expires starts over.
+type Tracker struct {
+	mutex   sync.Mutex
+	config  config.LockoutConfig
+	entries map[Key]*entry
+	now     func() time.Time
+}
+
+func NewTracker(cfg config.LockoutConfig) *Tracker {
+	return &Tracker{
+		config:  cfg,
+		entries: make(map[Key]*entry),
+		now:     time.Now,
+	}
+}
+
+// Configure replaces the thresholds and durations; counted failures and
+// lockouts in force are kept
+func (t *Tracker) Configure(cfg config.LockoutConfig) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.config = cfg
+}
+
+func (t *Tracker) threshold(scope string) int {
+	if !t.config.Enabled {
+		return 0
+	}
+	switch scope {
+	case ScopeUser, ScopeBreakGlass:
+		return t.config.UserThreshold
+	case ScopeNAS:
+		return t.config.NASThreshold
+	case ScopeRemAddr:
+		return t.config.RemAddrThreshold
+	}
+	return 0
+}
+
+// Check returns the first of keys that is locked and how long it stays locked
+func (t *Tracker) Check(keys ...Key) (Key, time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	for _, key := range keys {
+		if t.threshold(key.Scope) == 0 {
+			continue
+		}
+		if e, ok := t.entries[key]; ok && now.Before(e.lockedUntil) {
+			metrics.LockoutRejections.WithLabelValues(key.Scope).Inc()
+			return key, e.lockedUntil.Sub(now), true
+		}
+	}
+	return Key{}, 0, false
+}
+
+// Failure counts a failed login against each key and returns the lockouts it caused
+func (t *Tracker) Failure(keys ...Key) []Lockout {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	window := time.Duration(t.config.Window) * time.Second
+	var locked []Lockout
+	for _, key := range keys {
+		threshold := t.threshold(key.Scope)
+		if threshold == 0 || key.Value == "" {
+			continue
+		}
+		e, ok := t.entries[key]
+		if !ok {
+			e = &entry{}
+			t.entries[key] = e
+		}
+		if now.Sub(e.lastFailure) > window {
+			e.failures = 0
+		}
+		if !e.lockedUntil.IsZero() && now.Sub(e.lockedUntil) > window {
+			e.lockouts = 0
+		}
+		e.failures++
+		e.lastFailure = now
+		if e.failures < threshold {
+			continue
+		}
+
+		e.failures = 0
+		e.lockouts++
+		e.lockedUntil = now.Add(t.duration(e.lockouts))
+		metrics.Lockouts.WithLabelValues(key.Scope).Inc()
+		locked = append(locked, Lockout{Key: key, Lockouts: e.lockouts, LockedUntil: e.lockedUntil})
+	}
+	return locked
+}
+
+// duration is the base duration doubled for every lockout after the first, capped at the maximum
+func (t *Tracker) duration(lockouts int) time.Duration {
+	base := time.Duration(t.config.BaseDuration) * time.Second
+	max := time.Duration(t.config.MaxDuration) * time.Second
+	d := base
+	for i := 1; i < lockouts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Success forgets the failures counted against keys after a successful login
+func (t *Tracker) Success(keys ...Key) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	for _, key := range keys {
+		if e, ok := t.entries[key]; ok && !now.Before(e.lockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// List returns the keys currently locked, the longest remaining first
+func (t *Tracker) List() []Lockout {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	result := []Lockout{}
+	for key, e := range t.entries {
+		if now.Before(e.lockedUntil) {
+			result = append(result, Lockout{Key: key, Lockouts: e.lockouts, LockedUntil: e.lockedUntil})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LockedUntil.After(result[j].LockedUntil)
+	})
+	return result
+}
+
+// Unlock lifts the lockout of a key and resets its back-off
+func (t *Tracker) Unlock(key Key) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok || !t.now().Before(e.lockedUntil) {
+		return ErrNotLocked
+	}
+	delete(t.entries, key)
+	return nil
+}
+
+// Prune drops keys with no recent failures and no lockout in force or to remember
+func (t *Tracker) Prune() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	window := time.Duration(t.config.Window) * time.Second
+	for key, e := range t.entries {
+		last := e.lastFailure
+		if e.lockedUntil.After(last) {
+			last = e.lockedUntil
+		}
+		if now.Sub(last) > window {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -1,78 +1,53 @@
 package main
 
 import (
-	"context"
-	"net/http"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"tacacs-zitadel-server/config"
-	"tacacs-zitadel-server/handlers"
-	"tacacs-zitadel-server/tacacs_tacquito"
-
-	"github.com/gorilla/mux"
-	"github.com/sirupsen/logrus"
+	"strings"
 )
 
-func main() {
-	cfg := config.Load()
-	
-	logger := logrus.New()
-	level, err := logrus.ParseLevel(cfg.LogLevel)
-	if err != nil {
-		level = logrus.InfoLevel
-	}
-	logger.SetLevel(level)
-	logger.SetFormatter(&logrus.JSONFormatter{})
-
-	logger.Info("Starting TACACS+ server with Zitadel integration")
-
-	tacacsServer, err := tacacs_tacquito.NewTacacsServer(cfg, logger)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to create TACACS+ server")
-	}
+const usage = `Usage: tacacs-server <command> [arguments]
 
-	router := mux.NewRouter()
-	router.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
-	router.HandleFunc("/metrics", handlers.MetricsHandler).Methods("GET")
+Commands:
+  serve          run the TACACS+ and HTTP servers (default)
+  migrate        apply, roll back or list database schema migrations
+  config         validate the configuration
+  policy         test which privilege level and commands roles are granted
+  sessions       list or terminate live sessions through the admin API
+  audit          export recorded sessions and commands from the database
+  check-zitadel  verify the Zitadel credentials and list the project roles
+  break-glass    hash a password for an emergency local account
 
-	httpServer := &http.Server{
-		Addr:    cfg.HTTPListenAddress,
-		Handler: router,
-	}
+Run "tacacs-server <command> -h" for the flags of a command.
+`
 
-	go func() {
-		logger.WithField("address", cfg.HTTPListenAddress).Info("Starting HTTP server")
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.WithError(err).Fatal("HTTP server failed")
-		}
-	}()
-
-	go func() {
-		logger.WithField("address", cfg.TACACSListenAddress).Info("Starting TACACS+ server")
-		if err := tacacsServer.Start(); err != nil {
-			logger.WithError(err).Fatal("TACACS+ server failed")
-		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Info("Shutting down servers...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := httpServer.Shutdown(ctx); err != nil {
-		logger.WithError(err).Error("HTTP server shutdown error")
+func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	if err := tacacsServer.Stop(); err != nil {
-		logger.WithError(err).Error("TACACS+ server shutdown error")
+	switch command {
+	case "serve":
+		os.Exit(runServe(args))
+	case "migrate":
+		os.Exit(runMigrate(args))
+	case "config":
+		os.Exit(runConfig(args))
+	case "policy":
+		os.Exit(runPolicy(args))
+	case "sessions":
+		os.Exit(runSessions(args))
+	case "audit":
+		os.Exit(runAudit(args))
+	case "check-zitadel":
+		os.Exit(runCheckZitadel(args))
+	case "break-glass":
+		os.Exit(runBreakGlass(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
-
-	logger.Info("Servers shut down successfully")
-}
\ No newline at end of file
+}
@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tacacs"
+
+// Registry holds every collector exported by the server
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Authentications counts authentication attempts by result and authen type
+	Authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authentications_total",
+		Help:      "TACACS+ authentication attempts by result and authentication type.",
+	}, []string{"result", "authen_type"})
+
+	// Authorizations counts authorization decisions by decision and the
+	// policy that decided them, "none" when no policy matched
+	Authorizations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authorizations_total",
+		Help:      "TACACS+ authorization decisions by decision and deciding policy.",
+	}, []string{"decision", "policy"})
+
+	// AccountingRecords counts accounting records by flag
+	AccountingRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accounting_records_total",
+		Help:      "TACACS+ accounting records by flag.",
+	}, []string{"flag"})
+
+	// Requests counts TACACS+ packets per configured client and packet type.
+	// NAS without a client share the "unknown" client, which keeps the label
+	// bounded whatever addresses connect.
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "TACACS+ requests by configured client and packet type.",
+	}, []string{"client", "type"})
+
+	// Connections counts NAS connections by transport (legacy or tls) and result
+	Connections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_total",
+		Help:      "TACACS+ connections by transport and result: accepted, refused, handshake_failed, proxy_error or protocol_error.",
+	}, []string{"transport", "result"})
+
+	// ActiveSessions is the number of sessions currently held in memory
+	ActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Number of active TACACS+ sessions.",
+	})
+
+	// CacheLookups counts cache lookups by cache name and result (hit or miss)
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by cache and result; hit ratio is hit / (hit + miss).",
+	}, []string{"cache", "result"})
+
+	// ZitadelRequestDuration observes latency of HTTP calls to Zitadel
+	ZitadelRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "zitadel",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests to Zitadel by endpoint.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"endpoint"})
+
+	// ZitadelRequests counts HTTP calls to Zitadel by endpoint and status code
+	ZitadelRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "zitadel",
+		Name:      "requests_total",
+		Help:      "HTTP requests to Zitadel by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	// OIDCRequestDuration observes latency of HTTP calls to the generic OIDC provider
+	OIDCRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "oidc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests to the OIDC provider by endpoint.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"endpoint"})
+
+	// OIDCRequests counts HTTP calls to the generic OIDC provider by endpoint and status code
+	OIDCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oidc",
+		Name:      "requests_total",
+		Help:      "HTTP requests to the OIDC provider by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	// ZitadelInflight is the number of authentications waiting on Zitadel
+	ZitadelInflight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "zitadel",
+		Name:      "inflight_calls",
+		Help:      "Authentications currently waiting on Zitadel.",
+	})
+
+	// CircuitState is the state of a circuit breaker: 0 closed, 1 half-open, 2 open
+	CircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "circuit",
+		Name:      "state",
+		Help:      "Circuit breaker state by dependency: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+
+	// CircuitTransitions counts circuit breaker state changes by the state entered
+	CircuitTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "circuit",
+		Name:      "transitions_total",
+		Help:      "Circuit breaker state changes by dependency and state entered.",
+	}, []string{"name", "state"})
+
+	// LimitRejections counts requests refused by a rate limit or concurrency cap
+	LimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "limit_rejections_total",
+		Help:      "Requests refused by limit (global, nas, zitadel_concurrency, sessions or user_sessions) and packet type.",
+	}, []string{"limit", "type"})
+
+	// AuditQueueDepth is the number of audit writes waiting for the batch writer
+	AuditQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "queue_depth",
+		Help:      "Audit writes queued in memory awaiting a database batch.",
+	})
+
+	// AuditQueueCapacity is the configured size of the audit write queue
+	AuditQueueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "queue_capacity",
+		Help:      "Maximum number of audit writes held in memory.",
+	})
+
+	// AuditSpoolBytes is the size of the on-disk spool awaiting replay
+	AuditSpoolBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "spool_bytes",
+		Help:      "Size of the on-disk audit spool awaiting replay.",
+	})
+
+	// AuditRecords counts audit writes by outcome
+	AuditRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "records_total",
+		Help:      "Audit writes by result: written, spooled, replayed, rejected or dropped.",
+	}, []string{"result"})
+
+	// RetentionRows counts rows removed by the retention job by table and
+	// whether they were archived first
+	RetentionRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "retention",
+		Name:      "rows_total",
+		Help:      "Rows expired by the retention job by table and action (archived or deleted).",
+	}, []string{"table", "action"})
+
+	// Lockouts counts keys locked after repeated failed logins by scope
+	Lockouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lockout",
+		Name:      "lockouts_total",
+		Help:      "Lockouts after repeated failed logins by scope: user, nas or rem_addr.",
+	}, []string{"scope"})
+
+	// LockoutRejections counts logins refused without checking the password because a key was locked
+	LockoutRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lockout",
+		Name:      "rejections_total",
+		Help:      "Logins refused during a lockout by the scope that was locked.",
+	}, []string{"scope"})
+
+	// ProviderAuthentications counts answers of each provider in the authentication chain
+	ProviderAuthentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "authentications_total",
+		Help:      "Authentications by provider and result: pass, fail or unavailable.",
+	}, []string{"provider", "result"})
+
+	// BreakGlassLogins counts login attempts with break-glass accounts by result (pass or fail)
+	BreakGlassLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "break_glass",
+		Name:      "logins_total",
+		Help:      "Login attempts with break-glass accounts by result: pass or fail.",
+	}, []string{"result"})
+
+	// ConfigReloads counts configuration reloads by result (success or error)
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Configuration reloads by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Authentications,
+		Authorizations,
+		AccountingRecords,
+		Requests,
+		Connections,
+		ActiveSessions,
+		CacheLookups,
+		ZitadelRequestDuration,
+		ZitadelRequests,
+		ZitadelInflight,
+		OIDCRequestDuration,
+		OIDCRequests,
+		CircuitState,
+		CircuitTransitions,
+		LimitRejections,
+		AuditQueueDepth,
+		AuditQueueCapacity,
+		AuditSpoolBytes,
+		AuditRecords,
+		RetentionRows,
+		Lockouts,
+		LockoutRejections,
+		ProviderAuthentications,
+		BreakGlassLogins,
+		ConfigReloads,
+	)
+}
+
+// Handler returns the Prometheus exposition handler for Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// CacheHit records a lookup result for the named cache
+func CacheHit(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveZitadel records the latency and status code of a Zitadel call.
+// A code of "error" is used when no HTTP response was received.
+func ObserveZitadel(endpoint, code string, start time.Time) {
+	ZitadelRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	ZitadelRequests.WithLabelValues(endpoint, code).Inc()
+}
+
+// ObserveOIDC records the latency and status code of a call to the generic
+// OIDC provider, with "error" when no HTTP response was received
+func ObserveOIDC(endpoint, code string, start time.Time) {
+	OIDCRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	OIDCRequests.WithLabelValues(endpoint, code).Inc()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/store"
+)
+
+const migrateUsage = `Usage: tacacs-server migrate [up|down|status] [flags]
+
+  up      apply pending migrations (default)
+  down    roll back applied migrations
+  status  list migrations and when they were applied
+`
+
+// runMigrate implements the migrate subcommand and returns the process exit code
+func runMigrate(args []string) int {
+	action := "up"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	target := fs.Int("to", 0, "up: migrate to this version instead of the latest")
+	steps := fs.Int("steps", 1, "down: number of migrations to roll back")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+
+	migrator, err := store.OpenMigrator(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		err = migrator.Up(ctx, *target)
+	case "down":
+		err = migrator.Down(ctx, *steps)
+	case "status":
+		err = printMigrationStatus(ctx, migrator)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", action, err)
+		return 1
+	}
+
+	if action != "status" {
+		current, err := migrator.Current(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 1
+		}
+		fmt.Printf("schema version %d (latest %d)\n", current, migrator.Latest())
+	}
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, migrator *store.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,229 @@
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrNotCached is returned for users without an online login within the window
+	ErrNotCached = errors.New("no recent online login")
+	// ErrMismatch is returned when the password is not the one last accepted online
+	ErrMismatch = errors.New("password does not match the last online login")
+)
+
+const (
+	// hashCost makes every guess against a copied cache file expensive
+	hashCost = bcrypt.DefaultCost + 2
+	// queueSize bounds the online logins waiting to be hashed
+	queueSize = 256
+)
+
+// Entry is what is kept about a user between online logins
+type Entry struct {
+	Hash       string    `json:"hash"`
+	Roles      []string  `json:"roles"`
+	Provider   string    `json:"provider,omitempty"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+type update struct {
+	username string
+	password string
+	provider string
+	roles    []string
+	at       time.Time
+}
+
+// Cache remembers the credentials and roles of users who logged in through
+// the auth provider so they can be checked while it is unreachable. Entries
+// are persisted to a private file rather than the database, which may be
+// down together with the provider. Hashing runs on a background worker so
+// it never delays an online login.
+type Cache struct {
+	path    string
+	errorf  func(format string, args ...interface{})
+	mutex   sync.Mutex
+	entries map[string]Entry
+	closed  bool
+	updates chan update
+	done    chan struct{}
+	now     func() time.Time
+}
+
+// Open loads the cache from path, which need not exist yet; errorf reports
+// failures of the background worker
+func Open(path string, errorf func(format string, args ...interface{})) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		errorf:  errorf,
+		entries: make(map[string]Entry),
+		updates: make(chan update, queueSize),
+		done:    make(chan struct{}),
+		now:     time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read offline cache: %w", err)
+	default:
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			return nil, fmt.Errorf("failed to decode offline cache %s: %w", path, err)
+		}
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// Remember queues the credentials of a successful online login through
+// provider. When the queue is full the user's entry is dropped instead, so a
+// password that has since been changed is never accepted offline.
+func (c *Cache) Remember(username, password, provider string, roles []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.updates <- update{username: username, password: password, provider: provider, roles: roles, at: c.now()}:
+	default:
+		if _, ok := c.entries[username]; ok {
+			delete(c.entries, username)
+			if err := c.save(); err != nil {
+				c.errorf("Failed to save offline cache: %v", err)
+			}
+		}
+	}
+}
+
+// Verify checks password against the last one accepted online for username
+// within maxAge and returns what was remembered of that login
+func (c *Cache) Verify(username, password string, maxAge time.Duration) (Entry, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[username]
+	c.mutex.Unlock()
+
+	if !ok || c.now().Sub(entry.VerifiedAt) > maxAge {
+		return Entry{}, ErrNotCached
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(entry.Hash), []byte(password)); err != nil {
+		return Entry{}, ErrMismatch
+	}
+	return entry, nil
+}
+
+// Prune forgets users whose last online login is older than maxAge
+func (c *Cache) Prune(maxAge time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cutoff := c.now().Add(-maxAge)
+	pruned := false
+	for username, entry := range c.entries {
+		if entry.VerifiedAt.Before(cutoff) {
+			delete(c.entries, username)
+			pruned = true
+		}
+	}
+	if !pruned {
+		return nil
+	}
+	return c.save()
+}
+
+// Close stops accepting logins and waits until the queued ones are saved
+func (c *Cache) Close() {
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.updates)
+	}
+	c.mutex.Unlock()
+	<-c.done
+}
+
+func (c *Cache) run() {
+	defer close(c.done)
+	for u := range c.updates {
+		c.apply(u)
+		// Save once for every login that queued up during the hashing
+	drain:
+		for {
+			select {
+			case next, ok := <-c.updates:
+				if !ok {
+					break drain
+				}
+				c.apply(next)
+			default:
+				break drain
+			}
+		}
+
+		c.mutex.Lock()
+		err := c.save()
+		c.mutex.Unlock()
+		if err != nil {
+			c.errorf("Failed to save offline cache: %v", err)
+		}
+	}
+}
+
+func (c *Cache) apply(u update) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.password), hashCost)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		delete(c.entries, u.username)
+		c.errorf("Failed to hash offline credentials of %s: %v", u.username, err)
+		return
+	}
+	c.entries[u.username] = Entry{Hash: string(hash), Roles: u.roles, Provider: u.provider, VerifiedAt: u.at}
+}
+
+// save atomically replaces the cache file; the caller holds the mutex
+func (c *Cache) save() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode offline cache: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create offline cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create offline cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to replace offline cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/httpx"
+	"tacacs-zitadel-server/metrics"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// discoveryTTL is how long a discovery document is used before it is fetched again
+	discoveryTTL = time.Hour
+)
+
+// Discovery is the part of the provider's OpenID configuration the client uses
+type Discovery struct {
+	Issuer           string `json:"issuer"`
+	TokenEndpoint    string `json:"token_endpoint"`
+	UserInfoEndpoint string `json:"userinfo_endpoint"`
+	JWKSURI          string `json:"jwks_uri"`
+
+	// keys verify the tokens of the provider; they are kept across
+	// refreshes of the document while jwks_uri stays the same
+	keys *auth.JWKS
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+type cachedUser struct {
+	info   auth.UserInfo
+	expiry time.Time
+}
+
+// Client authenticates users against a generic OpenID Connect provider
+// with the resource owner password grant. Unlike the Zitadel client it
+// assumes nothing about the provider beyond its discovery document, and
+// reads roles and groups from configurable claim paths.
+type Client struct {
+	upstream    *httpx.Upstream
+	breaker     *circuit.Breaker
+	config      *config.Config
+	logger      *logrus.Logger
+	roleClaim   auth.ClaimPath
+	groupsClaim auth.ClaimPath
+
+	discoveryMutex  sync.Mutex
+	discovery       *Discovery
+	discoveryExpiry time.Time
+
+	cacheMutex sync.RWMutex
+	cache      map[string]*cachedUser
+}
+
+func NewClient(cfg *config.Config, logger *logrus.Logger) (*Client, error) {
+	oc := cfg.Providers.OIDC
+	roleClaim, err := auth.ParseClaimPath(oc.RoleClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse role claim: %w", err)
+	}
+	var groupsClaim auth.ClaimPath
+	if oc.GroupsClaim != "" {
+		if groupsClaim, err = auth.ParseClaimPath(oc.GroupsClaim); err != nil {
+			return nil, fmt.Errorf("failed to parse groups claim: %w", err)
+		}
+	}
+
+	breaker := circuit.NewBreaker("oidc", oc.CircuitBreaker.FailureThreshold, time.Duration(oc.CircuitBreaker.OpenSeconds)*time.Second)
+	return &Client{
+		upstream: &httpx.Upstream{
+			Name: "oidc",
+			// Each call is bounded by the configured timeout in do
+			Client:  &http.Client{},
+			Breaker: breaker,
+			Observe: metrics.ObserveOIDC,
+			Refused: func(endpoint string) {
+				metrics.OIDCRequests.WithLabelValues(endpoint, "circuit_open").Inc()
+			},
+		},
+		breaker:     breaker,
+		config:      cfg,
+		logger:      logger,
+		roleClaim:   roleClaim,
+		groupsClaim: groupsClaim,
+		cache:       make(map[string]*cachedUser),
+	}, nil
+}
+
+func (c *Client) AuthenticateUser(ctx context.Context, username, password string) (*auth.UserInfo, error) {
+	// The cache is keyed by a digest so passwords are not kept in memory
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	cacheKey := string(sum[:])
+
+	c.cacheMutex.RLock()
+	if cached, exists := c.cache[cacheKey]; exists && time.Now().Before(cached.expiry) {
+		c.cacheMutex.RUnlock()
+		metrics.CacheHit("oidc_token", true)
+		info := cached.info
+		return &info, nil
+	}
+	c.cacheMutex.RUnlock()
+	metrics.CacheHit("oidc_token", false)
+
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.authenticateWithPassword(ctx, discovery, username, password)
+	if err != nil {
+		c.logger.WithError(err).WithField("username", username).Debug("Authentication failed")
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	claims, err := c.collectClaims(ctx, discovery, token)
+	if err != nil {
+		c.logger.WithError(err).WithField("username", username).Warn("Failed to get user info")
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	info := auth.UserInfo{Username: username}
+	if preferred, ok := claims.lookup(auth.ClaimPath{"preferred_username"}); ok && len(preferred) == 1 {
+		info.Username = preferred[0]
+	}
+	info.Roles, _ = claims.lookup(c.roleClaim)
+	if c.groupsClaim != nil {
+		info.Groups, _ = claims.lookup(c.groupsClaim)
+	}
+
+	c.cacheMutex.Lock()
+	c.cache[cacheKey] = &cachedUser{
+		info:   info,
+		expiry: time.Now().Add(time.Duration(c.config.TokenCacheTimeout) * time.Second),
+	}
+	c.cacheMutex.Unlock()
+
+	c.logger.WithFields(logrus.Fields{
+		"username": username,
+		"roles":    info.Roles,
+		"groups":   info.Groups,
+	}).Info("User authenticated successfully")
+
+	return &info, nil
+}
+
+// discover returns the provider's discovery document, fetching it again
+// once it is older than discoveryTTL. A provider without a usable document
+// cannot authenticate anyone, so every failure is auth.ErrUnavailable.
+func (c *Client) discover(ctx context.Context) (*Discovery, error) {
+	c.discoveryMutex.Lock()
+	defer c.discoveryMutex.Unlock()
+	if c.discovery != nil && time.Now().Before(c.discoveryExpiry) {
+		return c.discovery, nil
+	}
+
+	discovery, err := c.fetchDiscovery(ctx)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnavailable) {
+			err = fmt.Errorf("%w: %w", auth.ErrUnavailable, err)
+		}
+		return nil, err
+	}
+	if c.discovery != nil && c.discovery.JWKSURI == discovery.JWKSURI {
+		discovery.keys = c.discovery.keys
+	} else {
+		discovery.keys = auth.NewJWKS(discovery.JWKSURI, &http.Client{Timeout: time.Duration(c.config.Providers.OIDC.Timeout) * time.Millisecond})
+	}
+	c.discovery = discovery
+	c.discoveryExpiry = time.Now().Add(discoveryTTL)
+	return discovery, nil
+}
+
+func (c *Client) fetchDiscovery(ctx context.Context) (*Discovery, error) {
+	issuer := strings.TrimSuffix(c.config.Providers.OIDC.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req, "discovery")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery request failed with status: %d", resp.StatusCode)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document names issuer %q instead of %q", discovery.Issuer, issuer)
+	}
+	if discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document has no token_endpoint")
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document has no jwks_uri")
+	}
+	return &discovery, nil
+}
+
+func (c *Client) authenticateWithPassword(ctx context.Context, discovery *Discovery, username, password string) (*TokenResponse, error) {
+	oc := c.config.Providers.OIDC
+
+	data := url.Values{}
+	data.Set("grant_type", "password")
+	data.Set("client_id", oc.ClientID)
+	if oc.ClientSecret != "" {
+		data.Set("client_secret", oc.ClientSecret)
+	}
+	data.Set("username", username)
+	data.Set("password", password)
+	data.Set("scope", strings.Join(append([]string{"openid"}, oc.Scopes...), " "))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", discovery.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req, "token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&oauthErr) == nil && oauthErr.Error != "" {
+			return nil, fmt.Errorf("authentication failed with status: %d (%s: %s)", resp.StatusCode, oauthErr.Error, oauthErr.Description)
+		}
+		return nil, fmt.Errorf("authentication failed with status: %d", resp.StatusCode)
+	}
+
+	var token TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return &token, nil
+}
+
+// claimSources are the claim sets of a login in order of precedence
+type claimSources []map[string]interface{}
+
+// lookup returns the claim at path from the first source that has it
+func (s claimSources) lookup(path auth.ClaimPath) ([]string, bool) {
+	for _, claims := range s {
+		if values, ok := path.Strings(claims); ok {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// collectClaims gathers the claims of the access token, when it is a JWT,
+// and of the ID token, then of userinfo when one of the configured claims
+// is in neither. A token whose signature, issuer or expiry does not check
+// out fails the login rather than being skipped.
+func (c *Client) collectClaims(ctx context.Context, discovery *Discovery, token *TokenResponse) (claimSources, error) {
+	var sources claimSources
+	for _, t := range []struct{ name, raw, audience string }{
+		{"access token", token.AccessToken, ""},
+		{"ID token", token.IDToken, c.config.Providers.OIDC.ClientID},
+	} {
+		claims, err := verifyClaims(ctx, discovery, t.raw, t.audience)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", t.name, err)
+		}
+		if claims != nil {
+			sources = append(sources, claims)
+		}
+	}
+
+	_, hasRoles := sources.lookup(c.roleClaim)
+	hasGroups := c.groupsClaim == nil
+	if !hasGroups {
+		_, hasGroups = sources.lookup(c.groupsClaim)
+	}
+	if (hasRoles && hasGroups) || discovery.UserInfoEndpoint == "" {
+		return sources, nil
+	}
+
+	userInfo, err := c.getUserInfo(ctx, discovery, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return append(sources, userInfo), nil
+}
+
+// verifyClaims returns the claims of a JWT after checking its signature
+// against the provider's keys, its issuer, its expiry and, unless audience
+// is empty, its audience. It returns nil claims for a token that is not a
+// JWT. Keys that cannot be fetched make the provider unavailable.
+func verifyClaims(ctx context.Context, discovery *Discovery, raw, audience string) (map[string]interface{}, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{}); err != nil {
+		// Opaque access tokens are expected from some providers
+		return nil, nil
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(auth.SigningMethods), jwt.WithIssuer(discovery.Issuer)}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.NewParser(opts...).ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := discovery.keys.Key(ctx, kid)
+		if err != nil && !errors.Is(err, auth.ErrUnknownKey) {
+			return nil, fmt.Errorf("%w: %w", auth.ErrUnavailable, err)
+		}
+		return key, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, errors.New("missing expiry")
+	}
+	return claims, nil
+}
+
+func (c *Client) getUserInfo(ctx context.Context, discovery *Discovery, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", discovery.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.do(req, "userinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed with status: %d", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo response: %w", err)
+	}
+
+	return claims, nil
+}
+
+// do executes one HTTP request against the provider, bounded by the
+// configured timeout; see httpx.Upstream.Do
+func (c *Client) do(req *http.Request, endpoint string) (*http.Response, error) {
+	return c.upstream.Do(req, endpoint, time.Duration(c.config.Providers.OIDC.Timeout)*time.Millisecond)
+}
+
+// CheckDiscovery verifies that the provider serves a usable discovery
+// document. It bypasses the circuit breaker, whose state CheckCircuit reports.
+func (c *Client) CheckDiscovery(ctx context.Context) error {
+	_, err := c.fetchDiscovery(httpx.WithProbe(ctx))
+	return err
+}
+
+// CheckCircuit reports an error while the circuit breaker fails OIDC calls fast
+func (c *Client) CheckCircuit(ctx context.Context) error {
+	return c.breaker.Check(ctx)
+}
+
+func (c *Client) CleanupCache() {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	now := time.Now()
+	for key, cached := range c.cache {
+		if now.After(cached.expiry) {
+			delete(c.cache, key)
+		}
+	}
+}
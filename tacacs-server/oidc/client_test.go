@@ -0,0 +1,389 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const testClientID = "tacacs"
+
+// testProvider is a stub OpenID provider serving discovery, the password
+// grant, userinfo and its signing key
+type testProvider struct {
+	*httptest.Server
+	key        *rsa.PrivateKey
+	tokens     func(issuer string) TokenResponse
+	userInfo   map[string]interface{}
+	jwksStatus atomic.Int32
+	userInfos  atomic.Int32
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	p := &testProvider{key: newTestKey(t)}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer := "http://" + r.Host
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":            issuer,
+				"token_endpoint":    issuer + "/token",
+				"userinfo_endpoint": issuer + "/userinfo",
+				"jwks_uri":          issuer + "/jwks",
+			})
+		case "/token":
+			if r.PostFormValue("password") != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid user credentials"})
+				return
+			}
+			json.NewEncoder(w).Encode(p.tokens(issuer))
+		case "/userinfo":
+			p.userInfos.Add(1)
+			json.NewEncoder(w).Encode(p.userInfo)
+		case "/jwks":
+			if status := int(p.jwksStatus.Load()); status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+			b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "key-1", "use": "sig",
+				"n": b64(p.key.N.Bytes()), "e": b64(big.NewInt(int64(p.key.E)).Bytes()),
+			}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return raw
+}
+
+// tokenClaims are valid claims of a token issued by issuer, plus extra
+func tokenClaims(issuer string, extra jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": testClientID,
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+func newTestClient(t *testing.T, issuer, roleClaim, groupsClaim string) *Client {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := &config.Config{TokenCacheTimeout: 60}
+	cfg.Providers.OIDC = config.OIDCConfig{
+		Issuer:         issuer,
+		ClientID:       testClientID,
+		RoleClaim:      roleClaim,
+		GroupsClaim:    groupsClaim,
+		Timeout:        1000,
+		CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 5, OpenSeconds: 60},
+	}
+	client, err := NewClient(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestAuthenticateUserClaims(t *testing.T) {
+	keycloakAccess := jwt.MapClaims{
+		"preferred_username": "alice.smith",
+		"realm_access":       map[string]interface{}{"roles": []string{"network-admin", "offline_access"}},
+		"resource_access": map[string]interface{}{
+			"tacacs": map[string]interface{}{"roles": []string{"tacacs-operator"}},
+		},
+		"urn:zitadel:iam:org:project:roles": map[string]interface{}{"network-viewer": map[string]interface{}{"org": "acme"}},
+	}
+
+	tests := []struct {
+		name         string
+		roleClaim    string
+		groupsClaim  string
+		access       jwt.MapClaims // nil for an opaque access token
+		id           jwt.MapClaims
+		userInfo     map[string]interface{}
+		wantUsername string
+		wantRoles    []string
+		wantGroups   []string
+		wantUserInfo bool
+	}{
+		{
+			name:      "roles from the access token",
+			roleClaim: "realm_access.roles", groupsClaim: "groups",
+			access: keycloakAccess, id: jwt.MapClaims{"groups": []string{"/noc", "/lab"}},
+			wantUsername: "alice.smith", wantRoles: []string{"network-admin", "offline_access"}, wantGroups: []string{"/noc", "/lab"},
+		},
+		{
+			name:         "bracketed client roles",
+			roleClaim:    "$.resource_access['tacacs'].roles",
+			access:       keycloakAccess,
+			wantUsername: "alice.smith", wantRoles: []string{"tacacs-operator"},
+		},
+		{
+			name:         "object keyed by role",
+			roleClaim:    `["urn:zitadel:iam:org:project:roles"]`,
+			access:       keycloakAccess,
+			wantUsername: "alice.smith", wantRoles: []string{"network-viewer"},
+		},
+		{
+			name:      "ID token after an opaque access token",
+			roleClaim: "roles", groupsClaim: "groups",
+			id:           jwt.MapClaims{"roles": "network-admin", "groups": []string{"noc"}},
+			wantUsername: "alice", wantRoles: []string{"network-admin"}, wantGroups: []string{"noc"},
+		},
+		{
+			name:      "claim only in userinfo",
+			roleClaim: "roles", groupsClaim: "groups",
+			access:       jwt.MapClaims{"roles": []string{"network-admin"}},
+			userInfo:     map[string]interface{}{"groups": []string{"noc"}, "roles": []string{"ignored"}},
+			wantUsername: "alice", wantRoles: []string{"network-admin"}, wantGroups: []string{"noc"}, wantUserInfo: true,
+		},
+		{
+			name:         "missing claim",
+			roleClaim:    "realm_access.roles",
+			access:       jwt.MapClaims{"resource_access": map[string]interface{}{}},
+			userInfo:     map[string]interface{}{"sub": "user-1"},
+			wantUsername: "alice", wantUserInfo: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t)
+			provider.userInfo = tt.userInfo
+			provider.tokens = func(issuer string) TokenResponse {
+				token := TokenResponse{AccessToken: "opaque-access-token", TokenType: "Bearer", ExpiresIn: 300}
+				if tt.access != nil {
+					claims := tokenClaims(issuer, tt.access)
+					claims["aud"] = "account"
+					token.AccessToken = sign(t, provider.key, "key-1", claims)
+				}
+				token.IDToken = sign(t, provider.key, "key-1", tokenClaims(issuer, tt.id))
+				return token
+			}
+			client := newTestClient(t, provider.URL, tt.roleClaim, tt.groupsClaim)
+
+			info, err := client.AuthenticateUser(context.Background(), "alice", "password")
+			if err != nil {
+				t.Fatalf("AuthenticateUser: %v", err)
+			}
+			if info.Username != tt.wantUsername ||
+				strings.Join(info.Roles, ",") != strings.Join(tt.wantRoles, ",") ||
+				strings.Join(info.Groups, ",") != strings.Join(tt.wantGroups, ",") {
+				t.Errorf("AuthenticateUser = %q roles %v groups %v, want %q roles %v groups %v",
+					info.Username, info.Roles, info.Groups, tt.wantUsername, tt.wantRoles, tt.wantGroups)
+			}
+			if got := provider.userInfos.Load() > 0; got != tt.wantUserInfo {
+				t.Errorf("userinfo called = %v, want %v", got, tt.wantUserInfo)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUserRejectsBadTokens(t *testing.T) {
+	otherKey := newTestKey(t)
+	tests := []struct {
+		name            string
+		access          func(t *testing.T, p *testProvider, issuer string) string
+		id              func(t *testing.T, p *testProvider, issuer string) string
+		password        string
+		jwksStatus      int
+		wantErr         string
+		wantUnavailable bool
+	}{
+		{
+			name: "bad signature",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, otherKey, "key-1", tokenClaims(issuer, jwt.MapClaims{"roles": []string{"network-admin"}}))
+			},
+			wantErr: "invalid access token",
+		},
+		{
+			name: "ID token with a bad signature",
+			id: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, otherKey, "key-1", tokenClaims(issuer, jwt.MapClaims{"roles": []string{"network-admin"}}))
+			},
+			wantErr: "invalid ID token",
+		},
+		{
+			name: "tampered payload",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				raw := sign(t, p.key, "key-1", tokenClaims(issuer, jwt.MapClaims{"roles": []string{"network-viewer"}}))
+				parts := strings.Split(raw, ".")
+				payload, _ := json.Marshal(tokenClaims(issuer, jwt.MapClaims{"roles": []string{"network-admin"}}))
+				parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+				return strings.Join(parts, ".")
+			},
+			wantErr: "signature is invalid",
+		},
+		{
+			name: "unknown key",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, otherKey, "key-2", tokenClaims(issuer, nil))
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "other issuer",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, p.key, "key-1", tokenClaims("https://evil.example", nil))
+			},
+			wantErr: "invalid issuer",
+		},
+		{
+			name: "ID token for another client",
+			id: func(t *testing.T, p *testProvider, issuer string) string {
+				claims := tokenClaims(issuer, nil)
+				claims["aud"] = "other-client"
+				return sign(t, p.key, "key-1", claims)
+			},
+			wantErr: "invalid audience",
+		},
+		{
+			name: "expired",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, p.key, "key-1", tokenClaims(issuer, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}))
+			},
+			wantErr: "token is expired",
+		},
+		{
+			name: "no expiry",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				claims := tokenClaims(issuer, nil)
+				delete(claims, "exp")
+				return sign(t, p.key, "key-1", claims)
+			},
+			wantErr: "missing expiry",
+		},
+		{
+			name: "keys unavailable",
+			access: func(t *testing.T, p *testProvider, issuer string) string {
+				return sign(t, p.key, "key-1", tokenClaims(issuer, nil))
+			},
+			jwksStatus:      http.StatusServiceUnavailable,
+			wantErr:         "JWKS request failed with status: 503",
+			wantUnavailable: true,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong",
+			wantErr:  "invalid_grant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t)
+			provider.jwksStatus.Store(int32(tt.jwksStatus))
+			provider.tokens = func(issuer string) TokenResponse {
+				token := TokenResponse{AccessToken: "opaque-access-token", TokenType: "Bearer", ExpiresIn: 300}
+				if tt.access != nil {
+					token.AccessToken = tt.access(t, provider, issuer)
+				}
+				if tt.id != nil {
+					token.IDToken = tt.id(t, provider, issuer)
+				}
+				return token
+			}
+			client := newTestClient(t, provider.URL, "roles", "")
+			password := tt.password
+			if password == "" {
+				password = "password"
+			}
+
+			info, err := client.AuthenticateUser(context.Background(), "alice", password)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("AuthenticateUser = %+v, %v, want an error containing %q", info, err, tt.wantErr)
+			}
+			if errors.Is(err, auth.ErrUnavailable) != tt.wantUnavailable {
+				t.Errorf("AuthenticateUser error %v: unavailable = %v, want %v", err, !tt.wantUnavailable, tt.wantUnavailable)
+			}
+			if provider.userInfos.Load() != 0 {
+				t.Error("userinfo was called for a rejected login")
+			}
+		})
+	}
+}
+
+func TestDiscoveryWithoutJWKSIsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer := "http://" + r.Host
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, "roles", "")
+	_, err := client.AuthenticateUser(context.Background(), "alice", "password")
+	if !errors.Is(err, auth.ErrUnavailable) || !strings.Contains(err.Error(), "no jwks_uri") {
+		t.Errorf("AuthenticateUser = %v, want the provider unavailable for lack of jwks_uri", err)
+	}
+	if err := client.CheckDiscovery(context.Background()); err == nil {
+		t.Error("CheckDiscovery accepted a document without jwks_uri")
+	}
+}
+
+func TestCheckDiscoveryBypassesCircuit(t *testing.T) {
+	provider := newTestProvider(t)
+	client := newTestClient(t, provider.URL, "roles", "")
+	for i := 0; i < 5; i++ {
+		client.breaker.Failure()
+	}
+	if err := client.CheckCircuit(context.Background()); err == nil {
+		t.Fatal("circuit not open")
+	}
+
+	if err := client.CheckDiscovery(context.Background()); err != nil {
+		t.Errorf("CheckDiscovery with the circuit open = %v, want the provider's answer", err)
+	}
+	if state := client.breaker.State(); state != circuit.Open {
+		t.Errorf("circuit %s after the probe, want it left open", state)
+	}
+	if _, err := client.AuthenticateUser(context.Background(), "alice", "password"); !errors.Is(err, circuit.ErrOpen) {
+		t.Errorf("AuthenticateUser with the circuit open = %v, want ErrOpen", err)
+	}
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"tacacs-zitadel-server/config"
+)
+
+// anyRole in a policy's roles matches every role
+const anyRole = "*"
+
+type rule struct {
+	name           string
+	roles          map[string]bool
+	privilegeLevel int
+	allow          []*regexp.Regexp
+	deny           []*regexp.Regexp
+}
+
+// Engine maps roles to privilege levels and authorizes commands
+type Engine struct {
+	rules []rule
+}
+
+// New compiles the configured policies
+func New(policies []config.PolicyConfig) (*Engine, error) {
+	e := &Engine{}
+	for i, p := range policies {
+		r := rule{
+			name:           p.Name,
+			roles:          make(map[string]bool),
+			privilegeLevel: p.PrivilegeLevel,
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("policy%d", i)
+		}
+		for _, role := range p.Roles {
+			r.roles[strings.ToLower(role)] = true
+		}
+
+		var err error
+		if r.allow, err = compile(p.Commands); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", r.name, err)
+		}
+		if r.deny, err = compile(p.DenyCommands); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", r.name, err)
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matching returns the rules that apply to any of roles
+func (e *Engine) matching(roles []string) []rule {
+	var matched []rule
+	for _, r := range e.rules {
+		if r.roles[anyRole] {
+			matched = append(matched, r)
+			continue
+		}
+		for _, role := range roles {
+			if r.roles[strings.ToLower(role)] {
+				matched = append(matched, r)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// PrivilegeLevel returns the highest privilege level granted to roles
+func (e *Engine) PrivilegeLevel(roles []string) int {
+	level := 0
+	for _, r := range e.matching(roles) {
+		if r.privilegeLevel > level {
+			level = r.privilegeLevel
+		}
+	}
+	return level
+}
+
+// Decision explains an authorization result
+type Decision struct {
+	Allowed bool
+	// Policy is the policy whose pattern decided the result, empty when nothing matched
+	Policy  string
+	Pattern string
+}
+
+// Authorize decides whether roles may run command. A matching deny pattern
+// in any applicable policy wins over allow patterns.
+func (e *Engine) Authorize(roles []string, command string) Decision {
+	matched := e.matching(roles)
+	for _, r := range matched {
+		for _, re := range r.deny {
+			if re.MatchString(command) {
+				return Decision{Allowed: false, Policy: r.name, Pattern: re.String()}
+			}
+		}
+	}
+	for _, r := range matched {
+		for _, re := range r.allow {
+			if re.MatchString(command) {
+				return Decision{Allowed: true, Policy: r.name, Pattern: re.String()}
+			}
+		}
+	}
+	return Decision{}
+}
+
+// Capped returns a copy of the engine in which policies granting more than
+// maxLevel allow nothing; their deny patterns still apply
+func (e *Engine) Capped(maxLevel int) *Engine {
+	capped := &Engine{rules: make([]rule, 0, len(e.rules))}
+	for _, r := range e.rules {
+		if r.privilegeLevel > maxLevel {
+			r.allow = nil
+			r.privilegeLevel = 0
+		}
+		capped.rules = append(capped.rules, r)
+	}
+	return capped
+}
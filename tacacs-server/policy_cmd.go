@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/policy"
+	"tacacs-zitadel-server/tacacs_tacquito"
+)
+
+const policyUsage = `Usage: tacacs-server policy test -roles <role,...> [flags]
+
+  test  show the privilege level granted to roles and whether commands are allowed
+`
+
+// runPolicy implements the policy subcommand and returns the process exit code
+func runPolicy(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprint(os.Stderr, policyUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, policyUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	roles := fs.String("roles", "", "comma-separated roles of the user")
+	nas := fs.String("nas", "", "NAS address to resolve to a client")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	commands := fs.Args()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "policy: %v\n", err)
+		return 1
+	}
+	engine, err := policy.New(cfg.Policies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "policy: %v\n", err)
+		return 1
+	}
+
+	var userRoles []string
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			userRoles = append(userRoles, role)
+		}
+	}
+
+	if *nas != "" {
+		ip := net.ParseIP(*nas)
+		if ip == nil {
+			fmt.Fprintf(os.Stderr, "policy: invalid NAS address %q\n", *nas)
+			return 2
+		}
+		clients, err := tacacs_tacquito.NewClientRegistry(cfg.Clients, cfg.TACACSSecret)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "policy: %v\n", err)
+			return 1
+		}
+		switch name, _, ok := clients.Lookup(ip); {
+		case !ok:
+			fmt.Printf("client:          none, %s would be refused\n", ip)
+		case name == "":
+			fmt.Println("client:          default (tacacs_secret)")
+		default:
+			fmt.Printf("client:          %s\n", name)
+		}
+	}
+
+	fmt.Printf("roles:           %s\n", strings.Join(userRoles, ", "))
+	fmt.Printf("privilege level: %d\n", engine.PrivilegeLevel(userRoles))
+
+	denied := false
+	for _, command := range commands {
+		decision := engine.Authorize(userRoles, command)
+		switch {
+		case decision.Policy == "":
+			denied = true
+			fmt.Printf("deny   %q: no policy pattern matches\n", command)
+		case decision.Allowed:
+			fmt.Printf("allow  %q: policy %s, pattern %s\n", command, decision.Policy, decision.Pattern)
+		default:
+			denied = true
+			fmt.Printf("deny   %q: policy %s, deny pattern %s\n", command, decision.Policy, decision.Pattern)
+		}
+	}
+	if denied {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/config"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits a packet can exceed
+const (
+	ScopeGlobal = "global"
+	ScopeNAS    = "nas"
+)
+
+// Packet types limits are kept for, matching the requests_total metric labels
+const (
+	Authentication = "authentication"
+	Authorization  = "authorization"
+	Accounting     = "accounting"
+)
+
+type nasKey struct {
+	nas        string
+	packetType string
+}
+
+type nasLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// Limiter applies token buckets per packet type, one shared by all NAS and
+// one for each NAS. A rate of 0 leaves that bucket unlimited.
+type Limiter struct {
+	mutex  sync.Mutex
+	config config.RateLimitsConfig
+	global map[string]*rate.Limiter
+	nas    map[nasKey]*nasLimiter
+}
+
+func NewLimiter(cfg config.RateLimitsConfig) *Limiter {
+	l := &Limiter{
+		global: make(map[string]*rate.Limiter),
+		nas:    make(map[nasKey]*nasLimiter),
+	}
+	l.Configure(cfg)
+	return l
+}
+
+// Configure applies new rates; buckets already in use keep their tokens
+func (l *Limiter) Configure(cfg config.RateLimitsConfig) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.config = cfg
+	for _, packetType := range []string{Authentication, Authorization, Accounting} {
+		r := cfg.Global.For(packetType)
+		if limiter, ok := l.global[packetType]; ok {
+			limiter.SetLimit(limit(r))
+			limiter.SetBurst(r.Burst)
+		} else {
+			l.global[packetType] = rate.NewLimiter(limit(r), r.Burst)
+		}
+	}
+	for key, n := range l.nas {
+		r := cfg.PerNAS.For(key.packetType)
+		n.limiter.SetLimit(limit(r))
+		n.limiter.SetBurst(r.Burst)
+	}
+}
+
+func limit(r config.Rate) rate.Limit {
+	if r.Rate <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(r.Rate)
+}
+
+// Allow takes a token for a packet of packetType from nas and reports
+// whether it is within the limits, or else which limit it exceeded. The
+// NAS bucket is checked first so a NAS over its own limit does not drain
+// the global one.
+func (l *Limiter) Allow(nas, packetType string) (string, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	global, ok := l.global[packetType]
+	if !ok {
+		return "", true
+	}
+
+	now := time.Now()
+	key := nasKey{nas: nas, packetType: packetType}
+	n, ok := l.nas[key]
+	if !ok {
+		r := l.config.PerNAS.For(packetType)
+		n = &nasLimiter{limiter: rate.NewLimiter(limit(r), r.Burst)}
+		l.nas[key] = n
+	}
+	n.lastUsed = now
+
+	if !n.limiter.AllowN(now, 1) {
+		return ScopeNAS, false
+	}
+	if !global.AllowN(now, 1) {
+		return ScopeGlobal, false
+	}
+	return "", true
+}
+
+// Prune forgets the buckets of NAS idle for longer than idle
+func (l *Limiter) Prune(idle time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	cutoff := time.Now().Add(-idle)
+	for key, n := range l.nas {
+		if n.lastUsed.Before(cutoff) {
+			delete(l.nas, key)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/config"
+)
+
+// slow is a rate low enough that no token is refilled during a test
+const slow = 0.001
+
+func authRates(global, perNAS config.Rate) config.RateLimitsConfig {
+	return config.RateLimitsConfig{
+		Global: config.PacketRates{Authentication: global},
+		PerNAS: config.PacketRates{Authentication: perNAS},
+	}
+}
+
+func TestNASBucketCheckedBeforeGlobal(t *testing.T) {
+	l := NewLimiter(authRates(config.Rate{Rate: slow, Burst: 2}, config.Rate{Rate: slow, Burst: 1}))
+
+	if scope, ok := l.Allow("10.0.0.1", Authentication); !ok {
+		t.Fatalf("first packet refused by the %s limit", scope)
+	}
+	// Packets refused by the NAS bucket must not take global tokens
+	for i := 0; i < 5; i++ {
+		if scope, ok := l.Allow("10.0.0.1", Authentication); ok || scope != ScopeNAS {
+			t.Fatalf("Allow = %q, %v for a NAS over its limit, want %q", scope, ok, ScopeNAS)
+		}
+	}
+	if scope, ok := l.Allow("10.0.0.2", Authentication); !ok {
+		t.Fatalf("other NAS refused by the %s limit, want the global token left", scope)
+	}
+	if scope, ok := l.Allow("10.0.0.3", Authentication); ok || scope != ScopeGlobal {
+		t.Errorf("Allow = %q, %v with the global bucket empty, want %q", scope, ok, ScopeGlobal)
+	}
+}
+
+func TestZeroRateIsUnlimited(t *testing.T) {
+	l := NewLimiter(authRates(config.Rate{}, config.Rate{}))
+
+	for i := 0; i < 1000; i++ {
+		if scope, ok := l.Allow("10.0.0.1", Authentication); !ok {
+			t.Fatalf("packet %d refused by the %s limit with a rate of 0", i, scope)
+		}
+	}
+}
+
+func TestLimitsArePerPacketType(t *testing.T) {
+	l := NewLimiter(authRates(config.Rate{Rate: slow, Burst: 1}, config.Rate{Rate: slow, Burst: 1}))
+
+	l.Allow("10.0.0.1", Authentication)
+	if _, ok := l.Allow("10.0.0.1", Authentication); ok {
+		t.Fatal("second authentication packet allowed over a burst of 1")
+	}
+	if scope, ok := l.Allow("10.0.0.1", Accounting); !ok {
+		t.Errorf("accounting packet refused by the %s limit, want it unlimited", scope)
+	}
+}
+
+func TestConfigureKeepsBuckets(t *testing.T) {
+	cfg := authRates(config.Rate{}, config.Rate{Rate: slow, Burst: 2})
+	l := NewLimiter(cfg)
+
+	l.Allow("10.0.0.1", Authentication)
+	l.Configure(cfg)
+
+	if _, ok := l.Allow("10.0.0.1", Authentication); !ok {
+		t.Fatal("token left before Configure was lost")
+	}
+	if _, ok := l.Allow("10.0.0.1", Authentication); ok {
+		t.Error("Configure refilled a bucket in use")
+	}
+	if _, ok := l.Allow("10.0.0.2", Authentication); !ok {
+		t.Error("new NAS refused, want a full bucket")
+	}
+}
+
+func TestConfigureAppliesNewRates(t *testing.T) {
+	l := NewLimiter(authRates(config.Rate{}, config.Rate{Rate: slow, Burst: 1}))
+	l.Allow("10.0.0.1", Authentication)
+
+	l.Configure(authRates(config.Rate{}, config.Rate{}))
+	for i := 0; i < 10; i++ {
+		if scope, ok := l.Allow("10.0.0.1", Authentication); !ok {
+			t.Fatalf("packet refused by the %s limit after it was lifted", scope)
+		}
+	}
+}
+
+func TestPruneForgetsIdleNAS(t *testing.T) {
+	l := NewLimiter(authRates(config.Rate{}, config.Rate{Rate: slow, Burst: 1}))
+	l.Allow("10.0.0.1", Authentication)
+
+	l.Prune(time.Hour)
+	if _, ok := l.Allow("10.0.0.1", Authentication); ok {
+		t.Fatal("Prune forgot a NAS used within the idle period")
+	}
+
+	time.Sleep(time.Millisecond)
+	l.Prune(time.Nanosecond)
+	if n := len(l.nas); n != 0 {
+		t.Fatalf("%d NAS buckets left after Prune, want 0", n)
+	}
+	if scope, ok := l.Allow("10.0.0.1", Authentication); !ok {
+		t.Errorf("pruned NAS refused by the %s limit, want a new bucket", scope)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"tacacs-zitadel-server/tacacs_tacquito"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadDebounce coalesces the burst of events editors and config map
+// updates produce for a single change
+const reloadDebounce = 500 * time.Millisecond
+
+// watchConfig reloads the server configuration on SIGHUP and, when path is
+// set, whenever the file changes. It returns when ctx is cancelled.
+func watchConfig(ctx context.Context, path string, server *tacacs_tacquito.TacacsServer, logger *logrus.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			logger.WithError(err).Error("Failed to create config file watcher, reload with SIGHUP only")
+		} else {
+			defer watcher.Close()
+			// Watch the directory: editors and Kubernetes replace files rather than write them in place
+			if err := watcher.Add(filepath.Dir(path)); err != nil {
+				logger.WithError(err).Error("Failed to watch config directory, reload with SIGHUP only")
+			} else {
+				events, watchErrors = watcher.Events, watcher.Errors
+			}
+		}
+	}
+
+	reload := func(trigger string) {
+		changed, err := server.ReloadFrom(path)
+		entry := logger.WithField("trigger", trigger)
+		switch {
+		case err != nil:
+			entry.WithError(err).Error("Configuration reload failed, keeping current configuration")
+		case !changed:
+			entry.Debug("Configuration unchanged")
+		}
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("sighup")
+		case event := <-events:
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				debounce.Reset(reloadDebounce)
+			}
+		case err := <-watchErrors:
+			logger.WithError(err).Warn("Config file watcher error")
+		case <-debounce.C:
+			reload("file")
+		}
+	}
+}
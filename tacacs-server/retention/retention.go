@@ -0,0 +1,142 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Policy keeps rows of Table for MaxAge; zero keeps them forever
+type Policy struct {
+	Table  string
+	MaxAge time.Duration
+}
+
+// Job periodically prepares partitions and archives then deletes expired rows
+type Job struct {
+	store      store.Store
+	policies   []Policy
+	archiveDir string
+	batchSize  int
+	interval   time.Duration
+	logger     *logrus.Logger
+
+	mutex    sync.Mutex
+	sequence int
+}
+
+// NewJob creates a retention job; an empty archiveDir deletes without archiving
+func NewJob(st store.Store, policies []Policy, archiveDir string, batchSize int, interval time.Duration, logger *logrus.Logger) (*Job, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("retention batch size must be positive")
+	}
+	if archiveDir != "" {
+		if err := os.MkdirAll(archiveDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	return &Job{
+		store:      st,
+		policies:   policies,
+		archiveDir: archiveDir,
+		batchSize:  batchSize,
+		interval:   interval,
+		logger:     logger,
+	}, nil
+}
+
+// Run executes the job immediately and then every interval until ctx is cancelled
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs a single maintenance and expiry pass, logging failures
+func (j *Job) RunOnce(ctx context.Context) {
+	now := time.Now().UTC()
+	if err := j.store.Maintain(ctx, now); err != nil {
+		j.logger.WithError(err).Error("Failed to prepare storage partitions")
+	}
+
+	for _, policy := range j.policies {
+		if policy.MaxAge <= 0 {
+			continue
+		}
+		before := now.Add(-policy.MaxAge)
+		n, err := j.store.Expire(ctx, policy.Table, before, j.batchSize, j.archive)
+		fields := logrus.Fields{"table": policy.Table, "before": before.Format(time.RFC3339), "rows": n}
+		if err != nil {
+			j.logger.WithError(err).WithFields(fields).Error("Retention run failed")
+			continue
+		}
+		if n > 0 {
+			j.logger.WithFields(fields).Info("Expired audit rows")
+		}
+	}
+}
+
+// archive writes rows to a new gzip-compressed JSONL file and syncs it to disk
+// before returning, so rows are only deleted once their archive is durable
+func (j *Job) archive(table string, rows []store.Row) error {
+	if j.archiveDir == "" {
+		metrics.RetentionRows.WithLabelValues(table, "deleted").Add(float64(len(rows)))
+		return nil
+	}
+
+	j.mutex.Lock()
+	j.sequence++
+	name := fmt.Sprintf("%s-%s-%06d.jsonl.gz", table, time.Now().UTC().Format("20060102T150405Z"), j.sequence)
+	j.mutex.Unlock()
+
+	path := filepath.Join(j.archiveDir, name)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to encode archive row: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	metrics.RetentionRows.WithLabelValues(table, "archived").Add(float64(len(rows)))
+	return nil
+}
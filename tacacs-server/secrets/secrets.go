@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Resolver looks up the secret a reference points to. ref is the part of the
+// reference after the scheme, for example "NAME" for "env:NAME".
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// Registry dispatches secret references to the resolver registered for their
+// scheme. Values without a registered scheme prefix are literal secrets.
+type Registry struct {
+	resolvers map[string]Resolver
+}
+
+// NewRegistry creates a registry with the file and env schemes registered
+func NewRegistry() *Registry {
+	r := &Registry{resolvers: make(map[string]Resolver)}
+	r.Register("file", ResolverFunc(resolveFile))
+	r.Register("env", ResolverFunc(resolveEnv))
+	return r
+}
+
+// Register adds or replaces the resolver for scheme
+func (r *Registry) Register(scheme string, resolver Resolver) {
+	r.resolvers[scheme] = resolver
+}
+
+// IsReference reports whether value uses a registered scheme
+func (r *Registry) IsReference(value string) bool {
+	_, _, ok := r.split(value)
+	return ok
+}
+
+// Resolve returns the secret value points to, or value itself if it is not a reference
+func (r *Registry) Resolve(ctx context.Context, value string) (string, error) {
+	resolver, ref, ok := r.split(value)
+	if !ok {
+		return value, nil
+	}
+	secret, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", value)
+	}
+	return secret, nil
+}
+
+func (r *Registry) split(value string) (Resolver, string, bool) {
+	scheme, ref, found := strings.Cut(value, ":")
+	if !found {
+		return nil, "", false
+	}
+	resolver, ok := r.resolvers[scheme]
+	return resolver, ref, ok
+}
+
+// resolveFile reads file:///path references, as used for Docker and
+// Kubernetes secret mounts. A single trailing newline is ignored.
+func resolveFile(_ context.Context, ref string) (string, error) {
+	path, ok := strings.CutPrefix(ref, "//")
+	if !ok || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("invalid file reference %q: expected file:///absolute/path", "file:"+ref)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+func resolveEnv(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	secretFile := write("secret", "from-file\n")
+	crlfFile := write("crlf", "from-crlf\r\n")
+	emptyFile := write("empty", "")
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("TEST_EMPTY", "")
+
+	registry := NewRegistry()
+	registry.Register("vault", ResolverFunc(func(_ context.Context, ref string) (string, error) {
+		return "from-" + ref, nil
+	}))
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"literal", "plain-secret", "plain-secret", ""},
+		{"unknown scheme is literal", "s3cr3t:with:colons", "s3cr3t:with:colons", ""},
+		{"file", "file://" + secretFile, "from-file", ""},
+		{"file with CRLF", "file://" + crlfFile, "from-crlf", ""},
+		{"relative file", "file:secret", "", "expected file:///absolute/path"},
+		{"missing file", "file://" + filepath.Join(dir, "missing"), "", "failed to read secret file"},
+		{"empty file", "file://" + emptyFile, "", "is empty"},
+		{"env", "env:TEST_SECRET", "from-env", ""},
+		{"unset env", "env:TEST_UNSET_SECRET", "", "is not set"},
+		{"empty env", "env:TEST_EMPTY", "", "is empty"},
+		{"registered resolver", "vault:secret/tacacs#key", "from-secret/tacacs#key", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.Resolve(context.Background(), tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) = %q, %v, want an error containing %q", tt.value, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+			}
+			if registry.IsReference(tt.value) != (tt.value != tt.want) {
+				t.Errorf("IsReference(%q) = %v", tt.value, registry.IsReference(tt.value))
+			}
+		})
+	}
+}
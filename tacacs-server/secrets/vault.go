@@ -0,0 +1,190 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultResolver reads vault:mount/path#key references from a HashiCorp Vault
+// KV secrets engine, version 1 or 2, using a static token
+type VaultResolver struct {
+	address   string
+	token     string
+	namespace string
+	client    *http.Client
+
+	mutex sync.Mutex
+	cache map[string]map[string]interface{}
+	// versions holds the KV version of each mount read so far
+	versions map[string]string
+}
+
+// NewVaultResolver creates a resolver for the Vault server at address.
+// Secrets read from one path are cached for the lifetime of the resolver, so
+// create a new resolver for every configuration load.
+func NewVaultResolver(address, token, namespace string, timeout time.Duration) *VaultResolver {
+	return &VaultResolver{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: timeout},
+		cache:     make(map[string]map[string]interface{}),
+		versions:  make(map[string]string),
+	}
+}
+
+// Resolve returns field key of the secret at path, the latest version on KV
+// v2. The first path segment is the KV mount, e.g.
+// vault:secret/tacacs#client_secret reads /v1/secret/data/tacacs when secret
+// is a KV v2 mount and /v1/secret/tacacs when it is KV v1.
+func (v *VaultResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	mount, secretPath, hasMount := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || key == "" || !hasMount || secretPath == "" {
+		return "", fmt.Errorf("invalid vault reference %q: expected vault:mount/path#key", "vault:"+ref)
+	}
+	if v.address == "" {
+		return "", fmt.Errorf("vault reference %q used but no vault address is configured", "vault:"+ref)
+	}
+
+	data, err := v.read(ctx, mount, secretPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	value, found := data[key]
+	if !found {
+		return "", fmt.Errorf("vault secret %s has no key %q", path, key)
+	}
+	secret, isString := value.(string)
+	if !isString {
+		return "", fmt.Errorf("vault secret %s key %q is not a string", path, key)
+	}
+	return secret, nil
+}
+
+func (v *VaultResolver) read(ctx context.Context, mount, secretPath string) (map[string]interface{}, error) {
+	cacheKey := mount + "/" + secretPath
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if data, ok := v.cache[cacheKey]; ok {
+		return data, nil
+	}
+
+	version, err := v.mountVersion(ctx, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if version == "2" {
+		var secret struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		if err := v.get(ctx, url.PathEscape(mount)+"/data/"+escapePath(secretPath), &secret); err != nil {
+			return nil, err
+		}
+		if secret.Data.Data == nil {
+			return nil, fmt.Errorf("secret has no data; its latest version may be deleted")
+		}
+		data = secret.Data.Data
+	} else {
+		var secret struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := v.get(ctx, url.PathEscape(mount)+"/"+escapePath(secretPath), &secret); err != nil {
+			return nil, err
+		}
+		if secret.Data == nil {
+			return nil, fmt.Errorf("secret has no data")
+		}
+		data = secret.Data
+	}
+
+	v.cache[cacheKey] = data
+	return data, nil
+}
+
+// mountVersion returns the KV version of mount, "1" or "2", as the Vault CLI
+// finds it; the caller holds mutex
+func (v *VaultResolver) mountVersion(ctx context.Context, mount string) (string, error) {
+	if version, ok := v.versions[mount]; ok {
+		return version, nil
+	}
+
+	var info struct {
+		Data struct {
+			Type    string `json:"type"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	if err := v.get(ctx, "sys/internal/ui/mounts/"+url.PathEscape(mount), &info); err != nil {
+		return "", fmt.Errorf("failed to look up mount %s: %w", mount, err)
+	}
+	if info.Data.Type != "kv" && info.Data.Type != "generic" {
+		return "", fmt.Errorf("mount %s is a %q secrets engine, not kv", mount, info.Data.Type)
+	}
+
+	version := "1"
+	if info.Data.Options.Version == "2" {
+		version = "2"
+	}
+	v.versions[mount] = version
+	return version, nil
+}
+
+// get reads /v1/apiPath and decodes the JSON response into out
+func (v *VaultResolver) get(ctx context.Context, apiPath string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.address+"/v1/"+apiPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(body, &failure) == nil && len(failure.Errors) > 0 {
+			return fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(failure.Errors, "; "))
+		}
+		return fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testToken = "vault-token"
+
+// newVaultServer is a stub Vault with a KV v1 mount kv1 and a KV v2 mount secret
+func newVaultServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var reads atomic.Int32
+	respond := func(w http.ResponseWriter, status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != testToken {
+			respond(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/secret":
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"type": "kv", "options": map[string]string{"version": "2"},
+			}})
+		case "/v1/sys/internal/ui/mounts/kv1":
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"type": "kv", "options": nil}})
+		case "/v1/sys/internal/ui/mounts/pki":
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"type": "pki"}})
+		case "/v1/sys/internal/ui/mounts/broken":
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"type": "kv", "options": map[string]string{"version": "2"},
+			}})
+		case "/v1/secret/data/tacacs":
+			reads.Add(1)
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"client_secret": "v2-secret", "port": 49},
+				"metadata": map[string]interface{}{"version": 3},
+			}})
+		case "/v1/secret/data/deleted":
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": nil}})
+		case "/v1/kv1/tacacs":
+			reads.Add(1)
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"client_secret": "v1-secret"}})
+		case "/v1/broken/data/tacacs":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &reads
+}
+
+func TestVaultResolver(t *testing.T) {
+	server, _ := newVaultServer(t)
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"KV v2", "secret/tacacs#client_secret", "v2-secret", ""},
+		{"KV v1", "kv1/tacacs#client_secret", "v1-secret", ""},
+		{"missing key", "secret/tacacs#other", "", `has no key "other"`},
+		{"not a string", "secret/tacacs#port", "", "is not a string"},
+		{"missing secret", "secret/data/none#key", "", "status 404"},
+		{"deleted version", "secret/deleted#key", "", "has no data"},
+		{"server error", "broken/tacacs#key", "", "status 502"},
+		{"not a kv mount", "pki/tacacs#key", "", "not kv"},
+		{"unknown mount", "nope/tacacs#key", "", "failed to look up mount nope"},
+		{"no key", "secret/tacacs", "", "invalid vault reference"},
+		{"no path", "secret#key", "", "invalid vault reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewVaultResolver(server.URL, testToken, "", time.Second)
+			got, err := resolver.Resolve(context.Background(), tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) = %q, %v, want an error containing %q", tt.ref, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultResolverErrors(t *testing.T) {
+	server, _ := newVaultServer(t)
+
+	resolver := NewVaultResolver(server.URL, "wrong-token", "", time.Second)
+	if _, err := resolver.Resolve(context.Background(), "secret/tacacs#client_secret"); err == nil || !strings.Contains(err.Error(), "status 403: permission denied") {
+		t.Errorf("Resolve with a bad token = %v, want the 403 and Vault's error", err)
+	}
+
+	resolver = NewVaultResolver("", testToken, "", time.Second)
+	if _, err := resolver.Resolve(context.Background(), "secret/tacacs#client_secret"); err == nil || !strings.Contains(err.Error(), "no vault address") {
+		t.Errorf("Resolve without an address = %v", err)
+	}
+}
+
+func TestVaultResolverCachesSecrets(t *testing.T) {
+	server, reads := newVaultServer(t)
+	resolver := NewVaultResolver(server.URL, testToken, "", time.Second)
+
+	for _, ref := range []string{"secret/tacacs#client_secret", "secret/tacacs#client_secret", "kv1/tacacs#client_secret"} {
+		if _, err := resolver.Resolve(context.Background(), ref); err != nil {
+			t.Fatalf("Resolve(%q): %v", ref, err)
+		}
+	}
+	if got := reads.Load(); got != 2 {
+		t.Errorf("Vault read %d secrets, want 2", got)
+	}
+}
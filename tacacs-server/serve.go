@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/handlers"
+	"tacacs-zitadel-server/health"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/oidc"
+	"tacacs-zitadel-server/retention"
+	"tacacs-zitadel-server/store"
+	"tacacs-zitadel-server/tacacs_tacquito"
+	"tacacs-zitadel-server/tracing"
+	"tacacs-zitadel-server/zitadel"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// runServe starts the TACACS+ and HTTP servers and blocks until SIGINT or SIGTERM
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load configuration")
+	}
+	if err := cfg.Validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+
+	logger := logrus.New()
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	logger.Info("Starting TACACS+ server with Zitadel integration")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to set up tracing")
+	}
+
+	st, err := store.Open(context.Background(), cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to open session store")
+	}
+	logger.WithField("backend", cfg.StoreBackend).Info("Session store opened")
+
+	if cfg.StoreBackend != store.BackendMemory {
+		st, err = store.NewWriter(st, store.WriterOptions{
+			QueueSize:     cfg.AuditQueueSize,
+			BatchSize:     cfg.AuditBatchSize,
+			FlushInterval: time.Duration(cfg.AuditFlushIntervalMS) * time.Millisecond,
+			RetryInterval: time.Duration(cfg.AuditRetryInterval) * time.Second,
+			SpoolDir:      cfg.AuditSpoolDir,
+		}, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to start audit writer")
+		}
+	}
+
+	tacacsServer, err := tacacs_tacquito.NewTacacsServer(cfg, logger, st)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create TACACS+ server")
+	}
+
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	retentionJob, err := retention.NewJob(st, []retention.Policy{
+		{Table: store.TableSessions, MaxAge: days(cfg.RetentionSessionsDays)},
+		{Table: store.TableCommands, MaxAge: days(cfg.RetentionCommandsDays)},
+		{Table: store.TableAccounting, MaxAge: days(cfg.RetentionAccountingDays)},
+	}, cfg.RetentionArchiveDir, cfg.RetentionBatchSize, time.Duration(cfg.RetentionInterval)*time.Second, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create retention job")
+	}
+	retentionCtx, stopRetention := context.WithCancel(context.Background())
+	retentionDone := make(chan struct{})
+	go func() {
+		retentionJob.Run(retentionCtx)
+		close(retentionDone)
+	}()
+
+	checker := health.NewChecker(
+		time.Duration(cfg.ReadinessCacheTTL)*time.Second,
+		time.Duration(cfg.ReadinessProbeTimeout)*time.Second,
+	)
+	checker.Register("database", tacacsServer.PingDB)
+	checker.Register("tacacs_listener", tacacsServer.CheckListener)
+	if zc, ok := tacacsServer.Provider(config.ProviderZitadel).(*zitadel.Client); ok {
+		checker.Register("zitadel_discovery", zc.CheckDiscovery)
+		checker.Register("zitadel_service_token", zc.CheckServiceToken)
+		checker.Register("zitadel_circuit", zc.CheckCircuit)
+	}
+	if oc, ok := tacacsServer.Provider(config.ProviderOIDC).(*oidc.Client); ok {
+		checker.Register("oidc_discovery", oc.CheckDiscovery)
+		checker.Register("oidc_circuit", oc.CheckCircuit)
+	}
+
+	tokenValidator := auth.NewTokenValidator(
+		auth.NewJWKS(cfg.AdminJWKSURL, &http.Client{Timeout: 10 * time.Second}),
+		cfg.AdminIssuer,
+		cfg.AdminAudience,
+		[]string{"urn:zitadel:iam:org:project:roles", "roles"},
+	)
+
+	// Only liveness, /livez and the legacy /health, is served without a token
+	router := mux.NewRouter()
+	protected := router.NewRoute().Subrouter()
+	protected.Use(handlers.RequireRoles(tokenValidator, cfg.AdminRole, cfg.AdminAuditorRole, logger))
+	handlers.RegisterHealth(router, protected, checker)
+	protected.Handle("/metrics", metrics.Handler()).Methods("GET")
+	handlers.NewAdminHandler(tacacsServer, tacacsServer, tacacsServer).Register(protected.PathPrefix("/admin").Subrouter())
+	handlers.NewAuditHandler(tacacsServer.Searcher()).Register(protected.PathPrefix("/audit").Subrouter())
+
+	httpServer := &http.Server{
+		Addr:    cfg.HTTPListenAddress,
+		Handler: router,
+	}
+
+	go func() {
+		logger.WithField("address", cfg.HTTPListenAddress).Info("Starting HTTP server")
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Fatal("HTTP server failed")
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tacacsErr := make(chan error, 1)
+	go func() {
+		logger.WithField("listeners", len(cfg.Listeners)).Info("Starting TACACS+ server")
+		err := tacacsServer.Start(ctx)
+		if err != nil {
+			logger.WithError(err).Error("TACACS+ server failed")
+			stop()
+		}
+		tacacsErr <- err
+	}()
+
+	go watchConfig(ctx, *configPath, tacacsServer, logger)
+
+	<-ctx.Done()
+	stop()
+
+	logger.WithField("timeout_seconds", cfg.ShutdownTimeout).Info("Shutting down servers...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("HTTP server shutdown error")
+	}
+
+	stopRetention()
+	<-retentionDone
+
+	exitCode := 0
+	if err := <-tacacsErr; err != nil {
+		exitCode = 1
+	}
+	if err := tacacsServer.Stop(shutdownCtx); err != nil {
+		logger.WithError(err).Error("TACACS+ server shutdown error")
+		exitCode = 1
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Tracing shutdown error")
+	}
+
+	logger.Info("Servers shut down")
+	return exitCode
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tacacs-zitadel-server/handlers"
+)
+
+const sessionsUsage = `Usage: tacacs-server sessions [list|kill <id>] [flags]
+
+  list  show live sessions of the running server (default)
+  kill  terminate a live session
+
+Sessions live in the running server, so these commands call its admin API
+with a bearer token holding the admin role (-token or ADMIN_TOKEN).
+`
+
+// runSessions implements the sessions subcommand and returns the process exit code
+func runSessions(args []string) int {
+	action := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("sessions "+action, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, sessionsUsage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", defaultAdminURL(), "base URL of the server's HTTP API")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "bearer token for the admin API")
+	user := fs.String("user", "", "list: only sessions of this user")
+	nas := fs.String("nas", "", "list: only sessions from this NAS")
+	role := fs.String("role", "", "list: only sessions with this role")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client := &adminClient{baseURL: strings.TrimRight(*server, "/"), token: *token, http: &http.Client{Timeout: 10 * time.Second}}
+	ctx := context.Background()
+
+	switch action {
+	case "list":
+		query := url.Values{}
+		for key, value := range map[string]string{"user": *user, "nas": *nas, "role": *role} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+		path := "/admin/sessions"
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		var sessions []handlers.SessionResponse
+		if err := client.do(ctx, http.MethodGet, path, &sessions); err != nil {
+			fmt.Fprintf(os.Stderr, "sessions: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tNAS\tROLES\tSTARTED\tCOMMANDS\tAUTH\tPROVIDER")
+		for _, s := range sessions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", s.ID, s.Username, s.NAS,
+				strings.Join(s.Roles, ","), s.StartTime.Local().Format(time.RFC3339), s.Commands, s.AuthMode, s.Provider)
+		}
+		w.Flush()
+	case "kill":
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, sessionsUsage)
+			return 2
+		}
+		id := fs.Arg(0)
+		if err := client.do(ctx, http.MethodDelete, "/admin/sessions/"+url.PathEscape(id), nil); err != nil {
+			fmt.Fprintf(os.Stderr, "sessions: %v\n", err)
+			return 1
+		}
+		fmt.Printf("session %s terminated\n", id)
+	default:
+		fmt.Fprint(os.Stderr, sessionsUsage)
+		return 2
+	}
+	return 0
+}
+
+// defaultAdminURL points at the local HTTP listener from the environment
+func defaultAdminURL() string {
+	if v := os.Getenv("ADMIN_URL"); v != "" {
+		return v
+	}
+	address := os.Getenv("HTTP_LISTEN_ADDRESS")
+	if address == "" {
+		address = "127.0.0.1:8090"
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		address = net.JoinHostPort("127.0.0.1", port)
+	}
+	return "http://" + address
+}
+
+type adminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// do calls the admin API and decodes a JSON response into out unless it is nil
+func (c *adminClient) do(ctx context.Context, method, path string, out interface{}) error {
+	if c.token == "" {
+		return fmt.Errorf("no admin token: set -token or ADMIN_TOKEN")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure handlers.ErrorResponse
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s %s: %s (status %d)", method, path, failure.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("%s %s: status %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+)
+
+type memorySession struct {
+	Session
+	EndTime *time.Time
+}
+
+type memoryCommand struct {
+	Command
+	ID int64
+}
+
+// Memory is a Store that keeps everything in process memory; data is lost on restart
+type Memory struct {
+	sessions   map[string]*memorySession
+	commands   []memoryCommand
+	accounting []AccountingRecord
+	nextID     int64
+	mutex      sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{sessions: make(map[string]*memorySession)}
+}
+
+func (m *Memory) CreateSession(ctx context.Context, session Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.sessions[session.ID]; exists {
+		// Like the SQL backends, so replaying a spool is safe
+		return nil
+	}
+	if session.AuthMode == "" {
+		session.AuthMode = AuthModeOnline
+	}
+	m.sessions[session.ID] = &memorySession{Session: session}
+	return nil
+}
+
+func (m *Memory) EndSession(ctx context.Context, id, status string, endTime time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if session, exists := m.sessions[id]; exists {
+		session.Status = status
+		session.EndTime = &endTime
+	}
+	return nil
+}
+
+func (m *Memory) RecordCommand(ctx context.Context, cmd Command) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nextID++
+	m.commands = append(m.commands, memoryCommand{Command: cmd, ID: m.nextID})
+	return nil
+}
+
+func (m *Memory) RecordAccounting(ctx context.Context, record AccountingRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.accounting = append(m.accounting, record)
+	return nil
+}
+
+// WriteBatch applies ops one at a time; memory writes cannot fail midway
+func (m *Memory) WriteBatch(ctx context.Context, ops []Op) error {
+	for _, op := range ops {
+		var err error
+		switch {
+		case op.Kind == OpCreateSession && op.Session != nil:
+			err = m.CreateSession(ctx, *op.Session)
+		case op.Kind == OpEndSession && op.End != nil:
+			err = m.EndSession(ctx, op.End.ID, op.End.Status, op.End.EndTime)
+		case op.Kind == OpRecordCommand && op.Command != nil:
+			err = m.RecordCommand(ctx, *op.Command)
+		case op.Kind == OpRecordAccounting && op.Accounting != nil:
+			err = m.RecordAccounting(ctx, *op.Accounting)
+		default:
+			err = fmt.Errorf("invalid write operation: %q", op.Kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SearchCommands(ctx context.Context, q audit.CommandQuery, fn func(audit.CommandRecord) error) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	after, err := audit.DecodeCursor(q.Cursor)
+	if err != nil {
+		return "", err
+	}
+	var afterID int64
+	if after != nil {
+		if afterID, err = strconv.ParseInt(after.ID, 10, 64); err != nil {
+			return "", audit.ErrInvalidCursor
+		}
+	}
+	var re *regexp.Regexp
+	if q.Regex != "" {
+		re = regexp.MustCompile(q.Regex)
+	}
+	contains := strings.ToLower(q.Contains)
+
+	m.mutex.RLock()
+	var matched []audit.CommandRecord
+	for _, cmd := range m.commands {
+		r := audit.CommandRecord{
+			ID:        cmd.ID,
+			SessionID: cmd.SessionID,
+			Command:   cmd.Command.Command,
+			Timestamp: cmd.Timestamp,
+			Allowed:   cmd.Allowed,
+		}
+		if session, exists := m.sessions[cmd.SessionID]; exists {
+			r.Username = session.Username
+			r.NAS = session.NAS
+			r.SessionStatus = session.Status
+		}
+
+		switch {
+		case q.Username != "" && r.Username != q.Username,
+			q.NAS != "" && r.NAS != q.NAS,
+			!q.From.IsZero() && r.Timestamp.Before(q.From),
+			!q.To.IsZero() && !r.Timestamp.Before(q.To),
+			contains != "" && !strings.Contains(strings.ToLower(r.Command), contains),
+			re != nil && !re.MatchString(r.Command),
+			q.Allowed != nil && r.Allowed != *q.Allowed,
+			q.SessionStatus != "" && r.SessionStatus != q.SessionStatus,
+			after != nil && !before(r.Timestamp, r.ID, after.Time, afterID):
+			continue
+		}
+		matched = append(matched, r)
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return before(matched[j].Timestamp, matched[j].ID, matched[i].Timestamp, matched[i].ID)
+	})
+
+	for i, r := range matched {
+		if i == q.Limit {
+			last := matched[i-1]
+			return audit.EncodeCursor(audit.Cursor{Time: last.Timestamp, ID: strconv.FormatInt(last.ID, 10)}), nil
+		}
+		if err := fn(r); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func (m *Memory) SearchSessions(ctx context.Context, q audit.SessionQuery, fn func(audit.SessionRecord) error) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	after, err := audit.DecodeCursor(q.Cursor)
+	if err != nil {
+		return "", err
+	}
+
+	m.mutex.RLock()
+	var matched []audit.SessionRecord
+	for _, session := range m.sessions {
+		switch {
+		case q.Username != "" && session.Username != q.Username,
+			q.NAS != "" && session.NAS != q.NAS,
+			!q.From.IsZero() && session.StartTime.Before(q.From),
+			!q.To.IsZero() && !session.StartTime.Before(q.To),
+			q.Status != "" && session.Status != q.Status,
+			q.AuthMode != "" && session.AuthMode != q.AuthMode,
+			q.Provider != "" && session.Provider != q.Provider,
+			after != nil && !beforeString(session.StartTime, session.ID, after.Time, after.ID):
+			continue
+		}
+		matched = append(matched, audit.SessionRecord{
+			ID:        session.ID,
+			Username:  session.Username,
+			NAS:       session.NAS,
+			StartTime: session.StartTime,
+			EndTime:   session.EndTime,
+			Status:    session.Status,
+			AuthMode:  session.AuthMode,
+			Provider:  session.Provider,
+		})
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return beforeString(matched[j].StartTime, matched[j].ID, matched[i].StartTime, matched[i].ID)
+	})
+
+	for i, r := range matched {
+		if i == q.Limit {
+			last := matched[i-1]
+			return audit.EncodeCursor(audit.Cursor{Time: last.StartTime, ID: last.ID}), nil
+		}
+		if err := fn(r); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Expire archives expired records batchSize at a time and removes each batch
+// once archive returns nil
+func (m *Memory) Expire(ctx context.Context, table string, before time.Time, batchSize int, archive ArchiveFunc) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var expired []Row
+	// remove drops the first n expired records
+	var remove func(n int)
+	switch table {
+	case TableSessions:
+		for id, session := range m.sessions {
+			if session.StartTime.Before(before) && session.Status != "active" {
+				expired = append(expired, Row{
+					"id": id, "username": session.Username, "client_ip": session.NAS,
+					"start_time": session.StartTime, "end_time": session.EndTime, "status": session.Status,
+					"auth_mode": session.AuthMode, "provider": session.Provider,
+				})
+			}
+		}
+		sort.Slice(expired, func(i, j int) bool {
+			return expired[i]["id"].(string) < expired[j]["id"].(string)
+		})
+		remove = func(n int) {
+			for _, row := range expired[:n] {
+				delete(m.sessions, row["id"].(string))
+			}
+		}
+	case TableCommands:
+		var indexes []int
+		for i, cmd := range m.commands {
+			if cmd.Timestamp.Before(before) {
+				expired = append(expired, Row{
+					"id": cmd.ID, "session_id": cmd.SessionID, "command": cmd.Command.Command,
+					"timestamp": cmd.Timestamp, "allowed": cmd.Allowed,
+				})
+				indexes = append(indexes, i)
+			}
+		}
+		remove = func(n int) {
+			drop := indexSet(indexes[:n])
+			kept := m.commands[:0:0]
+			for i, cmd := range m.commands {
+				if !drop[i] {
+					kept = append(kept, cmd)
+				}
+			}
+			m.commands = kept
+		}
+	case TableAccounting:
+		var indexes []int
+		for i, record := range m.accounting {
+			if record.Timestamp.Before(before) {
+				expired = append(expired, Row{
+					"session_id": record.SessionID, "username": record.Username, "client_ip": record.NAS,
+					"flag": record.Flag, "args": record.Args, "timestamp": record.Timestamp,
+				})
+				indexes = append(indexes, i)
+			}
+		}
+		remove = func(n int) {
+			drop := indexSet(indexes[:n])
+			kept := m.accounting[:0:0]
+			for i, record := range m.accounting {
+				if !drop[i] {
+					kept = append(kept, record)
+				}
+			}
+			m.accounting = kept
+		}
+	default:
+		return 0, fmt.Errorf("no retention defined for table %s", table)
+	}
+
+	if batchSize <= 0 {
+		batchSize = len(expired)
+	}
+	archived := 0
+	for archived < len(expired) {
+		end := archived + batchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+		if err := archive(table, expired[archived:end]); err != nil {
+			remove(archived)
+			return int64(archived), fmt.Errorf("failed to archive %s rows: %w", table, err)
+		}
+		archived = end
+	}
+	remove(archived)
+	return int64(archived), nil
+}
+
+func indexSet(indexes []int) map[int]bool {
+	set := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		set[i] = true
+	}
+	return set
+}
+
+// Maintain is a no-op; memory has no partitions
+func (m *Memory) Maintain(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// before reports whether (t, id) sorts before (t2, id2)
+func before(t time.Time, id int64, t2 time.Time, id2 int64) bool {
+	if t.Equal(t2) {
+		return id < id2
+	}
+	return t.Before(t2)
+}
+
+func beforeString(t time.Time, id string, t2 time.Time, id2 string) bool {
+	if t.Equal(t2) {
+		return id < id2
+	}
+	return t.Before(t2)
+}
@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	// ErrSchemaTooNew is returned when the database was migrated by a newer binary
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+	// ErrSchemaOutdated is returned when migrations are pending and auto-migration is off
+	ErrSchemaOutdated = errors.New("database schema is out of date")
+)
+
+// Migration is one numbered schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations of a backend and tracks them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+func newMigrator(db *sql.DB, d dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", d.migrations))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// loadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs from dir
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", name)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous, missing %04d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest returns the newest migration version known to this binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// Current returns the highest applied migration version, 0 for an empty database
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// Status lists every known migration with its applied time
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Migration: migration}
+		if at, ok := applied[migration.Version]; ok {
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Up applies pending migrations up to and including target; target 0 means latest
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	if target == 0 {
+		target = m.Latest()
+	}
+	if target > m.Latest() {
+		return fmt.Errorf("unknown migration version %d, latest is %d", target, m.Latest())
+	}
+
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database is at %d, binary supports %d", ErrSchemaTooNew, current, m.Latest())
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+		insert := m.dialect.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`)
+		if err := m.apply(ctx, migration, migration.Up, insert, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down rolls back the given number of applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database is at %d, binary supports %d", ErrSchemaTooNew, current, m.Latest())
+	}
+
+	for i := current - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		remove := m.dialect.rebind(`DELETE FROM schema_migrations WHERE version = ?`)
+		if err := m.apply(ctx, migration, migration.Down, remove, migration.Version); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// apply runs a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) apply(ctx context.Context, migration Migration, script, bookkeeping string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %04d: %w", migration.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", migration.Version, err)
+	}
+	return tx.Commit()
+}
+
+// Prepare brings the schema up to date at startup, refusing to run against a
+// schema written by a newer binary or, without autoMigrate, an older one
+func (m *Migrator) Prepare(ctx context.Context, autoMigrate bool) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case current > m.Latest():
+		return fmt.Errorf("%w: database is at %d, binary supports %d", ErrSchemaTooNew, current, m.Latest())
+	case current == m.Latest():
+		return nil
+	case !autoMigrate:
+		return fmt.Errorf("%w: database is at %d, binary expects %d; run the migrate command", ErrSchemaOutdated, current, m.Latest())
+	default:
+		return m.Up(ctx, 0)
+	}
+}
+
+// Close releases the migrator's database connection
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"tacacs-zitadel-server/config"
+)
+
+func openTestMigrator(t *testing.T) *Migrator {
+	t.Helper()
+	migrator, err := OpenMigrator(&config.Config{
+		StoreBackend: BackendSQLite,
+		SQLitePath:   filepath.Join(t.TempDir(), "tacacs.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenMigrator: %v", err)
+	}
+	t.Cleanup(func() { migrator.Close() })
+	return migrator
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	migrator := openTestMigrator(t)
+
+	if err := migrator.Prepare(ctx, false); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("Prepare without auto-migration on an empty database = %v, want ErrSchemaOutdated", err)
+	}
+
+	if err := migrator.Up(ctx, 1); err != nil {
+		t.Fatalf("Up to 1: %v", err)
+	}
+	if current, _ := migrator.Current(ctx); current != 1 {
+		t.Fatalf("Current = %d after Up to 1, want 1", current)
+	}
+
+	if err := migrator.Prepare(ctx, true); err != nil {
+		t.Fatalf("Prepare with auto-migration: %v", err)
+	}
+	if current, _ := migrator.Current(ctx); current != migrator.Latest() {
+		t.Fatalf("Current = %d after Prepare, want %d", current, migrator.Latest())
+	}
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %04d_%s not applied", s.Version, s.Name)
+		}
+	}
+
+	// The migrated schema accepts writes
+	st := &sqlStore{db: migrator.db, dialect: migrator.dialect}
+	if err := st.CreateSession(ctx, Session{ID: "s1", Username: "alice", NAS: "10.0.0.1", StartTime: time.Now(), Status: "active"}); err != nil {
+		t.Fatalf("CreateSession on the migrated schema: %v", err)
+	}
+
+	if err := migrator.Down(ctx, migrator.Latest()); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if current, _ := migrator.Current(ctx); current != 0 {
+		t.Fatalf("Current = %d after rolling everything back, want 0", current)
+	}
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
+
+func TestMigratorRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	migrator := openTestMigrator(t)
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := migrator.db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		migrator.Latest()+1, "from_the_future", time.Now().UTC()); err != nil {
+		t.Fatalf("failed to record a future migration: %v", err)
+	}
+
+	for _, autoMigrate := range []bool{true, false} {
+		if err := migrator.Prepare(ctx, autoMigrate); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Prepare(%v) = %v, want ErrSchemaTooNew", autoMigrate, err)
+		}
+	}
+	if err := migrator.Up(ctx, 0); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Up = %v, want ErrSchemaTooNew", err)
+	}
+	if err := migrator.Down(ctx, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Down = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dir := range []string{"migrations/postgres", "migrations/sqlite"} {
+		if _, err := loadMigrations(migrationFiles, dir); err != nil {
+			t.Errorf("embedded %s: %v", dir, err)
+		}
+	}
+
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{"missing down", fstest.MapFS{"m/0001_a.up.sql": file("x")}, "missing its up or down file"},
+		{"gap", fstest.MapFS{
+			"m/0001_a.up.sql": file("x"), "m/0001_a.down.sql": file("x"),
+			"m/0003_c.up.sql": file("x"), "m/0003_c.down.sql": file("x"),
+		}, "missing 0002"},
+		{"bad version", fstest.MapFS{"m/first_a.up.sql": file("x")}, "invalid migration version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadMigrations = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
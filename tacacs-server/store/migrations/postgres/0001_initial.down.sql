@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS tacacs_accounting;
+DROP TABLE IF EXISTS tacacs_commands;
+DROP TABLE IF EXISTS tacacs_sessions;
@@ -0,0 +1,53 @@
+-- Releases before versioned migrations created these tables in the public
+-- schema. Move them into the configured schema so their history is kept;
+-- the CREATE TABLE IF NOT EXISTS statements below then leave them alone.
+-- Commands carry no foreign key to sessions: a command may be recorded for a
+-- session whose row was expired or never written.
+DO $$
+DECLARE
+	t text;
+BEGIN
+	IF current_schema() <> 'public' THEN
+		FOREACH t IN ARRAY ARRAY['tacacs_sessions', 'tacacs_commands', 'tacacs_accounting'] LOOP
+			IF to_regclass(format('public.%I', t)) IS NOT NULL
+				AND to_regclass(format('%I.%I', current_schema(), t)) IS NULL THEN
+				EXECUTE format('ALTER TABLE public.%I SET SCHEMA %I', t, current_schema());
+			END IF;
+		END LOOP;
+	END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS tacacs_sessions (
+	id VARCHAR(255) PRIMARY KEY,
+	username VARCHAR(255) NOT NULL,
+	client_ip VARCHAR(45) NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP,
+	status VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tacacs_commands (
+	id SERIAL PRIMARY KEY,
+	session_id VARCHAR(255),
+	command TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tacacs_accounting (
+	id SERIAL PRIMARY KEY,
+	session_id VARCHAR(255),
+	username VARCHAR(255) NOT NULL,
+	client_ip VARCHAR(45) NOT NULL,
+	flag VARCHAR(20) NOT NULL,
+	args TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON tacacs_sessions(username);
+CREATE INDEX IF NOT EXISTS idx_sessions_start_time ON tacacs_sessions(start_time);
+CREATE INDEX IF NOT EXISTS idx_commands_session_id ON tacacs_commands(session_id);
+CREATE INDEX IF NOT EXISTS idx_accounting_timestamp ON tacacs_accounting(timestamp);
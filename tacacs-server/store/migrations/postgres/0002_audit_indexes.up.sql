@@ -0,0 +1,3 @@
+-- Support newest-first audit searches ordered by (timestamp, id)
+CREATE INDEX IF NOT EXISTS idx_commands_timestamp_id ON tacacs_commands(timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_client_ip ON tacacs_sessions(client_ip);
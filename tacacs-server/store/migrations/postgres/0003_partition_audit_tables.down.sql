@@ -0,0 +1,46 @@
+-- Collapse the monthly partitions back into plain tables; the foreign key to
+-- tacacs_sessions is not restored because rows may reference unknown sessions
+
+DROP INDEX IF EXISTS idx_commands_session_id;
+DROP INDEX IF EXISTS idx_commands_timestamp_id;
+DROP INDEX IF EXISTS idx_accounting_timestamp;
+
+ALTER TABLE tacacs_commands RENAME TO tacacs_commands_partitioned;
+ALTER TABLE tacacs_commands_partitioned RENAME CONSTRAINT tacacs_commands_pkey TO tacacs_commands_partitioned_pkey;
+ALTER TABLE tacacs_accounting RENAME TO tacacs_accounting_partitioned;
+ALTER TABLE tacacs_accounting_partitioned RENAME CONSTRAINT tacacs_accounting_pkey TO tacacs_accounting_partitioned_pkey;
+
+CREATE TABLE tacacs_commands (
+	id INTEGER PRIMARY KEY DEFAULT nextval('tacacs_commands_id_seq'),
+	session_id VARCHAR(255),
+	command TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tacacs_accounting (
+	id INTEGER PRIMARY KEY DEFAULT nextval('tacacs_accounting_id_seq'),
+	session_id VARCHAR(255),
+	username VARCHAR(255) NOT NULL,
+	client_ip VARCHAR(45) NOT NULL,
+	flag VARCHAR(20) NOT NULL,
+	args TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER SEQUENCE tacacs_commands_id_seq OWNED BY tacacs_commands.id;
+ALTER SEQUENCE tacacs_accounting_id_seq OWNED BY tacacs_accounting.id;
+
+INSERT INTO tacacs_commands (id, session_id, command, timestamp, allowed, created_at)
+	SELECT id, session_id, command, timestamp, allowed, created_at FROM tacacs_commands_partitioned;
+INSERT INTO tacacs_accounting (id, session_id, username, client_ip, flag, args, timestamp, created_at)
+	SELECT id, session_id, username, client_ip, flag, args, timestamp, created_at FROM tacacs_accounting_partitioned;
+
+DROP TABLE tacacs_commands_partitioned;
+DROP TABLE tacacs_accounting_partitioned;
+
+CREATE INDEX idx_commands_session_id ON tacacs_commands(session_id);
+CREATE INDEX idx_commands_timestamp_id ON tacacs_commands(timestamp DESC, id DESC);
+CREATE INDEX idx_accounting_timestamp ON tacacs_accounting(timestamp);
@@ -0,0 +1,72 @@
+-- Range-partition commands and accounting by month so retention can drop
+-- whole partitions instead of deleting rows. Partitioned tables cannot carry
+-- a foreign key to tacacs_sessions, so one adopted from older releases is
+-- dropped with the legacy table. Monthly partitions named <table>_pYYYYMM
+-- are created here for existing data and kept ahead of time by the retention
+-- job; the default partition catches anything else until the retention job
+-- creates the partition for its month and moves the rows there.
+
+DROP INDEX IF EXISTS idx_commands_session_id;
+DROP INDEX IF EXISTS idx_commands_timestamp_id;
+DROP INDEX IF EXISTS idx_accounting_timestamp;
+
+ALTER TABLE tacacs_commands RENAME TO tacacs_commands_legacy;
+ALTER TABLE tacacs_commands_legacy RENAME CONSTRAINT tacacs_commands_pkey TO tacacs_commands_legacy_pkey;
+ALTER TABLE tacacs_accounting RENAME TO tacacs_accounting_legacy;
+ALTER TABLE tacacs_accounting_legacy RENAME CONSTRAINT tacacs_accounting_pkey TO tacacs_accounting_legacy_pkey;
+
+CREATE TABLE tacacs_commands (
+	id INTEGER NOT NULL DEFAULT nextval('tacacs_commands_id_seq'),
+	session_id VARCHAR(255),
+	command TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (timestamp, id)
+) PARTITION BY RANGE (timestamp);
+
+CREATE TABLE tacacs_accounting (
+	id INTEGER NOT NULL DEFAULT nextval('tacacs_accounting_id_seq'),
+	session_id VARCHAR(255),
+	username VARCHAR(255) NOT NULL,
+	client_ip VARCHAR(45) NOT NULL,
+	flag VARCHAR(20) NOT NULL,
+	args TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (timestamp, id)
+) PARTITION BY RANGE (timestamp);
+
+ALTER SEQUENCE tacacs_commands_id_seq OWNED BY tacacs_commands.id;
+ALTER SEQUENCE tacacs_accounting_id_seq OWNED BY tacacs_accounting.id;
+
+CREATE TABLE tacacs_commands_default PARTITION OF tacacs_commands DEFAULT;
+CREATE TABLE tacacs_accounting_default PARTITION OF tacacs_accounting DEFAULT;
+
+DO $$
+DECLARE
+	t text;
+	month timestamp;
+	last timestamp := date_trunc('month', now()) + interval '2 months';
+BEGIN
+	FOREACH t IN ARRAY ARRAY['tacacs_commands', 'tacacs_accounting'] LOOP
+		EXECUTE format('SELECT date_trunc(''month'', COALESCE(min(timestamp), now())) FROM %I', t || '_legacy') INTO month;
+		WHILE month <= last LOOP
+			EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+				t || '_p' || to_char(month, 'YYYYMM'), t, month, month + interval '1 month');
+			month := month + interval '1 month';
+		END LOOP;
+	END LOOP;
+END $$;
+
+INSERT INTO tacacs_commands (id, session_id, command, timestamp, allowed, created_at)
+	SELECT id, session_id, command, timestamp, allowed, created_at FROM tacacs_commands_legacy;
+INSERT INTO tacacs_accounting (id, session_id, username, client_ip, flag, args, timestamp, created_at)
+	SELECT id, session_id, username, client_ip, flag, args, timestamp, created_at FROM tacacs_accounting_legacy;
+
+DROP TABLE tacacs_commands_legacy;
+DROP TABLE tacacs_accounting_legacy;
+
+CREATE INDEX idx_commands_session_id ON tacacs_commands(session_id);
+CREATE INDEX idx_commands_timestamp_id ON tacacs_commands(timestamp DESC, id DESC);
+CREATE INDEX idx_accounting_timestamp ON tacacs_accounting(timestamp);
@@ -0,0 +1,2 @@
+-- Record how each session was authenticated so offline logins can be audited
+ALTER TABLE tacacs_sessions ADD COLUMN IF NOT EXISTS auth_mode VARCHAR(20) NOT NULL DEFAULT 'online';
@@ -0,0 +1 @@
+ALTER TABLE tacacs_sessions DROP COLUMN IF EXISTS provider;
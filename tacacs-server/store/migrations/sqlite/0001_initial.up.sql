@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS tacacs_sessions (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL,
+	client_ip TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP,
+	status TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tacacs_commands (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT REFERENCES tacacs_sessions(id),
+	command TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tacacs_accounting (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT,
+	username TEXT NOT NULL,
+	client_ip TEXT NOT NULL,
+	flag TEXT NOT NULL,
+	args TEXT NOT NULL,
+	timestamp TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON tacacs_sessions(username);
+CREATE INDEX IF NOT EXISTS idx_sessions_start_time ON tacacs_sessions(start_time);
+CREATE INDEX IF NOT EXISTS idx_commands_session_id ON tacacs_commands(session_id);
+CREATE INDEX IF NOT EXISTS idx_accounting_timestamp ON tacacs_accounting(timestamp);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sessions_client_ip;
+DROP INDEX IF EXISTS idx_commands_timestamp_id;
@@ -0,0 +1,2 @@
+-- Record how each session was authenticated so offline logins can be audited
+ALTER TABLE tacacs_sessions ADD COLUMN auth_mode TEXT NOT NULL DEFAULT 'online';
@@ -0,0 +1,2 @@
+-- Record which authentication provider accepted each session
+ALTER TABLE tacacs_sessions ADD COLUMN provider TEXT NOT NULL DEFAULT '';
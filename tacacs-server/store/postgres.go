@@ -0,0 +1,53 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+var postgresDialect = dialect{
+	system:      semconv.DBSystemPostgreSQL,
+	migrations:  "postgres",
+	numbered:    true,
+	likeClause:  "ILIKE ?",
+	regexClause: "~ ?",
+	partitioned: []string{TableCommands, TableAccounting},
+}
+
+var schemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// openPostgres connects to PostgreSQL with search_path pinned to schema,
+// creating the schema when it does not exist yet
+func openPostgres(dsn, schema string) (*sql.DB, error) {
+	if !schemaName.MatchString(schema) {
+		return nil, fmt.Errorf("invalid database schema name: %q", schema)
+	}
+
+	bootstrap, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer bootstrap.Close()
+
+	if err := bootstrap.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	if _, err := bootstrap.Exec("CREATE SCHEMA IF NOT EXISTS " + schema); err != nil {
+		return nil, fmt.Errorf("failed to create schema %s: %w", schema, err)
+	}
+
+	db, err := sql.Open("postgres", dsn+" search_path="+schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
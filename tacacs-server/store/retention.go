@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"tacacs-zitadel-server/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tables subject to retention
+const (
+	TableSessions   = "tacacs_sessions"
+	TableCommands   = "tacacs_commands"
+	TableAccounting = "tacacs_accounting"
+)
+
+// partitionsAhead is how many future monthly partitions Maintain keeps ready
+const partitionsAhead = 2
+
+// Row is one archived database row keyed by column name
+type Row map[string]interface{}
+
+// ArchiveFunc durably stores rows before they are deleted
+type ArchiveFunc func(table string, rows []Row) error
+
+// retentionTable describes how a table ages out
+type retentionTable struct {
+	timeColumn string
+	// filter excludes rows that must be kept regardless of age
+	filter string
+}
+
+var retentionTables = map[string]retentionTable{
+	TableSessions:   {timeColumn: "start_time", filter: "status <> 'active'"},
+	TableCommands:   {timeColumn: "timestamp"},
+	TableAccounting: {timeColumn: "timestamp"},
+}
+
+var partitionName = regexp.MustCompile(`^(tacacs_[a-z]+)_p(\d{6})$`)
+
+// Expire archives and deletes expired rows. Monthly partitions lying wholly
+// before the cutoff are archived and dropped; remaining rows are archived and
+// deleted batchSize at a time.
+func (s *sqlStore) Expire(ctx context.Context, table string, before time.Time, batchSize int, archive ArchiveFunc) (int64, error) {
+	spec, ok := retentionTables[table]
+	if !ok {
+		return 0, fmt.Errorf("no retention defined for table %s", table)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "db EXPIRE "+table, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(s.dialect.system, semconv.DBOperation("EXPIRE"), semconv.DBSQLTable(table))
+
+	var total int64
+	if s.isPartitioned(table) {
+		n, err := s.dropExpiredPartitions(ctx, table, before, batchSize, archive)
+		total += n
+		if err != nil {
+			tracing.RecordError(span, err)
+			return total, err
+		}
+	}
+
+	where := spec.timeColumn + " < ?"
+	if spec.filter != "" {
+		where += " AND " + spec.filter
+	}
+	for {
+		n, err := s.expireBatch(ctx, table, where, before.UTC(), batchSize, archive)
+		total += int64(n)
+		if err != nil {
+			tracing.RecordError(span, err)
+			return total, err
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// expireBatch archives and deletes up to limit rows matching where in one transaction
+func (s *sqlStore) expireBatch(ctx context.Context, table, where string, before time.Time, limit int, archive ArchiveFunc) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin expiry of %s: %w", table, err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY id LIMIT %d", table, where, limit)
+	rows, err := queryRows(ctx, tx, s.dialect.rebind(query), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read expired %s rows: %w", table, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if err := archive(table, rows); err != nil {
+		return 0, fmt.Errorf("failed to archive %s rows: %w", table, err)
+	}
+
+	ids := make([]interface{}, len(rows))
+	for i, row := range rows {
+		ids[i] = row["id"]
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query = fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", table, placeholders)
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(query), ids...); err != nil {
+		return 0, fmt.Errorf("failed to delete expired %s rows: %w", table, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expiry of %s: %w", table, err)
+	}
+	return len(rows), nil
+}
+
+// dropExpiredPartitions archives and drops monthly partitions that end before the cutoff
+func (s *sqlStore) dropExpiredPartitions(ctx context.Context, table string, before time.Time, batchSize int, archive ArchiveFunc) (int64, error) {
+	partitions, err := s.partitions(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for name, month := range partitions {
+		if month.AddDate(0, 1, 0).After(before) {
+			continue
+		}
+
+		var lastID interface{} = int64(-1)
+		for {
+			query := fmt.Sprintf("SELECT * FROM %s WHERE id > ? ORDER BY id LIMIT %d", name, batchSize)
+			rows, err := queryRows(ctx, s.db, s.dialect.rebind(query), lastID)
+			if err != nil {
+				return total, fmt.Errorf("failed to read partition %s: %w", name, err)
+			}
+			if len(rows) == 0 {
+				break
+			}
+			if err := archive(table, rows); err != nil {
+				return total, fmt.Errorf("failed to archive partition %s: %w", name, err)
+			}
+			total += int64(len(rows))
+			lastID = rows[len(rows)-1]["id"]
+		}
+
+		if _, err := s.db.ExecContext(ctx, "DROP TABLE "+name); err != nil {
+			return total, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+	}
+	return total, nil
+}
+
+// partitions returns the monthly partitions of table keyed by name with their first day
+func (s *sqlStore) partitions(ctx context.Context, table string) (map[string]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE p.relname = $1 AND n.nspname = current_schema()`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	partitions := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan partition name: %w", err)
+		}
+		match := partitionName.FindStringSubmatch(name)
+		if match == nil || match[1] != table {
+			continue
+		}
+		month, err := time.Parse("200601", match[2])
+		if err != nil {
+			continue
+		}
+		partitions[name] = month
+	}
+	return partitions, rows.Err()
+}
+
+// Maintain creates monthly partitions for the current and next months
+func (s *sqlStore) Maintain(ctx context.Context, now time.Time) error {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, table := range s.dialect.partitioned {
+		for i := 0; i <= partitionsAhead; i++ {
+			from := start.AddDate(0, i, 0)
+			if err := s.createPartition(ctx, table, from); err != nil {
+				return fmt.Errorf("failed to create partition of %s for %s: %w", table, from.Format("2006-01"), err)
+			}
+		}
+	}
+	return nil
+}
+
+// createPartition adds the partition of table for the month starting at from
+// unless it exists. PostgreSQL refuses a partition whose range holds rows of
+// the default partition, so rows that landed there for that month are moved
+// into the new partition before it is attached.
+func (s *sqlStore) createPartition(ctx context.Context, table string, from time.Time) error {
+	name := fmt.Sprintf("%s_p%s", table, from.Format("200601"))
+	column := retentionTables[table].timeColumn
+	lower, upper := from.Format("2006-01-02"), from.AddDate(0, 1, 0).Format("2006-01-02")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	inRange := fmt.Sprintf("%s >= '%s' AND %s < '%s'", column, lower, column, upper)
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", name, table),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s_default WHERE %s", name, table, inRange),
+		fmt.Sprintf("DELETE FROM %s_default WHERE %s", table, inRange),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", table, name, lower, upper),
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) isPartitioned(table string) bool {
+	for _, t := range s.dialect.partitioned {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRows reads every row of a query into column-keyed maps
+func queryRows(ctx context.Context, q querier, query string, args ...interface{}) ([]Row, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Row
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(Row, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
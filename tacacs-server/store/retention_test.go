@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+)
+
+func TestExpireInBatches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		ctx := context.Background()
+
+		// Commands 1 to 6 are older than the cutoff
+		var batches []int
+		var archived []interface{}
+		n, err := st.Expire(ctx, TableCommands, t0.Add(5*time.Minute+time.Second), 2, func(table string, rows []Row) error {
+			if table != TableCommands {
+				t.Errorf("archived table %s, want %s", table, TableCommands)
+			}
+			batches = append(batches, len(rows))
+			for _, row := range rows {
+				archived = append(archived, row["command"])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expire: %v", err)
+		}
+		if n != 6 || !reflect.DeepEqual(batches, []int{2, 2, 2}) {
+			t.Errorf("Expire = %d in batches %v, want 6 in batches [2 2 2]", n, batches)
+		}
+		if len(archived) != 6 || archived[0] != "show running-config" {
+			t.Errorf("archived %v", archived)
+		}
+		if got := searchCommands(t, st, audit.CommandQuery{}, audit.MaxPageSize); !reflect.DeepEqual(got, []int64{7}) {
+			t.Errorf("remaining commands = %v, want [7]", got)
+		}
+
+		// Active sessions are kept whatever their age
+		n, err = st.Expire(ctx, TableSessions, t0.Add(time.Hour), 1, func(string, []Row) error { return nil })
+		if err != nil || n != 2 {
+			t.Errorf("Expire sessions = %d, %v, want 2", n, err)
+		}
+		if got := searchSessions(t, st, audit.SessionQuery{}, audit.MaxPageSize); !reflect.DeepEqual(got, []string{"s1"}) {
+			t.Errorf("remaining sessions = %v, want [s1]", got)
+		}
+	})
+}
+
+func TestExpireKeepsRowsWhoseArchiveFailed(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		errArchive := errors.New("archive unavailable")
+		calls := 0
+		n, err := st.Expire(context.Background(), TableCommands, t0.Add(time.Hour), 3, func(string, []Row) error {
+			calls++
+			if calls == 2 {
+				return errArchive
+			}
+			return nil
+		})
+		if !errors.Is(err, errArchive) || n != 3 {
+			t.Fatalf("Expire = %d, %v, want 3 and the archive error", n, err)
+		}
+		if got := searchCommands(t, st, audit.CommandQuery{}, audit.MaxPageSize); !reflect.DeepEqual(got, []int64{7, 6, 5, 4}) {
+			t.Errorf("remaining commands = %v, want the four not archived", got)
+		}
+	})
+}
+
+func TestExpireUnknownTable(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Store) {
+		if _, err := st.Expire(context.Background(), "tacacs_unknown", t0, 10, func(string, []Row) error { return nil }); err == nil {
+			t.Error("Expire accepted a table without retention")
+		}
+	})
+}
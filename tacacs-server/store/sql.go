@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+	"tacacs-zitadel-server/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dialect captures the SQL differences between the database backends
+type dialect struct {
+	system      attribute.KeyValue
+	migrations  string   // directory under migrations/ holding this dialect's scripts
+	numbered    bool     // placeholders are $1, $2 instead of ?
+	likeClause  string   // case-insensitive substring match on a single placeholder
+	regexClause string   // regular expression match on a single placeholder
+	partitioned []string // tables range-partitioned by month
+}
+
+// rebind rewrites ? placeholders for dialects using numbered placeholders
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlStore implements Store on top of database/sql; queries are written with
+// ? placeholders and rebound for dialects using numbered placeholders
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// exec runs a write statement inside a database span
+func (s *sqlStore) exec(ctx context.Context, operation, query string, args ...interface{}) error {
+	ctx, span := tracing.Tracer().Start(ctx, "db "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(s.dialect.system, semconv.DBOperation(operation))
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return err
+}
+
+func (s *sqlStore) CreateSession(ctx context.Context, session Session) error {
+	return s.execOp(ctx, Op{Kind: OpCreateSession, Session: &session})
+}
+
+func (s *sqlStore) EndSession(ctx context.Context, id, status string, endTime time.Time) error {
+	return s.execOp(ctx, Op{Kind: OpEndSession, End: &SessionEnd{ID: id, Status: status, EndTime: endTime}})
+}
+
+func (s *sqlStore) RecordCommand(ctx context.Context, cmd Command) error {
+	return s.execOp(ctx, Op{Kind: OpRecordCommand, Command: &cmd})
+}
+
+func (s *sqlStore) RecordAccounting(ctx context.Context, record AccountingRecord) error {
+	return s.execOp(ctx, Op{Kind: OpRecordAccounting, Accounting: &record})
+}
+
+func (s *sqlStore) execOp(ctx context.Context, op Op) error {
+	operation, query, args, err := statement(op)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, operation, query, args...)
+}
+
+// WriteBatch applies ops in a single transaction
+func (s *sqlStore) WriteBatch(ctx context.Context, ops []Op) error {
+	ctx, span := tracing.Tracer().Start(ctx, "db BATCH", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(s.dialect.system, semconv.DBOperation("BATCH"), attribute.Int("db.batch.size", len(ops)))
+
+	err := s.writeBatch(ctx, ops)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return err
+}
+
+func (s *sqlStore) writeBatch(ctx context.Context, ops []Op) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		_, query, args, err := statement(op)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(query), args...); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", op.Kind, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// statement returns the span operation name, query and arguments for op.
+// Session inserts ignore duplicates so replaying a spool is safe.
+func statement(op Op) (operation, query string, args []interface{}, err error) {
+	switch {
+	case op.Kind == OpCreateSession && op.Session != nil:
+		session := op.Session
+		authMode := session.AuthMode
+		if authMode == "" {
+			// Spooled before auth_mode existed
+			authMode = AuthModeOnline
+		}
+		return "INSERT tacacs_sessions",
+			`INSERT INTO tacacs_sessions (id, username, client_ip, start_time, status, auth_mode, provider)
+			 VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+			[]interface{}{session.ID, session.Username, session.NAS, session.StartTime.UTC(), session.Status, authMode, session.Provider}, nil
+	case op.Kind == OpEndSession && op.End != nil:
+		end := op.End
+		return "UPDATE tacacs_sessions",
+			`UPDATE tacacs_sessions SET end_time = ?, status = ? WHERE id = ?`,
+			[]interface{}{end.EndTime.UTC(), end.Status, end.ID}, nil
+	case op.Kind == OpRecordCommand && op.Command != nil:
+		cmd := op.Command
+		return "INSERT tacacs_commands",
+			`INSERT INTO tacacs_commands (session_id, command, timestamp, allowed)
+			 VALUES (?, ?, ?, ?)`,
+			[]interface{}{cmd.SessionID, cmd.Command, cmd.Timestamp.UTC(), cmd.Allowed}, nil
+	case op.Kind == OpRecordAccounting && op.Accounting != nil:
+		record := op.Accounting
+		encoded, err := json.Marshal(record.Args)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("failed to encode accounting args: %w", err)
+		}
+		return "INSERT tacacs_accounting",
+			`INSERT INTO tacacs_accounting (session_id, username, client_ip, flag, args, timestamp)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			[]interface{}{record.SessionID, record.Username, record.NAS, record.Flag, string(encoded), record.Timestamp.UTC()}, nil
+	default:
+		return "", "", nil, fmt.Errorf("invalid write operation: %q", op.Kind)
+	}
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// conditions accumulates WHERE clauses and their arguments
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+func (c *conditions) add(clause string, args ...interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.args = append(c.args, args...)
+}
+
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+func (s *sqlStore) SearchCommands(ctx context.Context, q audit.CommandQuery, fn func(audit.CommandRecord) error) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	after, err := audit.DecodeCursor(q.Cursor)
+	if err != nil {
+		return "", err
+	}
+
+	var cond conditions
+	if q.Username != "" {
+		cond.add("s.username = ?", q.Username)
+	}
+	if q.NAS != "" {
+		cond.add("s.client_ip = ?", q.NAS)
+	}
+	if !q.From.IsZero() {
+		cond.add("c.timestamp >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		cond.add("c.timestamp < ?", q.To.UTC())
+	}
+	if q.Contains != "" {
+		cond.add("c.command "+s.dialect.likeClause, "%"+escapeLike(q.Contains)+"%")
+	}
+	if q.Regex != "" {
+		cond.add("c.command "+s.dialect.regexClause, q.Regex)
+	}
+	if q.Allowed != nil {
+		cond.add("c.allowed = ?", *q.Allowed)
+	}
+	if q.SessionStatus != "" {
+		cond.add("s.status = ?", q.SessionStatus)
+	}
+	if after != nil {
+		id, err := strconv.ParseInt(after.ID, 10, 64)
+		if err != nil {
+			return "", audit.ErrInvalidCursor
+		}
+		cond.add("(c.timestamp, c.id) < (?, ?)", after.Time.UTC(), id)
+	}
+
+	query := `SELECT c.id, c.session_id, COALESCE(s.username, ''), COALESCE(s.client_ip, ''),
+			  c.command, c.timestamp, c.allowed, COALESCE(s.status, '')
+			  FROM tacacs_commands c LEFT JOIN tacacs_sessions s ON s.id = c.session_id` +
+		cond.where() +
+		fmt.Sprintf(" ORDER BY c.timestamp DESC, c.id DESC LIMIT %d", q.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), cond.args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to query commands: %w", err)
+	}
+	defer rows.Close()
+
+	var last audit.CommandRecord
+	count := 0
+	for rows.Next() {
+		if count == q.Limit {
+			return audit.EncodeCursor(audit.Cursor{Time: last.Timestamp, ID: strconv.FormatInt(last.ID, 10)}), nil
+		}
+		var r audit.CommandRecord
+		if err := rows.Scan(&r.ID, &r.SessionID, &r.Username, &r.NAS, &r.Command, &r.Timestamp, &r.Allowed, &r.SessionStatus); err != nil {
+			return "", fmt.Errorf("failed to scan command: %w", err)
+		}
+		if err := fn(r); err != nil {
+			return "", err
+		}
+		last = r
+		count++
+	}
+
+	return "", rows.Err()
+}
+
+func (s *sqlStore) SearchSessions(ctx context.Context, q audit.SessionQuery, fn func(audit.SessionRecord) error) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	after, err := audit.DecodeCursor(q.Cursor)
+	if err != nil {
+		return "", err
+	}
+
+	var cond conditions
+	if q.Username != "" {
+		cond.add("username = ?", q.Username)
+	}
+	if q.NAS != "" {
+		cond.add("client_ip = ?", q.NAS)
+	}
+	if !q.From.IsZero() {
+		cond.add("start_time >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		cond.add("start_time < ?", q.To.UTC())
+	}
+	if q.Status != "" {
+		cond.add("status = ?", q.Status)
+	}
+	if q.AuthMode != "" {
+		cond.add("auth_mode = ?", q.AuthMode)
+	}
+	if q.Provider != "" {
+		cond.add("provider = ?", q.Provider)
+	}
+	if after != nil {
+		cond.add("(start_time, id) < (?, ?)", after.Time.UTC(), after.ID)
+	}
+
+	query := `SELECT id, username, client_ip, start_time, end_time, status, auth_mode, provider FROM tacacs_sessions` +
+		cond.where() +
+		fmt.Sprintf(" ORDER BY start_time DESC, id DESC LIMIT %d", q.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), cond.args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var last audit.SessionRecord
+	count := 0
+	for rows.Next() {
+		if count == q.Limit {
+			return audit.EncodeCursor(audit.Cursor{Time: last.StartTime, ID: last.ID}), nil
+		}
+		var r audit.SessionRecord
+		var endTime sql.NullTime
+		if err := rows.Scan(&r.ID, &r.Username, &r.NAS, &r.StartTime, &endTime, &r.Status, &r.AuthMode, &r.Provider); err != nil {
+			return "", fmt.Errorf("failed to scan session: %w", err)
+		}
+		if endTime.Valid {
+			r.EndTime = &endTime.Time
+		}
+		if err := fn(r); err != nil {
+			return "", err
+		}
+		last = r
+		count++
+	}
+
+	return "", rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
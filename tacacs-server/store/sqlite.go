@@ -0,0 +1,48 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sync"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"modernc.org/sqlite"
+)
+
+var sqliteDialect = dialect{
+	system:      semconv.DBSystemSqlite,
+	migrations:  "sqlite",
+	likeClause:  `LIKE ? ESCAPE '\'`,
+	regexClause: "REGEXP ?",
+}
+
+var registerRegexp sync.Once
+
+// openSQLite opens (or creates) an embedded SQLite database at path
+func openSQLite(path string) (*sql.DB, error) {
+	// SQLite has no built-in REGEXP; X REGEXP Y calls regexp(Y, X)
+	registerRegexp.Do(func() {
+		sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			pattern, _ := args[0].(string)
+			value, _ := args[1].(string)
+			return regexp.MatchString(pattern, value)
+		})
+	})
+
+	dsn := fmt.Sprintf("file:%s?_time_format=sqlite&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// A single writer avoids SQLITE_BUSY between pooled connections
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	return db, nil
+}
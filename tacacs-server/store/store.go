@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+	"tacacs-zitadel-server/config"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// How a session's user was authenticated
+const (
+	AuthModeOnline     = "online"
+	AuthModeOffline    = "offline"
+	AuthModeBreakGlass = "break_glass"
+)
+
+// Session is a persisted TACACS+ session
+type Session struct {
+	ID        string
+	Username  string
+	NAS       string
+	StartTime time.Time
+	Status    string
+	AuthMode  string
+	// Provider names the authentication provider that accepted the user
+	Provider string
+}
+
+// Command is a persisted authorization decision
+type Command struct {
+	SessionID string
+	Command   string
+	Timestamp time.Time
+	Allowed   bool
+}
+
+// AccountingRecord is a persisted TACACS+ accounting packet
+type AccountingRecord struct {
+	SessionID string
+	Username  string
+	NAS       string
+	Flag      string
+	Args      []string
+	Timestamp time.Time
+}
+
+// Operation kinds carried by Op
+const (
+	OpCreateSession    = "create_session"
+	OpEndSession       = "end_session"
+	OpRecordCommand    = "record_command"
+	OpRecordAccounting = "record_accounting"
+)
+
+// SessionEnd is the payload of an OpEndSession write
+type SessionEnd struct {
+	ID      string
+	Status  string
+	EndTime time.Time
+}
+
+// Op is a single queued write; exactly one payload matching Kind is set
+type Op struct {
+	Kind       string            `json:"kind"`
+	Session    *Session          `json:"session,omitempty"`
+	End        *SessionEnd       `json:"end,omitempty"`
+	Command    *Command          `json:"command,omitempty"`
+	Accounting *AccountingRecord `json:"accounting,omitempty"`
+}
+
+// Store persists sessions, commands and accounting records and answers audit queries
+type Store interface {
+	// CreateSession keeps the existing session when the ID is taken, so a
+	// spool can be replayed; session IDs are random and never reused
+	CreateSession(ctx context.Context, session Session) error
+	EndSession(ctx context.Context, id, status string, endTime time.Time) error
+	RecordCommand(ctx context.Context, cmd Command) error
+	RecordAccounting(ctx context.Context, record AccountingRecord) error
+	// WriteBatch applies ops in order, atomically where the backend allows
+	WriteBatch(ctx context.Context, ops []Op) error
+
+	audit.Searcher
+
+	// Expire hands rows of table older than before to archive in batches and
+	// deletes each batch once archive returns nil
+	Expire(ctx context.Context, table string, before time.Time, batchSize int, archive ArchiveFunc) (int64, error)
+	// Maintain prepares storage for upcoming writes, such as future partitions
+	Maintain(ctx context.Context, now time.Time) error
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Open creates the store selected by cfg.StoreBackend. SQL backends are
+// migrated to the latest schema when cfg.DBAutoMigrate is set; otherwise Open
+// fails unless the schema is already current.
+func Open(ctx context.Context, cfg *config.Config) (Store, error) {
+	if cfg.StoreBackend == BackendMemory {
+		return NewMemory(), nil
+	}
+
+	migrator, err := OpenMigrator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Prepare(ctx, cfg.DBAutoMigrate); err != nil {
+		migrator.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: migrator.db, dialect: migrator.dialect}, nil
+}
+
+// OpenMigrator connects to the SQL backend selected by cfg.StoreBackend
+// without touching its schema
+func OpenMigrator(cfg *config.Config) (*Migrator, error) {
+	var (
+		db  *sql.DB
+		d   dialect
+		err error
+	)
+	switch cfg.StoreBackend {
+	case BackendPostgres:
+		db, err = openPostgres(fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName,
+		), cfg.DBSchema)
+		d = postgresDialect
+	case BackendSQLite:
+		db, err = openSQLite(cfg.SQLitePath)
+		d = sqliteDialect
+	case BackendMemory:
+		return nil, fmt.Errorf("the memory backend has no schema to migrate")
+	default:
+		return nil, fmt.Errorf("unknown store backend: %s", cfg.StoreBackend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(db, d)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return migrator, nil
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+	"tacacs-zitadel-server/config"
+)
+
+var t0 = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// openSQLiteStore opens a migrated SQLite store in a temporary directory
+func openSQLiteStore(t *testing.T) Store {
+	t.Helper()
+	st, err := Open(context.Background(), &config.Config{
+		StoreBackend:  BackendSQLite,
+		SQLitePath:    filepath.Join(t.TempDir(), "tacacs.db"),
+		DBAutoMigrate: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// forEachBackend runs fn against a fresh memory and SQLite store
+func forEachBackend(t *testing.T, fn func(t *testing.T, st Store)) {
+	backends := map[string]func(t *testing.T) Store{
+		BackendMemory: func(t *testing.T) Store { return NewMemory() },
+		BackendSQLite: openSQLiteStore,
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			fn(t, open(t))
+		})
+	}
+}
+
+// seed writes three sessions and seven commands; commands 5 and 6 share a timestamp
+func seed(t *testing.T, st Store) {
+	t.Helper()
+	ops := []Op{
+		{Kind: OpCreateSession, Session: &Session{ID: "s1", Username: "alice", NAS: "10.0.0.1", StartTime: t0,
+			Status: "active", AuthMode: AuthModeOnline, Provider: "zitadel"}},
+		{Kind: OpCreateSession, Session: &Session{ID: "s2", Username: "bob", NAS: "10.0.0.2", StartTime: t0.Add(time.Minute),
+			Status: "active", AuthMode: AuthModeOffline, Provider: "zitadel"}},
+		{Kind: OpCreateSession, Session: &Session{ID: "s3", Username: "alice", NAS: "10.0.0.2", StartTime: t0.Add(time.Minute),
+			Status: "active", AuthMode: AuthModeBreakGlass, Provider: "breakglass"}},
+		{Kind: OpEndSession, End: &SessionEnd{ID: "s2", Status: "terminated", EndTime: t0.Add(time.Hour)}},
+		{Kind: OpEndSession, End: &SessionEnd{ID: "s3", Status: "terminated", EndTime: t0.Add(time.Hour)}},
+	}
+	commands := []struct {
+		session string
+		command string
+		offset  time.Duration
+		allowed bool
+	}{
+		{"s1", "show running-config", 1 * time.Minute, true},
+		{"s1", "configure terminal", 2 * time.Minute, true},
+		{"s1", "interface Gi0/1", 3 * time.Minute, true},
+		{"s2", "show ip route", 4 * time.Minute, true},
+		{"s2", "reload", 5 * time.Minute, false},
+		{"s2", "show version", 5 * time.Minute, true},
+		{"s1", "echo 100%_done", 6 * time.Minute, false},
+	}
+	for _, c := range commands {
+		ops = append(ops, Op{Kind: OpRecordCommand, Command: &Command{
+			SessionID: c.session, Command: c.command, Timestamp: t0.Add(c.offset), Allowed: c.allowed,
+		}})
+	}
+	if err := st.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+}
+
+// searchCommands returns the IDs of every matching command, following cursors with the given page size
+func searchCommands(t *testing.T, st Store, q audit.CommandQuery, pageSize int) []int64 {
+	t.Helper()
+	q.Limit = pageSize
+	var ids []int64
+	for page := 0; ; page++ {
+		if page > 20 {
+			t.Fatal("cursor pagination does not terminate")
+		}
+		n := 0
+		cursor, err := st.SearchCommands(context.Background(), q, func(r audit.CommandRecord) error {
+			ids = append(ids, r.ID)
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("SearchCommands: %v", err)
+		}
+		if n > pageSize {
+			t.Fatalf("page of %d rows exceeds the limit %d", n, pageSize)
+		}
+		if cursor == "" {
+			return ids
+		}
+		q.Cursor = cursor
+	}
+}
+
+func searchSessions(t *testing.T, st Store, q audit.SessionQuery, pageSize int) []string {
+	t.Helper()
+	q.Limit = pageSize
+	var ids []string
+	for page := 0; ; page++ {
+		if page > 20 {
+			t.Fatal("cursor pagination does not terminate")
+		}
+		cursor, err := st.SearchSessions(context.Background(), q, func(r audit.SessionRecord) error {
+			ids = append(ids, r.ID)
+			if (r.Status == "active") != (r.EndTime == nil) {
+				t.Errorf("session %s has status %s and end time %v", r.ID, r.Status, r.EndTime)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("SearchSessions: %v", err)
+		}
+		if cursor == "" {
+			return ids
+		}
+		q.Cursor = cursor
+	}
+}
+
+func TestSearchCommands(t *testing.T) {
+	denied := false
+	tests := []struct {
+		name  string
+		query audit.CommandQuery
+		want  []int64
+	}{
+		{"all newest first", audit.CommandQuery{}, []int64{7, 6, 5, 4, 3, 2, 1}},
+		{"username", audit.CommandQuery{Username: "bob"}, []int64{6, 5, 4}},
+		{"nas", audit.CommandQuery{NAS: "10.0.0.1"}, []int64{7, 3, 2, 1}},
+		{"time range", audit.CommandQuery{From: t0.Add(2 * time.Minute), To: t0.Add(5 * time.Minute)}, []int64{4, 3, 2}},
+		{"contains ignores case", audit.CommandQuery{Contains: "SHOW"}, []int64{6, 4, 1}},
+		{"contains matches wildcards literally", audit.CommandQuery{Contains: "0%_"}, []int64{7}},
+		{"regex", audit.CommandQuery{Regex: "^show (ip|run)"}, []int64{4, 1}},
+		{"denied", audit.CommandQuery{Allowed: &denied}, []int64{7, 5}},
+		{"session status", audit.CommandQuery{SessionStatus: "terminated"}, []int64{6, 5, 4}},
+		{"combined", audit.CommandQuery{Username: "alice", Contains: "conf"}, []int64{2, 1}},
+	}
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := searchCommands(t, st, tt.query, audit.MaxPageSize); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ids = %v, want %v", got, tt.want)
+				}
+				// Small pages split the tied timestamps of 5 and 6 across a cursor
+				for _, size := range []int{1, 2, 3} {
+					if got := searchCommands(t, st, tt.query, size); !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("ids with page size %d = %v, want %v", size, got, tt.want)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestSearchSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query audit.SessionQuery
+		want  []string
+	}{
+		{"all newest first", audit.SessionQuery{}, []string{"s3", "s2", "s1"}},
+		{"username", audit.SessionQuery{Username: "alice"}, []string{"s3", "s1"}},
+		{"nas", audit.SessionQuery{NAS: "10.0.0.2"}, []string{"s3", "s2"}},
+		{"status", audit.SessionQuery{Status: "active"}, []string{"s1"}},
+		{"auth mode", audit.SessionQuery{AuthMode: AuthModeOffline}, []string{"s2"}},
+		{"provider", audit.SessionQuery{Provider: "breakglass"}, []string{"s3"}},
+		{"time range", audit.SessionQuery{From: t0.Add(time.Second), To: t0.Add(time.Hour)}, []string{"s3", "s2"}},
+	}
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				for _, size := range []int{1, 2, audit.MaxPageSize} {
+					if got := searchSessions(t, st, tt.query, size); !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("ids with page size %d = %v, want %v", size, got, tt.want)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestSearchRejectsInvalidCursor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		noop := func(audit.CommandRecord) error { return nil }
+		for _, cursor := range []string{"not-a-cursor", audit.EncodeCursor(audit.Cursor{Time: t0, ID: "s1"})} {
+			if _, err := st.SearchCommands(context.Background(), audit.CommandQuery{Cursor: cursor}, noop); !errors.Is(err, audit.ErrInvalidCursor) {
+				t.Errorf("SearchCommands with cursor %q = %v, want ErrInvalidCursor", cursor, err)
+			}
+		}
+	})
+}
+
+func TestCreateSessionKeepsExistingSession(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Store) {
+		seed(t, st)
+		ctx := context.Background()
+
+		// A replayed or colliding insert must not revive or replace s2
+		err := st.CreateSession(ctx, Session{ID: "s2", Username: "mallory", NAS: "10.0.0.9", StartTime: t0.Add(2 * time.Hour), Status: "active"})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		var got []audit.SessionRecord
+		if _, err := st.SearchSessions(ctx, audit.SessionQuery{Username: "mallory", Limit: audit.MaxPageSize}, func(r audit.SessionRecord) error {
+			got = append(got, r)
+			return nil
+		}); err != nil || len(got) != 0 {
+			t.Fatalf("sessions of the second insert = %v, %v, want none", got, err)
+		}
+		if _, err := st.SearchSessions(ctx, audit.SessionQuery{Username: "bob", Limit: audit.MaxPageSize}, func(r audit.SessionRecord) error {
+			got = append(got, r)
+			return nil
+		}); err != nil {
+			t.Fatalf("SearchSessions: %v", err)
+		}
+		if len(got) != 1 || got[0].ID != "s2" || got[0].Status != "terminated" || got[0].AuthMode != AuthModeOffline {
+			t.Errorf("s2 after the second insert = %+v, want it unchanged", got)
+		}
+	})
+}
@@ -0,0 +1,463 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tacacs-zitadel-server/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	spoolFile    = "audit.spool"
+	rejectedFile = "audit.rejected"
+	// writeTimeout bounds a single batch so a hung database cannot stall the writer
+	writeTimeout = 10 * time.Second
+	// enqueueTimeout bounds how long a caller waits for room in a full queue
+	enqueueTimeout = time.Second
+)
+
+var (
+	// ErrWriterClosed is returned for writes submitted after Close
+	ErrWriterClosed = errors.New("audit writer is closed")
+	// ErrQueueFull is returned for writes dropped because the queue stayed full
+	ErrQueueFull = errors.New("audit queue full")
+)
+
+// WriterOptions configures the asynchronous audit writer
+type WriterOptions struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	RetryInterval time.Duration
+	SpoolDir      string
+}
+
+// Writer is a Store whose writes are queued in memory and applied in batches
+// by a single goroutine. Batches that cannot be written are appended to an
+// on-disk spool and replayed once the database is reachable again; while the
+// spool is non-empty new batches are appended to it as well so that writes
+// reach the database in order. Delivery is at-least-once: a crash during
+// replay may repeat command and accounting rows.
+type Writer struct {
+	Store
+
+	opts   WriterOptions
+	logger *logrus.Logger
+	queue  chan Op
+
+	closeMutex sync.RWMutex
+	closed     bool
+	closing    chan struct{}
+	done       chan struct{}
+
+	// owned by the run goroutine
+	spooling bool
+}
+
+// NewWriter starts an asynchronous writer in front of st. A spool left behind
+// by a previous run is replayed before new writes reach the database.
+func NewWriter(st Store, opts WriterOptions, logger *logrus.Logger) (*Writer, error) {
+	if opts.QueueSize <= 0 || opts.BatchSize <= 0 {
+		return nil, fmt.Errorf("audit queue and batch sizes must be positive")
+	}
+	if err := os.MkdirAll(opts.SpoolDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	w := &Writer{
+		Store:   st,
+		opts:    opts,
+		logger:  logger,
+		queue:   make(chan Op, opts.QueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if info, err := os.Stat(w.path(spoolFile)); err == nil && info.Size() > 0 {
+		w.spooling = true
+		metrics.AuditSpoolBytes.Set(float64(info.Size()))
+		logger.WithField("bytes", info.Size()).Warn("Found audit spool from a previous run, replaying")
+	}
+	metrics.AuditQueueCapacity.Set(float64(opts.QueueSize))
+
+	go w.run()
+	return w, nil
+}
+
+func (w *Writer) CreateSession(ctx context.Context, session Session) error {
+	return w.enqueue(ctx, Op{Kind: OpCreateSession, Session: &session})
+}
+
+func (w *Writer) EndSession(ctx context.Context, id, status string, endTime time.Time) error {
+	return w.enqueue(ctx, Op{Kind: OpEndSession, End: &SessionEnd{ID: id, Status: status, EndTime: endTime}})
+}
+
+func (w *Writer) RecordCommand(ctx context.Context, cmd Command) error {
+	return w.enqueue(ctx, Op{Kind: OpRecordCommand, Command: &cmd})
+}
+
+func (w *Writer) RecordAccounting(ctx context.Context, record AccountingRecord) error {
+	return w.enqueue(ctx, Op{Kind: OpRecordAccounting, Accounting: &record})
+}
+
+// WriteBatch queues ops behind any writes already pending
+func (w *Writer) WriteBatch(ctx context.Context, ops []Op) error {
+	for _, op := range ops {
+		if err := w.enqueue(ctx, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue hands op to the writer. While the queue is full it waits for room
+// at most enqueueTimeout, or until ctx ends, and then drops op.
+func (w *Writer) enqueue(ctx context.Context, op Op) error {
+	w.closeMutex.RLock()
+	defer w.closeMutex.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	select {
+	case w.queue <- op:
+	default:
+		timer := time.NewTimer(enqueueTimeout)
+		defer timer.Stop()
+		select {
+		case w.queue <- op:
+		case <-timer.C:
+			metrics.AuditRecords.WithLabelValues("dropped").Inc()
+			return ErrQueueFull
+		case <-ctx.Done():
+			metrics.AuditRecords.WithLabelValues("dropped").Inc()
+			return fmt.Errorf("%w: %w", ErrQueueFull, ctx.Err())
+		}
+	}
+	metrics.AuditQueueDepth.Set(float64(len(w.queue)))
+	return nil
+}
+
+// Close drains the queue, makes a last attempt to write or spool it and closes the store
+func (w *Writer) Close() error {
+	w.closeMutex.Lock()
+	alreadyClosed := w.closed
+	w.closed = true
+	w.closeMutex.Unlock()
+
+	if !alreadyClosed {
+		close(w.closing)
+	}
+	<-w.done
+	return w.Store.Close()
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	flushTicker := time.NewTicker(w.opts.FlushInterval)
+	defer flushTicker.Stop()
+	retryTicker := time.NewTicker(w.opts.RetryInterval)
+	defer retryTicker.Stop()
+
+	if w.spooling {
+		w.replay()
+	}
+
+	batch := make([]Op, 0, w.opts.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			w.flush(batch)
+			batch = make([]Op, 0, w.opts.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case op := <-w.queue:
+			metrics.AuditQueueDepth.Set(float64(len(w.queue)))
+			batch = append(batch, op)
+			if len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-flushTicker.C:
+			flush()
+		case <-retryTicker.C:
+			if w.spooling {
+				w.replay()
+			}
+		case <-w.closing:
+			// No enqueue can be in flight once closed is set
+			for len(w.queue) > 0 {
+				batch = append(batch, <-w.queue)
+				if len(batch) >= w.opts.BatchSize {
+					flush()
+				}
+			}
+			flush()
+			metrics.AuditQueueDepth.Set(0)
+			if w.spooling {
+				w.replay()
+			}
+			return
+		}
+	}
+}
+
+// flush writes a batch, spooling it if the database rejects it
+func (w *Writer) flush(batch []Op) {
+	if w.spooling {
+		w.spool(batch)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if err := w.Store.WriteBatch(ctx, batch); err != nil {
+		w.logger.WithError(err).WithField("records", len(batch)).Warn("Audit batch failed, spooling to disk")
+		w.spooling = true
+		w.spool(batch)
+		return
+	}
+	metrics.AuditRecords.WithLabelValues("written").Add(float64(len(batch)))
+}
+
+// spool appends ops to the spool file and syncs it
+func (w *Writer) spool(ops []Op) {
+	if err := appendOps(w.path(spoolFile), ops); err != nil {
+		w.logger.WithError(err).WithField("records", len(ops)).Error("Failed to spool audit records, records lost")
+		metrics.AuditRecords.WithLabelValues("dropped").Add(float64(len(ops)))
+		return
+	}
+	metrics.AuditRecords.WithLabelValues("spooled").Add(float64(len(ops)))
+	w.updateSpoolSize()
+}
+
+// replay writes the spool back to the database. It stops at the first batch
+// that fails while the database is unreachable and keeps the remainder;
+// batches that fail against a healthy database are retried record by record
+// and records that still fail are moved to the rejected file.
+func (w *Writer) replay() {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	err := w.Store.Ping(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+
+	path := w.path(spoolFile)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		w.spooling = false
+		return
+	}
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to open audit spool")
+		return
+	}
+
+	reader := bufio.NewReader(file)
+	var offset, consumed int64
+	var ops []Op
+	complete := true
+	for {
+		// A final line without a newline was torn by a crash mid-append; it
+		// is replayed if it still decodes and rejected otherwise
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 && (readErr == nil || readErr == io.EOF) {
+			offset += int64(len(line))
+			var op Op
+			if err := json.Unmarshal(line, &op); err != nil {
+				w.logger.WithError(err).Error("Discarding unreadable audit spool entry")
+				w.reject(line)
+			} else {
+				ops = append(ops, op)
+			}
+		}
+
+		if len(ops) > 0 && (len(ops) >= w.opts.BatchSize || readErr != nil) {
+			if !w.replayBatch(ops) {
+				complete = false
+				break
+			}
+			ops = ops[:0]
+		}
+		if len(ops) == 0 {
+			consumed = offset
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				w.logger.WithError(readErr).Error("Failed to read audit spool")
+				complete = false
+			}
+			break
+		}
+	}
+	file.Close()
+
+	if complete {
+		if err := os.Remove(path); err != nil {
+			w.logger.WithError(err).Error("Failed to remove replayed audit spool")
+			return
+		}
+		w.spooling = false
+		metrics.AuditSpoolBytes.Set(0)
+		w.logger.Info("Audit spool replayed")
+		return
+	}
+	if err := truncateFront(path, consumed); err != nil {
+		w.logger.WithError(err).Error("Failed to compact audit spool")
+	}
+	w.updateSpoolSize()
+}
+
+// replayBatch reports whether ops were written or rejected; false means the
+// database went away and the batch must stay in the spool
+func (w *Writer) replayBatch(ops []Op) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	err := w.Store.WriteBatch(ctx, ops)
+	if err == nil {
+		metrics.AuditRecords.WithLabelValues("replayed").Add(float64(len(ops)))
+		return true
+	}
+	if w.Store.Ping(ctx) != nil {
+		return false
+	}
+
+	for _, op := range ops {
+		if err := w.Store.WriteBatch(ctx, []Op{op}); err != nil {
+			if w.Store.Ping(ctx) != nil {
+				return false
+			}
+			w.logger.WithError(err).WithField("kind", op.Kind).Error("Audit record rejected by database")
+			if encoded, err := json.Marshal(op); err == nil {
+				w.reject(append(encoded, '\n'))
+			}
+			continue
+		}
+		metrics.AuditRecords.WithLabelValues("replayed").Inc()
+	}
+	return true
+}
+
+// reject keeps a spool line the database will not accept for manual inspection
+func (w *Writer) reject(line []byte) {
+	metrics.AuditRecords.WithLabelValues("rejected").Inc()
+	file, err := os.OpenFile(w.path(rejectedFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to open rejected audit file")
+		return
+	}
+	defer file.Close()
+	if !bytes.HasSuffix(line, []byte{'\n'}) {
+		line = append(line, '\n')
+	}
+	if _, err := file.Write(line); err != nil {
+		w.logger.WithError(err).Error("Failed to write rejected audit record")
+	}
+}
+
+func (w *Writer) updateSpoolSize() {
+	if info, err := os.Stat(w.path(spoolFile)); err == nil {
+		metrics.AuditSpoolBytes.Set(float64(info.Size()))
+	}
+}
+
+func (w *Writer) path(name string) string {
+	return filepath.Join(w.opts.SpoolDir, name)
+}
+
+// appendOps writes ops as JSON lines to path and fsyncs before returning. A
+// line torn by an earlier crash is terminated first so the new lines stay
+// readable.
+func appendOps(path string, ops []Op) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, op := range ops {
+		if err := encoder.Encode(op); err != nil {
+			return fmt.Errorf("failed to encode audit record: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	torn, err := endsMidLine(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	data := buf.Bytes()
+	if torn {
+		data = append([]byte{'\n'}, data...)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// endsMidLine reports whether file is non-empty and lacks a trailing newline
+func endsMidLine(file *os.File) (bool, error) {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// truncateFront drops the first n bytes of path by rewriting the remainder
+// to a temporary file and renaming it into place
+func truncateFront(path string, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
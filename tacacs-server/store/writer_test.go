@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/audit"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errDown = errors.New("database down")
+
+// flakyStore is a memory store that fails every write and ping while down
+type flakyStore struct {
+	*Memory
+	down  atomic.Bool
+	block chan struct{}
+}
+
+func (f *flakyStore) WriteBatch(ctx context.Context, ops []Op) error {
+	if f.block != nil {
+		<-f.block
+	}
+	if f.down.Load() {
+		return errDown
+	}
+	return f.Memory.WriteBatch(ctx, ops)
+}
+
+func (f *flakyStore) Ping(ctx context.Context) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return nil
+}
+
+func newTestWriter(t *testing.T, st Store, dir string, queueSize int) *Writer {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	w, err := NewWriter(st, WriterOptions{
+		QueueSize:     queueSize,
+		BatchSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+		RetryInterval: 10 * time.Millisecond,
+		SpoolDir:      dir,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	return w
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func commandsIn(t *testing.T, st Store) []string {
+	t.Helper()
+	var commands []string
+	_, err := st.SearchCommands(context.Background(), audit.CommandQuery{Limit: audit.MaxPageSize}, func(r audit.CommandRecord) error {
+		commands = append([]string{r.Command}, commands...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SearchCommands: %v", err)
+	}
+	return commands
+}
+
+func commandOp(command string, offset time.Duration) Op {
+	return Op{Kind: OpRecordCommand, Command: &Command{SessionID: "s1", Command: command, Timestamp: t0.Add(offset), Allowed: true}}
+}
+
+func spoolExists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, spoolFile))
+	return err == nil
+}
+
+func TestWriterSpoolsAndReplays(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := &flakyStore{Memory: NewMemory()}
+	st.down.Store(true)
+	w := newTestWriter(t, st, dir, 16)
+	defer w.Close()
+
+	if err := w.CreateSession(ctx, Session{ID: "s1", Username: "alice", NAS: "10.0.0.1", StartTime: t0, Status: "active"}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	for i, command := range []string{"show version", "configure terminal", "exit"} {
+		if err := w.WriteBatch(ctx, []Op{commandOp(command, time.Duration(i+1)*time.Second)}); err != nil {
+			t.Fatalf("WriteBatch: %v", err)
+		}
+	}
+	eventually(t, "the spool to fill", func() bool {
+		data, _ := os.ReadFile(filepath.Join(dir, spoolFile))
+		return strings.Count(string(data), "\n") == 4
+	})
+	if got := commandsIn(t, st); len(got) != 0 {
+		t.Fatalf("commands written while the database was down: %v", got)
+	}
+
+	st.down.Store(false)
+	eventually(t, "the spool to be replayed", func() bool { return !spoolExists(dir) })
+
+	want := []string{"show version", "configure terminal", "exit"}
+	if got := commandsIn(t, st); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("replayed commands = %v, want %v", got, want)
+	}
+	var sessions int
+	st.SearchSessions(ctx, audit.SessionQuery{}, func(audit.SessionRecord) error { sessions++; return nil })
+	if sessions != 1 {
+		t.Errorf("replayed %d sessions, want 1", sessions)
+	}
+}
+
+func TestWriterReplaysSpoolLeftByCrash(t *testing.T) {
+	tests := []struct {
+		name     string
+		tail     string
+		want     []string
+		rejected bool
+	}{
+		{"complete lines", "", []string{"first", "second"}, false},
+		{"readable record without newline", `{"kind":"record_command","command":{"SessionID":"s1","Command":"third","Timestamp":"2024-03-01T12:00:03Z","Allowed":true}}`,
+			[]string{"first", "second", "third"}, false},
+		{"torn record", `{"kind":"record_command","comm`, []string{"first", "second"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, spoolFile)
+			if err := appendOps(path, []Op{commandOp("first", time.Second), commandOp("second", 2*time.Second)}); err != nil {
+				t.Fatalf("appendOps: %v", err)
+			}
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				t.Fatalf("failed to open spool: %v", err)
+			}
+			file.WriteString(tt.tail)
+			file.Close()
+
+			st := NewMemory()
+			w := newTestWriter(t, st, dir, 16)
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if got := commandsIn(t, st); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("replayed commands = %v, want %v", got, tt.want)
+			}
+			if spoolExists(dir) {
+				t.Error("spool kept after a complete replay")
+			}
+			rejected, _ := os.ReadFile(filepath.Join(dir, rejectedFile))
+			if tt.rejected != (string(rejected) == tt.tail+"\n") {
+				t.Errorf("rejected file = %q", rejected)
+			}
+		})
+	}
+}
+
+func TestAppendOpsTerminatesTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), spoolFile)
+	if err := os.WriteFile(path, []byte(`{"kind":"rec`), 0o600); err != nil {
+		t.Fatalf("failed to write spool: %v", err)
+	}
+	if err := appendOps(path, []Op{commandOp("show version", time.Second)}); err != nil {
+		t.Fatalf("appendOps: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != `{"kind":"rec` || !strings.Contains(lines[1], "show version") {
+		t.Errorf("spool = %q, want the torn line followed by the new record", data)
+	}
+}
+
+func TestWriterEnqueueGivesUpWhenQueueStaysFull(t *testing.T) {
+	st := &flakyStore{Memory: NewMemory(), block: make(chan struct{})}
+	w := newTestWriter(t, st, t.TempDir(), 1)
+
+	// The writer hangs in WriteBatch, so the queue fills within a few writes
+	// and a caller without a deadline must still get its answer
+	ctx := context.Background()
+	accepted := 0
+	var err error
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		err = w.RecordCommand(ctx, Command{SessionID: "s1", Command: "show version", Timestamp: t0})
+		if err != nil {
+			if waited := time.Since(start); waited > 3*enqueueTimeout {
+				t.Errorf("RecordCommand waited %v on a full queue", waited)
+			}
+			break
+		}
+		accepted++
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("RecordCommand on a full queue = %v, want ErrQueueFull", err)
+	}
+
+	close(st.block)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := commandsIn(t, st); len(got) != accepted {
+		t.Errorf("wrote %d commands, want the %d accepted", len(got), accepted)
+	}
+}
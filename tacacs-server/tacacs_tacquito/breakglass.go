@@ -0,0 +1,73 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// breakGlassProvider is recorded as the provider of break-glass sessions
+const breakGlassProvider = "break_glass"
+
+// Reasons a break-glass account may log in
+const (
+	breakGlassActive             = "active"
+	breakGlassZitadelUnavailable = "zitadel_unavailable"
+)
+
+// breakGlassCondition returns why username may log in with its break-glass
+// account now, or "" when it may not. authErr is the result of trying the
+// auth chain first, nil if it was not tried; only the Zitadel provider being
+// unavailable or behind an open circuit counts, not any other provider.
+func (ts *TacacsServer) breakGlassCondition(username string, authErr error) string {
+	current := ts.active()
+	if current.breakGlass == nil || !current.breakGlass.Has(username) {
+		return ""
+	}
+	cfg := current.config.BreakGlass
+	switch {
+	case cfg.Active:
+		return breakGlassActive
+	case cfg.WhenZitadelUnavailable && errors.Is(auth.ProviderErr(authErr, config.ProviderZitadel), auth.ErrUnavailable):
+		return breakGlassZitadelUnavailable
+	}
+	return ""
+}
+
+// authenticateBreakGlass checks a break-glass login and raises an alert
+// whatever the result, so every use of an emergency account is noticed
+func (ts *TacacsServer) authenticateBreakGlass(ctx context.Context, username, password, nas, condition string) (*auth.UserInfo, error) {
+	current := ts.active()
+	roles, err := current.breakGlass.Verify(username, password)
+
+	result := "pass"
+	if err != nil {
+		result = "fail"
+	}
+	metrics.BreakGlassLogins.WithLabelValues(result).Inc()
+	fields := logrus.Fields{
+		"username":  username,
+		"nas":       nas,
+		"condition": condition,
+		"result":    result,
+	}
+	if condition == breakGlassZitadelUnavailable {
+		fields["provider"] = config.ProviderZitadel
+	}
+	ts.logger.Alert(ctx, "break_glass_login", fields,
+		"Break-glass account %s used from %s (%s): %s", username, nas, condition, result)
+
+	if err != nil {
+		return nil, fmt.Errorf("break-glass authentication failed: %w", err)
+	}
+	if len(roles) == 0 {
+		roles = current.config.BreakGlass.Roles
+	}
+	return &auth.UserInfo{Username: username, Roles: roles, Provider: breakGlassProvider}, nil
+}
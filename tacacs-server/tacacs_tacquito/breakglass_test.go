@@ -0,0 +1,78 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestBreakGlassCondition(t *testing.T) {
+	zitadelDown := &auth.ProviderError{Provider: config.ProviderZitadel, Err: fmt.Errorf("%w: timeout", auth.ErrUnavailable)}
+	zitadelOpen := &auth.ProviderError{Provider: config.ProviderZitadel, Err: fmt.Errorf("%w: %w", auth.ErrUnavailable, circuit.ErrOpen)}
+	oidcDown := &auth.ProviderError{Provider: config.ProviderOIDC, Err: fmt.Errorf("%w: %w", auth.ErrUnavailable, circuit.ErrOpen)}
+	zitadelRejected := &auth.ProviderError{Provider: config.ProviderZitadel, Err: errors.New("invalid credentials")}
+
+	tests := []struct {
+		name     string
+		active   bool
+		username string
+		err      error
+		want     string
+	}{
+		{"not a break-glass account", false, "alice", zitadelDown, ""},
+		{"active", true, "emergency", nil, breakGlassActive},
+		{"not tried yet", false, "emergency", nil, ""},
+		{"zitadel unavailable", false, "emergency", zitadelDown, breakGlassZitadelUnavailable},
+		{"zitadel circuit open", false, "emergency", zitadelOpen, breakGlassZitadelUnavailable},
+		{"zitadel down among others", false, "emergency", errors.Join(oidcDown, zitadelDown), breakGlassZitadelUnavailable},
+		{"only another provider down", false, "emergency", oidcDown, ""},
+		{"zitadel rejects", false, "emergency", zitadelRejected, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newLockoutTestServer(t)
+			ts.config.BreakGlass = config.BreakGlassConfig{Enabled: true, Active: tt.active, WhenZitadelUnavailable: true}
+			if got := ts.breakGlassCondition(tt.username, tt.err); got != tt.want {
+				t.Errorf("breakGlassCondition(%q, %v) = %q, want %q", tt.username, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakGlassAlertNamesProvider(t *testing.T) {
+	tests := []struct {
+		condition, password string
+		result, provider    string
+	}{
+		{breakGlassZitadelUnavailable, "emergency-password", "pass", config.ProviderZitadel},
+		{breakGlassZitadelUnavailable, "wrong", "fail", config.ProviderZitadel},
+		{breakGlassActive, "emergency-password", "pass", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition+"/"+tt.result, func(t *testing.T) {
+			ts := newLockoutTestServer(t)
+			ts.config.BreakGlass = config.BreakGlassConfig{Enabled: true, WhenZitadelUnavailable: true, Roles: []string{"network-admin"}}
+			hook := test.NewLocal(ts.logger.logger)
+
+			info, err := ts.authenticateBreakGlass(context.Background(), "emergency", tt.password, "10.0.0.1", tt.condition)
+			if (err == nil) != (tt.result == "pass") {
+				t.Fatalf("authenticateBreakGlass = %+v, %v, want %s", info, err, tt.result)
+			}
+			entry := hook.LastEntry()
+			if entry == nil || entry.Data["event"] != "break_glass_login" {
+				t.Fatalf("no break_glass_login alert, last entry %+v", entry)
+			}
+			provider, _ := entry.Data["provider"].(string)
+			if entry.Data["result"] != tt.result || entry.Data["condition"] != tt.condition || provider != tt.provider {
+				t.Errorf("alert fields = %v, want result %s and provider %q", entry.Data, tt.result, tt.provider)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package tacacs_tacquito
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"tacacs-zitadel-server/config"
+)
+
+type clientNetwork struct {
+	name    string
+	network *net.IPNet
+	secret  []byte
+}
+
+// ClientRegistry resolves the shared secret for a NAS by its source address.
+// The most specific matching network wins; addresses outside every network
+// use the default secret, or are refused when there is none.
+type ClientRegistry struct {
+	networks      []clientNetwork
+	identities    map[string]string
+	defaultSecret []byte
+}
+
+func NewClientRegistry(clients []config.ClientConfig, defaultSecret string) (*ClientRegistry, error) {
+	r := &ClientRegistry{identities: make(map[string]string)}
+	if defaultSecret != "" {
+		r.defaultSecret = []byte(defaultSecret)
+	}
+	for _, client := range clients {
+		for _, identity := range client.Identities {
+			r.identities[strings.ToLower(identity)] = client.Name
+		}
+		for _, cidr := range client.Networks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("client %s: %w", client.Name, err)
+			}
+			r.networks = append(r.networks, clientNetwork{name: client.Name, network: network, secret: []byte(client.Secret)})
+		}
+	}
+	sort.SliceStable(r.networks, func(i, j int) bool {
+		a, _ := r.networks[i].network.Mask.Size()
+		b, _ := r.networks[j].network.Mask.Size()
+		return a > b
+	})
+	return r, nil
+}
+
+// Lookup returns the client name and secret for ip; the name is empty for the default secret
+func (r *ClientRegistry) Lookup(ip net.IP) (string, []byte, bool) {
+	for _, n := range r.networks {
+		if n.network.Contains(ip) {
+			return n.name, n.secret, true
+		}
+	}
+	if r.defaultSecret != nil {
+		return "", r.defaultSecret, true
+	}
+	return "", nil, false
+}
+
+// LookupIdentity returns the client owning the first of names that is a
+// configured certificate identity
+func (r *ClientRegistry) LookupIdentity(names []string) (string, bool) {
+	for _, name := range names {
+		if client, ok := r.identities[strings.ToLower(name)]; ok {
+			return client, true
+		}
+	}
+	return "", false
+}
@@ -1,9 +1,15 @@
 package tacacs_tacquito
 
 import (
-	"fmt"
+	"errors"
 	"time"
 
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/store"
+	"tacacs-zitadel-server/tracing"
+
 	tq "github.com/facebookincubator/tacquito"
 )
 
@@ -16,8 +22,13 @@ func NewAuthHandler(server *TacacsServer) *AuthHandler {
 }
 
 func (h *AuthHandler) Handle(response tq.Response, request tq.Request) {
+	ctx, span := tracing.Tracer().Start(request.Context, "AuthHandler.Handle")
+	defer span.End()
+	request.Context = ctx
+
 	var body tq.AuthenStart
 	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		metrics.Authentications.WithLabelValues("error", "unknown").Inc()
 		h.server.logger.Errorf(request.Context, "Failed to unmarshal authentication start: %v", err)
 		response.Reply(tq.NewAuthenReply(
 			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
@@ -27,40 +38,155 @@ func (h *AuthHandler) Handle(response tq.Response, request tq.Request) {
 	}
 
 	username := string(body.User)
+	span.SetAttributes(tracing.UserKey.String(username))
 	password := string(body.Data)
+	authenType := authenTypeName(body.Type)
 
 	h.server.logger.Infof(request.Context, "Authentication request for user: %s", username)
 
-	// Authenticate with auth provider
-	userInfo, err := h.server.authProvider.AuthenticateUser(request.Context, username, password)
+	// Locked users and sources are refused before reaching the auth provider
+	nas := nasFromContext(request.Context)
+	keys := h.server.loginKeys(username, nas, string(body.RemAddr))
+	if key, remaining, locked := h.server.lockouts.Check(keys...); locked {
+		metrics.Authentications.WithLabelValues("locked", authenType).Inc()
+		span.SetAttributes(tracing.ResultKey.String("locked"))
+		h.server.logger.Errorf(request.Context, "Authentication refused for user %s from %s: %s %q is locked for %s",
+			username, nas, key.Scope, key.Value, remaining.Round(time.Second))
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("Authentication failed"),
+		))
+		return
+	}
+
+	// Break-glass accounts skip the auth provider while break_glass.active is
+	// set and are otherwise only tried when it is unavailable
+	var userInfo *auth.UserInfo
+	var err error
+	condition := h.server.breakGlassCondition(username, nil)
+	if condition == "" {
+		// Authenticate with auth provider, unless too many calls are outstanding
+		if !h.server.acquireZitadel() {
+			metrics.Authentications.WithLabelValues("limited", authenType).Inc()
+			metrics.LimitRejections.WithLabelValues(limitZitadelConcurrency, "authentication").Inc()
+			span.SetAttributes(tracing.ResultKey.String("limited"))
+			h.server.logger.Errorf(request.Context, "Authentication for user %s refused: too many outstanding Zitadel calls", username)
+			response.Reply(tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("Authentication service busy"),
+			))
+			return
+		}
+		userInfo, err = h.server.authProvider.AuthenticateUser(request.Context, username, password)
+		h.server.releaseZitadel()
+		condition = h.server.breakGlassCondition(username, err)
+	}
+
+	authMode := store.AuthModeOnline
+	switch {
+	case condition != "":
+		authMode = store.AuthModeBreakGlass
+		span.AddEvent("break_glass_login")
+		userInfo, err = h.server.authenticateBreakGlass(request.Context, username, password, nas, condition)
+	case h.server.offlineFallback(err):
+		// While the Zitadel circuit is open, recently seen users are checked offline
+		authMode = store.AuthModeOffline
+		userInfo, err = h.server.authenticateOffline(username, password)
+	}
+	span.SetAttributes(tracing.AuthModeKey.String(authMode))
+
+	// An unreachable provider is a server error, not a wrong password
+	if errors.Is(err, auth.ErrUnavailable) {
+		metrics.Authentications.WithLabelValues("error", authenType).Inc()
+		span.SetAttributes(tracing.ResultKey.String("error"))
+		h.server.logger.Errorf(request.Context, "Authentication for user %s unavailable: %v", username, err)
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+			tq.SetAuthenReplyServerMsg("Authentication service unavailable"),
+		))
+		return
+	}
 	if err != nil {
+		metrics.Authentications.WithLabelValues("fail", authenType).Inc()
+		span.SetAttributes(tracing.ResultKey.String("fail"))
 		h.server.logger.Errorf(request.Context, "Authentication failed for user %s: %v", username, err)
+		for _, l := range h.server.lockouts.Failure(keys...) {
+			h.server.logger.Errorf(request.Context, "Too many failed logins: %s %q locked until %s (lockout %d)",
+				l.Scope, l.Value, l.LockedUntil.Format(time.RFC3339), l.Lockouts)
+		}
 		response.Reply(tq.NewAuthenReply(
 			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
 			tq.SetAuthenReplyServerMsg("Authentication failed"),
 		))
 		return
 	}
+	h.server.lockouts.Success(clearedKeys(keys)...)
+	if authMode == store.AuthModeOnline && userInfo.Provider == config.ProviderZitadel && h.server.offline != nil {
+		h.server.offline.Remember(username, password, userInfo.Provider, userInfo.Roles)
+	}
 
 	// Create session
-	sessionID := fmt.Sprintf("%s_%d", username, time.Now().Unix())
+	sessionID, err := newSessionID()
+	if err != nil {
+		metrics.Authentications.WithLabelValues("error", authenType).Inc()
+		span.SetAttributes(tracing.ResultKey.String("error"))
+		h.server.logger.Errorf(request.Context, "Session for user %s not created: %v", username, err)
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+			tq.SetAuthenReplyServerMsg("Session could not be created"),
+		))
+		return
+	}
 	session := &Session{
 		ID:        sessionID,
 		Username:  username,
-		ClientIP:  "unknown", // TODO: extract from context
+		ClientIP:  nas,
 		Roles:     userInfo.Roles,
 		StartTime: time.Now(),
 		Commands:  []Command{},
 		Active:    true,
+		AuthMode:  authMode,
+		Provider:  userInfo.Provider,
 	}
 
-	h.server.sessionsMutex.Lock()
-	h.server.sessions[sessionID] = session
-	h.server.sessionsMutex.Unlock()
-
-	h.server.recordSession(session)
+	limit, err := h.server.admitSession(session)
+	if err != nil {
+		metrics.Authentications.WithLabelValues("error", authenType).Inc()
+		span.SetAttributes(tracing.ResultKey.String("error"))
+		h.server.logger.Errorf(request.Context, "Session %s for user %s refused: %v", sessionID, username, err)
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+			tq.SetAuthenReplyServerMsg("Session could not be created"),
+		))
+		return
+	}
+	if limit != "" {
+		metrics.Authentications.WithLabelValues("limited", authenType).Inc()
+		metrics.LimitRejections.WithLabelValues(limit, "authentication").Inc()
+		span.SetAttributes(tracing.ResultKey.String("limited"))
+		h.server.logger.Errorf(request.Context, "Session for user %s refused: %s limit reached", username, limit)
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+			tq.SetAuthenReplyServerMsg("Too many sessions"),
+		))
+		return
+	}
 
-	h.server.logger.Infof(request.Context, "User %s authenticated successfully with roles: %v", userInfo.Username, userInfo.Roles)
+	h.server.recordSession(request.Context, session)
+	result := "pass"
+	switch authMode {
+	case store.AuthModeOffline:
+		result = "offline"
+		h.server.logger.Infof(request.Context, "User %s authenticated OFFLINE from cached credentials with roles: %v (privilege capped at %d)",
+			userInfo.Username, userInfo.Roles, h.server.active().config.Offline.MaxPrivilegeLevel)
+	case store.AuthModeBreakGlass:
+		result = "break_glass"
+		h.server.logger.Infof(request.Context, "User %s authenticated with a BREAK-GLASS account with roles: %v", userInfo.Username, userInfo.Roles)
+	default:
+		h.server.logger.Infof(request.Context, "User %s authenticated successfully with roles: %v", userInfo.Username, userInfo.Roles)
+	}
+	metrics.Authentications.WithLabelValues(result, authenType).Inc()
+	span.SetAttributes(tracing.ResultKey.String(result))
 
 	response.Reply(tq.NewAuthenReply(
 		tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
@@ -77,6 +203,10 @@ func NewAuthorHandler(server *TacacsServer) *AuthorHandler {
 }
 
 func (h *AuthorHandler) Handle(response tq.Response, request tq.Request) {
+	ctx, span := tracing.Tracer().Start(request.Context, "AuthorHandler.Handle")
+	defer span.End()
+	request.Context = ctx
+
 	var body tq.AuthorRequest
 	if err := tq.Unmarshal(request.Body, &body); err != nil {
 		h.server.logger.Errorf(request.Context, "Failed to unmarshal authorization request: %v", err)
@@ -88,6 +218,7 @@ func (h *AuthorHandler) Handle(response tq.Response, request tq.Request) {
 	}
 
 	username := string(body.User)
+	span.SetAttributes(tracing.UserKey.String(username))
 	
 	// Extract command from args field
 	var command string
@@ -99,20 +230,24 @@ func (h *AuthorHandler) Handle(response tq.Response, request tq.Request) {
 
 	h.server.logger.Infof(request.Context, "Authorization request for user %s, command: %s", username, command)
 
-	// Get user roles from active session
+	// Get user roles from the user's session on this NAS
+	nas := nasFromContext(request.Context)
 	h.server.sessionsMutex.RLock()
+	var sessionID string
 	var userRoles []string
-	for _, session := range h.server.sessions {
-		if session.Username == username && session.Active {
-			userRoles = session.Roles
-			break
-		}
+	var offlineCap bool
+	if session := h.server.sessionFor(username, nas); session != nil {
+		sessionID = session.ID
+		userRoles = session.Roles
+		offlineCap = h.server.anyOfflineSession(username, nas)
 	}
 	h.server.sessionsMutex.RUnlock()
 
 	// If no active session found, deny access
 	if len(userRoles) == 0 {
-		h.server.logger.Errorf(request.Context, "No active session found for user %s", username)
+		metrics.Authorizations.WithLabelValues("no_session", "none").Inc()
+		span.SetAttributes(tracing.ResultKey.String("no_session"))
+		h.server.logger.Errorf(request.Context, "No active session found for user %s on %s", username, nas)
 		response.Reply(tq.NewAuthorReply(
 			tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
 			tq.SetAuthorReplyServerMsg("No active session"),
@@ -120,9 +255,33 @@ func (h *AuthorHandler) Handle(response tq.Response, request tq.Request) {
 		return
 	}
 
-	// Check authorization using auth provider
-	allowed := h.server.authProvider.IsAuthorized(userRoles, command)
-	h.server.recordCommand(username, command, allowed)
+	// Check authorization against the policies of the listener
+	engine, err := h.server.policyFor(request.Context)
+	if err != nil {
+		h.server.logger.Errorf(request.Context, "Authorization for user %s failed: %v", username, err)
+		response.Reply(tq.NewAuthorReply(
+			tq.SetAuthorReplyStatus(tq.AuthorStatusError),
+			tq.SetAuthorReplyServerMsg("Authorization unavailable"),
+		))
+		return
+	}
+	if offlineCap {
+		engine = engine.Capped(h.server.active().config.Offline.MaxPrivilegeLevel)
+	}
+	authz := engine.Authorize(userRoles, command)
+	allowed := authz.Allowed
+	h.server.recordCommand(request.Context, sessionID, command, allowed)
+
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	decidedBy := authz.Policy
+	if decidedBy == "" {
+		decidedBy = "none"
+	}
+	metrics.Authorizations.WithLabelValues(decision, decidedBy).Inc()
+	span.SetAttributes(tracing.ResultKey.String(decision))
 
 	if allowed {
 		h.server.logger.Infof(request.Context, "Authorization granted for user %s, command: %s", username, command)
@@ -148,6 +307,10 @@ func NewAcctHandler(server *TacacsServer) *AcctHandler {
 }
 
 func (h *AcctHandler) Handle(response tq.Response, request tq.Request) {
+	ctx, span := tracing.Tracer().Start(request.Context, "AcctHandler.Handle")
+	defer span.End()
+	request.Context = ctx
+
 	var body tq.AcctRequest
 	if err := tq.Unmarshal(request.Body, &body); err != nil {
 		h.server.logger.Errorf(request.Context, "Failed to unmarshal accounting request: %v", err)
@@ -159,32 +322,78 @@ func (h *AcctHandler) Handle(response tq.Response, request tq.Request) {
 	}
 
 	username := string(body.User)
+	span.SetAttributes(tracing.UserKey.String(username))
 	h.server.logger.Infof(request.Context, "Accounting request for user %s", username)
 
-	// For accounting, we just log the session info
+	h.server.sessionsMutex.RLock()
+	var sessionID string
+	if session := h.server.sessionFor(username, nasFromContext(request.Context)); session != nil {
+		sessionID = session.ID
+	}
+	h.server.sessionsMutex.RUnlock()
+
+	var flag string
 	switch {
 	case body.Flags.Has(tq.AcctFlagStart):
+		flag = "start"
 		h.server.logger.Infof(request.Context, "Session started for user %s", username)
 	case body.Flags.Has(tq.AcctFlagStop):
+		flag = "stop"
 		h.server.logger.Infof(request.Context, "Session stopped for user %s", username)
 		
 		// Mark session as inactive
 		h.server.sessionsMutex.Lock()
-		for sessionID, session := range h.server.sessions {
-			if session.Username == username && session.Active {
-				session.Active = false
-				query := `UPDATE tacacs_sessions SET end_time = $1, status = $2 WHERE id = $3`
-				h.server.db.Exec(query, time.Now(), "completed", sessionID)
-				break
-			}
+		session, exists := h.server.sessions[sessionID]
+		stopped := exists && session.Active
+		if stopped {
+			session.Active = false
+			metrics.ActiveSessions.Dec()
 		}
 		h.server.sessionsMutex.Unlock()
+		if stopped {
+			h.server.endSession(request.Context, sessionID, "completed")
+		}
 	case body.Flags.Has(tq.AcctFlagWatchdog):
+		flag = "watchdog"
 		h.server.logger.Debugf(request.Context, "Watchdog update for user %s", username)
+	default:
+		flag = "unknown"
+	}
+	metrics.AccountingRecords.WithLabelValues(flag).Inc()
+
+	args := make([]string, 0, len(body.Args))
+	for _, arg := range body.Args {
+		args = append(args, string(arg))
 	}
+	h.server.recordAccounting(request.Context, store.AccountingRecord{
+		SessionID: sessionID,
+		Username:  username,
+		NAS:       nasFromContext(request.Context),
+		Flag:      flag,
+		Args:      args,
+		Timestamp: time.Now(),
+	})
 
 	response.Reply(tq.NewAcctReply(
 		tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
 		tq.SetAcctReplyServerMsg("Accounting recorded"),
 	))
-}
\ No newline at end of file
+}
+
+// authenTypeName maps a TACACS+ authen_type to a metric label
+func authenTypeName(t tq.AuthenType) string {
+	switch t {
+	case tq.AuthenTypeASCII:
+		return "ascii"
+	case tq.AuthenTypePAP:
+		return "pap"
+	case tq.AuthenTypeCHAP:
+		return "chap"
+	case tq.AuthenTypeMSCHAP:
+		return "mschap"
+	case tq.AuthenTypeMSCHAPV2:
+		return "mschapv2"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,65 @@
+package tacacs_tacquito
+
+import (
+	"tacacs-zitadel-server/metrics"
+)
+
+// Concurrency caps a request can exceed, next to the ratelimit scopes
+const (
+	limitZitadelConcurrency = "zitadel_concurrency"
+	limitSessions           = "sessions"
+	limitUserSessions       = "user_sessions"
+)
+
+// acquireZitadel reserves one of the outstanding Zitadel calls allowed by
+// rate_limits.zitadel_concurrency; callers that get true must call releaseZitadel
+func (ts *TacacsServer) acquireZitadel() bool {
+	limit := int64(ts.active().config.RateLimits.ZitadelConcurrency)
+	if calls := ts.zitadelCalls.Add(1); limit > 0 && calls > limit {
+		ts.zitadelCalls.Add(-1)
+		return false
+	}
+	metrics.ZitadelInflight.Inc()
+	return true
+}
+
+func (ts *TacacsServer) releaseZitadel() {
+	ts.zitadelCalls.Add(-1)
+	metrics.ZitadelInflight.Dec()
+}
+
+// admitSession adds an authenticated session unless max_concurrent_sessions
+// or max_sessions_per_user active sessions exist already, in which case it
+// returns the limit reached. A session whose ID is taken is refused with
+// ErrSessionExists rather than replacing the other one.
+func (ts *TacacsServer) admitSession(session *Session) (string, error) {
+	cfg := ts.active().config
+
+	ts.sessionsMutex.Lock()
+	defer ts.sessionsMutex.Unlock()
+
+	if _, exists := ts.sessions[session.ID]; exists {
+		return "", ErrSessionExists
+	}
+
+	total, user := 0, 0
+	for _, s := range ts.sessions {
+		if !s.Active {
+			continue
+		}
+		total++
+		if s.Username == session.Username {
+			user++
+		}
+	}
+	if total >= cfg.MaxConcurrentSessions {
+		return limitSessions, nil
+	}
+	if cfg.MaxSessionsPerUser > 0 && user >= cfg.MaxSessionsPerUser {
+		return limitUserSessions, nil
+	}
+
+	ts.sessions[session.ID] = session
+	metrics.ActiveSessions.Inc()
+	return "", nil
+}
@@ -0,0 +1,94 @@
+package tacacs_tacquito
+
+import (
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newLimitsTestServer(t *testing.T, maxSessions, maxPerUser, zitadelConcurrency int) *TacacsServer {
+	t.Helper()
+	ts := newSessionTestServer(t)
+	ts.config.MaxConcurrentSessions = maxSessions
+	ts.config.MaxSessionsPerUser = maxPerUser
+	ts.config.RateLimits.ZitadelConcurrency = zitadelConcurrency
+	ts.runtime.Store(&runtimeConfig{config: ts.config})
+	return ts
+}
+
+func TestAdmitSessionCaps(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name       string
+		maxPerUser int
+		username   string
+		want       string
+	}{
+		{"total cap", 0, "carol", limitSessions},
+		{"per-user cap", 2, "alice", limitUserSessions},
+		{"other user under the per-user cap", 2, "bob", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newLimitsTestServer(t, 3, tt.maxPerUser, 0)
+			ts.addTestSession("a1", "alice", "10.0.0.1", start)
+			ts.addTestSession("a2", "alice", "10.0.0.2", start)
+			if tt.want == limitSessions {
+				ts.addTestSession("b1", "bob", "10.0.0.1", start)
+			}
+			// Inactive sessions do not count
+			ts.addTestSession("old", tt.username, "10.0.0.1", start)
+			ts.sessions["old"].Active = false
+
+			limit, err := ts.admitSession(&Session{ID: "new", Username: tt.username, Active: true})
+			if err != nil {
+				t.Fatalf("admitSession: %v", err)
+			}
+			if limit != tt.want {
+				t.Errorf("admitSession = %q, want %q", limit, tt.want)
+			}
+			if _, admitted := ts.sessions["new"]; admitted != (tt.want == "") {
+				t.Errorf("session admitted = %v with limit %q", admitted, limit)
+			}
+		})
+	}
+}
+
+func TestAcquireZitadelConcurrency(t *testing.T) {
+	ts := newLimitsTestServer(t, 10, 0, 2)
+	inflight := testutil.ToFloat64(metrics.ZitadelInflight)
+
+	if !ts.acquireZitadel() || !ts.acquireZitadel() {
+		t.Fatal("acquireZitadel refused a call within zitadel_concurrency")
+	}
+	if ts.acquireZitadel() {
+		t.Fatal("acquireZitadel allowed a call above zitadel_concurrency")
+	}
+	if got := testutil.ToFloat64(metrics.ZitadelInflight) - inflight; got != 2 {
+		t.Errorf("zitadel inflight grew by %v, want 2", got)
+	}
+
+	ts.releaseZitadel()
+	if !ts.acquireZitadel() {
+		t.Error("acquireZitadel refused a call after one was released")
+	}
+	ts.releaseZitadel()
+	ts.releaseZitadel()
+}
+
+func TestAcquireZitadelUnlimited(t *testing.T) {
+	ts := newLimitsTestServer(t, 10, 0, 0)
+
+	for i := 0; i < 100; i++ {
+		if !ts.acquireZitadel() {
+			t.Fatalf("call %d refused with zitadel_concurrency 0", i)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		ts.releaseZitadel()
+	}
+}
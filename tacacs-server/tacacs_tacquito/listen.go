@@ -0,0 +1,76 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"tacacs-zitadel-server/config"
+)
+
+// listen binds the TCP socket of a listener, on its interface if one is set.
+// IPv6 addresses such as [::]:49 accept IPv4 clients as well unless the
+// system disables dual-stack sockets.
+func listen(lc config.ListenerConfig) (*net.TCPListener, error) {
+	var listenConfig net.ListenConfig
+	if lc.Interface != "" {
+		listenConfig.Control = bindToDevice(lc.Interface)
+	}
+	listener, err := listenConfig.Listen(context.Background(), "tcp", lc.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", lc.Address, err)
+	}
+	return listener.(*net.TCPListener), nil
+}
+
+// inflight counts requests being handled so shutdown can wait for them
+type inflight struct {
+	mutex    sync.Mutex
+	count    int
+	draining bool
+	idle     chan struct{}
+}
+
+// begin registers a request; it returns false once draining has started
+func (f *inflight) begin() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.draining {
+		return false
+	}
+	f.count++
+	return true
+}
+
+func (f *inflight) end() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count--
+	if f.draining && f.count == 0 {
+		close(f.idle)
+	}
+}
+
+// drain refuses new requests and waits until the ones in flight finish or ctx is done
+func (f *inflight) drain(ctx context.Context) error {
+	f.mutex.Lock()
+	if !f.draining {
+		f.draining = true
+		f.idle = make(chan struct{})
+		if f.count == 0 {
+			close(f.idle)
+		}
+	}
+	idle := f.idle
+	f.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		return fmt.Errorf("%d requests still in flight: %w", f.count, ctx.Err())
+	}
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package tacacs_tacquito
+
+import (
+	"syscall"
+)
+
+// bindToDevice restricts a socket to a network device, which is how a
+// listener is placed in a Linux VRF
+func bindToDevice(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
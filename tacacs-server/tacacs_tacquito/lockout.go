@@ -0,0 +1,53 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"strings"
+
+	"tacacs-zitadel-server/lockout"
+)
+
+// loginKeys lists what a login attempt counts against: the username, the NAS
+// and the rem_addr the NAS reported for the user, if any. A break-glass
+// username is counted per NAS and rem_addr instead, so failures from
+// elsewhere cannot lock the emergency account out where it is needed.
+func (ts *TacacsServer) loginKeys(username, nas, remAddr string) []lockout.Key {
+	user := lockout.Key{Scope: lockout.ScopeUser, Value: username}
+	if accounts := ts.active().breakGlass; accounts != nil && accounts.Has(username) {
+		user = lockout.Key{Scope: lockout.ScopeBreakGlass, Value: strings.Join([]string{username, nas, remAddr}, "/")}
+	}
+	keys := []lockout.Key{user}
+	if nas != "" && nas != "unknown" {
+		keys = append(keys, lockout.Key{Scope: lockout.ScopeNAS, Value: nas})
+	}
+	if remAddr != "" {
+		keys = append(keys, lockout.Key{Scope: lockout.ScopeRemAddr, Value: remAddr})
+	}
+	return keys
+}
+
+// clearedKeys are the keys a successful login resets. The NAS keeps counting
+// so one valid login does not hide a spray from it.
+func clearedKeys(keys []lockout.Key) []lockout.Key {
+	var cleared []lockout.Key
+	for _, key := range keys {
+		if key.Scope != lockout.ScopeNAS {
+			cleared = append(cleared, key)
+		}
+	}
+	return cleared
+}
+
+// ListLockouts returns the usernames, NAS and rem_addr values currently locked
+func (ts *TacacsServer) ListLockouts() []lockout.Lockout {
+	return ts.lockouts.List()
+}
+
+// Unlock lifts a lockout before it expires
+func (ts *TacacsServer) Unlock(ctx context.Context, key lockout.Key) error {
+	if err := ts.lockouts.Unlock(key); err != nil {
+		return err
+	}
+	ts.logger.Infof(ctx, "Lockout of %s %q lifted by administrator", key.Scope, key.Value)
+	return nil
+}
@@ -0,0 +1,79 @@
+package tacacs_tacquito
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tacacs-zitadel-server/breakglass"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/lockout"
+)
+
+func newLockoutTestServer(t *testing.T) *TacacsServer {
+	t.Helper()
+	hash, err := breakglass.Hash("emergency-password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "break-glass")
+	if err := os.WriteFile(path, []byte("emergency:"+hash+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write accounts: %v", err)
+	}
+	accounts, err := breakglass.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ts := newSessionTestServer(t)
+	ts.runtime.Store(&runtimeConfig{config: ts.config, breakGlass: accounts})
+	ts.lockouts = lockout.NewTracker(config.LockoutConfig{
+		Enabled: true, UserThreshold: 3, Window: 900, BaseDuration: 60, MaxDuration: 3600,
+	})
+	return ts
+}
+
+func TestBreakGlassLockoutIsPerSource(t *testing.T) {
+	// Failures come from NAS 10.0.0.1 for rem_addr 192.0.2.7
+	type source struct{ nas, remAddr string }
+	sameSource := source{"10.0.0.1", "192.0.2.7"}
+	otherNAS := source{"10.0.0.2", "192.0.2.7"}
+	otherRemAddr := source{"10.0.0.1", "192.0.2.8"}
+
+	tests := []struct {
+		name     string
+		username string
+		locked   []source
+		open     []source
+	}{
+		{"user scope locks everywhere", "alice", []source{sameSource, otherNAS, otherRemAddr}, nil},
+		{"break-glass locks only the source", "emergency", []source{sameSource}, []source{otherNAS, otherRemAddr}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newLockoutTestServer(t)
+			for i := 0; i < 3; i++ {
+				ts.lockouts.Failure(ts.loginKeys(tt.username, sameSource.nas, sameSource.remAddr)...)
+			}
+			for _, s := range tt.locked {
+				if _, _, locked := ts.lockouts.Check(ts.loginKeys(tt.username, s.nas, s.remAddr)...); !locked {
+					t.Errorf("%s is not locked from %v", tt.username, s)
+				}
+			}
+			for _, s := range tt.open {
+				if key, _, locked := ts.lockouts.Check(ts.loginKeys(tt.username, s.nas, s.remAddr)...); locked {
+					t.Errorf("%s is locked from %v by %s %q", tt.username, s, key.Scope, key.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestSuccessfulLoginKeepsNASCount(t *testing.T) {
+	ts := newLockoutTestServer(t)
+	keys := ts.loginKeys("emergency", "10.0.0.1", "192.0.2.7")
+	cleared := clearedKeys(keys)
+	if len(cleared) != 2 || cleared[0].Scope != lockout.ScopeBreakGlass || cleared[1].Scope != lockout.ScopeRemAddr {
+		t.Errorf("clearedKeys = %v, want the break-glass and rem_addr keys", cleared)
+	}
+}
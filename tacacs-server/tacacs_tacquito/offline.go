@@ -0,0 +1,52 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/offline"
+)
+
+// offlineWindow is how long after an online login a user may log in offline
+func (ts *TacacsServer) offlineWindow() time.Duration {
+	return time.Duration(ts.active().config.Offline.WindowHours) * time.Hour
+}
+
+// offlineFallback reports whether a login the auth chain answered with err
+// is checked against the offline cache: only when the Zitadel provider's
+// circuit is open, never because another provider of the chain is down
+func (ts *TacacsServer) offlineFallback(err error) bool {
+	return ts.offline != nil && errors.Is(auth.ProviderErr(err, config.ProviderZitadel), circuit.ErrOpen)
+}
+
+// authenticateOffline checks a login against the offline cache. Users
+// without a recent online login through Zitadel get auth.ErrUnavailable, as
+// if there were no cache, so they are not counted towards the brute-force
+// lockout. Entries written before the provider was recorded are Zitadel's.
+func (ts *TacacsServer) authenticateOffline(username, password string) (*auth.UserInfo, error) {
+	entry, err := ts.offline.Verify(username, password, ts.offlineWindow())
+	if err == nil && entry.Provider != "" && entry.Provider != config.ProviderZitadel {
+		err = offline.ErrNotCached
+	}
+	if errors.Is(err, offline.ErrNotCached) {
+		return nil, fmt.Errorf("%w: %w", auth.ErrUnavailable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("offline authentication failed: %w", err)
+	}
+	return &auth.UserInfo{Username: username, Roles: entry.Roles, Provider: config.ProviderZitadel}, nil
+}
+
+func (ts *TacacsServer) pruneOffline() {
+	if ts.offline == nil {
+		return
+	}
+	if err := ts.offline.Prune(ts.offlineWindow()); err != nil {
+		ts.logger.Errorf(context.Background(), "Failed to prune offline cache: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tacacs_tacquito
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/offline"
+	"tacacs-zitadel-server/store"
+)
+
+func TestOfflineFallbackOnlyForZitadelCircuit(t *testing.T) {
+	zitadelOpen := &auth.ProviderError{Provider: config.ProviderZitadel, Err: fmt.Errorf("%w: %w", auth.ErrUnavailable, circuit.ErrOpen)}
+	zitadelTimeout := &auth.ProviderError{Provider: config.ProviderZitadel, Err: fmt.Errorf("%w: timeout", auth.ErrUnavailable)}
+	oidcOpen := &auth.ProviderError{Provider: config.ProviderOIDC, Err: fmt.Errorf("%w: %w", auth.ErrUnavailable, circuit.ErrOpen)}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"zitadel circuit open", zitadelOpen, true},
+		{"zitadel and oidc circuits open", errors.Join(oidcOpen, zitadelOpen), true},
+		{"zitadel timeout", zitadelTimeout, false},
+		{"only the oidc circuit open", oidcOpen, false},
+		{"oidc open, zitadel timeout", errors.Join(zitadelTimeout, oidcOpen), false},
+		{"accepted", nil, false},
+	}
+	ts := newSessionTestServer(t)
+	if ts.offlineFallback(zitadelOpen) {
+		t.Error("fallback without an offline cache")
+	}
+	ts.offline = &offline.Cache{}
+	for _, tt := range tests {
+		if got := ts.offlineFallback(tt.err); got != tt.want {
+			t.Errorf("%s: offlineFallback = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateOfflineOnlyFromZitadelLogins(t *testing.T) {
+	ts := newSessionTestServer(t)
+	ts.config.Offline = config.OfflineConfig{Enabled: true, WindowHours: 1}
+	ts.runtime.Store(&runtimeConfig{config: ts.config})
+	cache, err := offline.Open(filepath.Join(t.TempDir(), "credentials.json"), t.Errorf)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	ts.offline = cache
+	cache.Remember("alice", "password", config.ProviderZitadel, []string{"network-admin"})
+	cache.Remember("bob", "password", config.ProviderOIDC, []string{"network-admin"})
+	cache.Close()
+
+	tests := []struct {
+		username, password string
+		wantErr            error
+	}{
+		{"alice", "password", nil},
+		{"alice", "wrong", offline.ErrMismatch},
+		{"bob", "password", auth.ErrUnavailable},
+		{"carol", "password", auth.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		info, err := ts.authenticateOffline(tt.username, tt.password)
+		if tt.wantErr == nil {
+			if err != nil || info.Provider != config.ProviderZitadel {
+				t.Errorf("authenticateOffline(%s) = %+v, %v", tt.username, info, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("authenticateOffline(%s, %s) = %v, want %v", tt.username, tt.password, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAnyOfflineSessionCapsEverySessionOnTheNAS(t *testing.T) {
+	ts := newSessionTestServer(t)
+	start := time.Now().Add(-time.Minute)
+	ts.addTestSession("online-new", "alice", "10.0.0.1", start.Add(time.Second))
+	ts.addTestSession("offline-old", "alice", "10.0.0.1", start)
+	ts.sessions["offline-old"].AuthMode = store.AuthModeOffline
+	ts.addTestSession("online-other", "alice", "10.0.0.2", start)
+
+	if got := ts.sessionIDFor("alice", "10.0.0.1"); got != "online-new" {
+		t.Fatalf("sessionFor = %q, want online-new", got)
+	}
+	if !ts.anyOfflineSession("alice", "10.0.0.1") {
+		t.Error("the online session is not capped while an offline one is active on the same NAS")
+	}
+	if ts.anyOfflineSession("alice", "10.0.0.2") {
+		t.Error("a session on another NAS is capped")
+	}
+
+	ts.sessions["offline-old"].Active = false
+	if ts.anyOfflineSession("alice", "10.0.0.1") {
+		t.Error("capped after the offline session ended")
+	}
+}
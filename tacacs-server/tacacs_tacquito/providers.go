@@ -0,0 +1,54 @@
+package tacacs_tacquito
+
+import (
+	"fmt"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/oidc"
+	"tacacs-zitadel-server/zitadel"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newAuthChain creates the providers of the configured chain; a provider
+// listed more than once is created once and shared
+func newAuthChain(cfg *config.Config, logger *logrus.Logger) (*auth.Chain, error) {
+	providers := make(map[string]auth.AuthProvider)
+	var links []auth.Link
+	for _, lc := range cfg.Providers.Links() {
+		provider, ok := providers[lc.Provider]
+		if !ok {
+			switch lc.Provider {
+			case config.ProviderZitadel:
+				client, err := zitadel.NewClient(cfg, logger)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create Zitadel client: %w", err)
+				}
+				provider = client
+			case config.ProviderOIDC:
+				client, err := oidc.NewClient(cfg, logger)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create OIDC client: %w", err)
+				}
+				provider = client
+			default:
+				return nil, fmt.Errorf("unknown authentication provider %q", lc.Provider)
+			}
+			providers[lc.Provider] = provider
+			logger.Infof("Using %s as authentication provider", lc.Provider)
+		}
+
+		links = append(links, auth.Link{
+			Name:     lc.Provider,
+			Provider: provider,
+			Rule: auth.Rule{
+				Suffixes:   lc.Match.Suffixes,
+				Realms:     lc.Match.Realms,
+				NASGroups:  lc.Match.NASGroups,
+				StripRealm: lc.StripRealm,
+			},
+		})
+	}
+	return auth.NewChain(links...), nil
+}
@@ -0,0 +1,231 @@
+package tacacs_tacquito
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a balancer may take to send the PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts every PROXY protocol version 2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyListener expects a PROXY protocol v1 or v2 header on connections from
+// trusted load balancers and reports the address it carries as the remote
+// address. Other sources connect directly and are not allowed to send one.
+type proxyListener struct {
+	*net.TCPListener
+	trusted       []*net.IPNet
+	headerTimeout time.Duration
+}
+
+func newProxyListener(listener *net.TCPListener, trustedNetworks []string) (*proxyListener, error) {
+	l := &proxyListener{TCPListener: listener, headerTimeout: proxyHeaderTimeout}
+	for _, cidr := range trustedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted network: %w", err)
+		}
+		l.trusted = append(l.trusted, network)
+	}
+	return l, nil
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.TCPListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: l.headerTimeout}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn reads the PROXY header lazily, on the first call to RemoteAddr
+// or Read, so a slow balancer cannot stall the accept loop
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.err = fmt.Errorf("invalid PROXY header from %s: %w", c.Conn.RemoteAddr(), c.err)
+			c.Conn.Close()
+			return
+		}
+		if c.remote == nil {
+			// LOCAL and UNKNOWN headers are the balancer's own health checks
+			c.remote = c.Conn.RemoteAddr()
+		}
+	})
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.err != nil {
+		return &proxyAddr{Addr: c.Conn.RemoteAddr(), err: c.err}
+	}
+	return c.remote
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// proxyAddr is the balancer address of a connection whose PROXY header was rejected
+type proxyAddr struct {
+	net.Addr
+	err error
+}
+
+// proxyError returns the PROXY header error behind addr, if any
+func proxyError(addr net.Addr) error {
+	if t, ok := addr.(*tlsAddr); ok {
+		addr = t.Addr
+	}
+	if p, ok := addr.(*proxyAddr); ok {
+		return p.err
+	}
+	return nil
+}
+
+// readProxyHeader parses a PROXY protocol v1 or v2 header. It returns a nil
+// address for headers that carry no client address.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// "PROXY UNKNOWN\r\n" is shorter than the v2 signature, so only peek
+	// as far as needed to tell the versions apart
+	prefix, err := r.Peek(len("PROXY "))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(prefix, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	if !bytes.HasPrefix(proxyV2Signature, prefix) {
+		return nil, fmt.Errorf("missing PROXY protocol signature")
+	}
+	signature, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(signature, proxyV2Signature) {
+		return nil, fmt.Errorf("missing PROXY protocol signature")
+	}
+	return readProxyV2(r)
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// A v1 header is at most 107 bytes including CRLF
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("v1 header is not terminated by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses the binary header: signature, version and command,
+// address family and protocol, length, addresses and optional TLVs
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch command {
+	case 0x0:
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("unsupported v2 command %d", command)
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	case 0x00:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported v2 address family 0x%02x", family)
+	}
+}
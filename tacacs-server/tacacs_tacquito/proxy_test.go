@@ -0,0 +1,211 @@
+package tacacs_tacquito
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyV2 builds a v2 header with the given version and command byte,
+// address family and address block
+func proxyV2(versionCommand, family byte, block []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, versionCommand, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(block)))
+	return append(header, block...)
+}
+
+// ipv4Block is a v2 TCP over IPv4 address block from 192.0.2.7:40000 to 10.0.0.1:49
+func ipv4Block() []byte {
+	block := []byte{192, 0, 2, 7, 10, 0, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(block[8:10], 40000)
+	binary.BigEndian.PutUint16(block[10:12], 49)
+	return block
+}
+
+// ipv6Block is a v2 TCP over IPv6 address block from [2001:db8::7]:40000 to [2001:db8::1]:49
+func ipv6Block() []byte {
+	block := make([]byte, 36)
+	copy(block[0:16], net.ParseIP("2001:db8::7"))
+	copy(block[16:32], net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(block[32:34], 40000)
+	binary.BigEndian.PutUint16(block[34:36], 49)
+	return block
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string // "" for a header without a client address
+		wantErr string
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 40000 49\r\n"), "192.0.2.7:40000", ""},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 40000 49\r\n"), "[2001:db8::7]:40000", ""},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", ""},
+		{"v1 UNKNOWN with addresses", []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n"), "", ""},
+		{"v1 without CR", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 40000 49\n"), "", "not terminated by CRLF"},
+		{"v1 over 107 bytes", []byte("PROXY TCP6 " + strings.Repeat("f", 100) + "\r\n"), "", "not terminated by CRLF"},
+		{"v1 TCP4 with an IPv6 address", []byte("PROXY TCP4 2001:db8::7 10.0.0.1 40000 49\r\n"), "", "invalid v1 source address"},
+		{"v1 TCP6 with an IPv4 address", []byte("PROXY TCP6 192.0.2.7 2001:db8::1 40000 49\r\n"), "", "invalid v1 source address"},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 70000 49\r\n"), "", "invalid v1 source port"},
+		{"v1 missing field", []byte("PROXY TCP4 192.0.2.7 10.0.0.1 40000\r\n"), "", "malformed v1 header"},
+		{"v1 other protocol", []byte("PROXY UDP4 192.0.2.7 10.0.0.1 40000 49\r\n"), "", "malformed v1 header"},
+		{"v2 PROXY IPv4", proxyV2(0x21, 0x11, ipv4Block()), "192.0.2.7:40000", ""},
+		{"v2 PROXY IPv6", proxyV2(0x21, 0x21, ipv6Block()), "[2001:db8::7]:40000", ""},
+		{"v2 PROXY IPv4 with TLVs", proxyV2(0x21, 0x11, append(ipv4Block(), 0x04, 0x00, 0x01, 0x00)), "192.0.2.7:40000", ""},
+		{"v2 LOCAL", proxyV2(0x20, 0x00, nil), "", ""},
+		{"v2 LOCAL ignores addresses", proxyV2(0x20, 0x11, ipv4Block()), "", ""},
+		{"v2 PROXY UNSPEC", proxyV2(0x21, 0x00, nil), "", ""},
+		{"v2 short IPv4 block", proxyV2(0x21, 0x11, ipv4Block()[:8]), "", "short v2 IPv4 address block"},
+		{"v2 short IPv6 block", proxyV2(0x21, 0x21, ipv6Block()[:20]), "", "short v2 IPv6 address block"},
+		{"v2 IPv6 block as IPv4", proxyV2(0x21, 0x21, ipv4Block()), "", "short v2 IPv6 address block"},
+		{"v2 truncated block", proxyV2(0x21, 0x11, ipv4Block())[:20], "", "EOF"},
+		{"v2 bad version", proxyV2(0x11, 0x11, ipv4Block()), "", "unsupported v2 version 1"},
+		{"v2 bad command", proxyV2(0x22, 0x11, ipv4Block()), "", "unsupported v2 command 2"},
+		{"v2 UDP", proxyV2(0x21, 0x12, ipv4Block()), "", "unsupported v2 address family 0x12"},
+		{"v2 bad signature", append([]byte("\r\n\r\n\x00\r\nQUIT!"), proxyV2(0x21, 0x11, ipv4Block())[12:]...), "", "missing PROXY protocol signature"},
+		{"no header", []byte("\xc0\x01\x01\x00TACACS+ packet"), "", "missing PROXY protocol signature"},
+		{"empty", nil, "", "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(tt.header, "payload"...)))
+			if tt.wantErr != "" {
+				r = bufio.NewReader(bytes.NewReader(tt.header))
+			}
+			addr, err := readProxyHeader(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readProxyHeader = %v, %v, want an error containing %q", addr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyHeader: %v", err)
+			}
+			if got := ""; addr != nil {
+				got = addr.String()
+				if got != tt.want {
+					t.Errorf("readProxyHeader = %s, want %s", got, tt.want)
+				}
+			} else if tt.want != "" {
+				t.Errorf("readProxyHeader = nil, want %s", tt.want)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+				t.Errorf("after the header the connection reads %q, want the payload", rest)
+			}
+		})
+	}
+}
+
+// acceptProxied sends data to a proxy listener trusting trusted and
+// returns the accepted connection
+func acceptProxied(t *testing.T, trusted string, timeout time.Duration, data []byte) net.Conn {
+	t.Helper()
+	tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { tcp.Close() })
+	listener, err := newProxyListener(tcp, []string{trusted})
+	if err != nil {
+		t.Fatalf("newProxyListener: %v", err)
+	}
+	if listener.headerTimeout != proxyHeaderTimeout {
+		t.Errorf("header timeout %v, want %v", listener.headerTimeout, proxyHeaderTimeout)
+	}
+	listener.headerTimeout = timeout
+
+	client, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.Write(data); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestProxyListenerTrust(t *testing.T) {
+	header := "PROXY TCP4 192.0.2.7 10.0.0.1 40000 49\r\n"
+	tests := []struct {
+		name       string
+		trusted    string
+		data       string
+		wantRemote string // "" for the balancer itself
+		wantRead   string
+		wantErr    bool
+	}{
+		{"trusted balancer", "127.0.0.0/8", header + "payload", "192.0.2.7:40000", "payload", false},
+		{"trusted balancer health check", "127.0.0.0/8", "PROXY UNKNOWN\r\npayload", "", "payload", false},
+		{"trusted balancer health check sending nothing more", "127.0.0.0/8", "PROXY UNKNOWN\r\n", "", "", false},
+		{"trusted source without a header", "127.0.0.0/8", "payload-without-header", "", "", true},
+		{"untrusted source sending a header", "10.0.0.0/8", header + "payload", "", header + "payload", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptProxied(t, tt.trusted, time.Second, []byte(tt.data))
+
+			remote := conn.RemoteAddr()
+			if tt.wantErr {
+				if proxyError(remote) == nil {
+					t.Fatalf("RemoteAddr = %v, want a PROXY header error", remote)
+				}
+				if _, err := conn.Read(make([]byte, 1)); err == nil {
+					t.Error("Read succeeded after a rejected header")
+				}
+				return
+			}
+			if err := proxyError(remote); err != nil {
+				t.Fatalf("RemoteAddr: %v", err)
+			}
+			if tt.wantRemote == "" {
+				if host, _, _ := net.SplitHostPort(remote.String()); host != "127.0.0.1" {
+					t.Errorf("RemoteAddr = %v, want the peer 127.0.0.1", remote)
+				}
+			} else if remote.String() != tt.wantRemote {
+				t.Errorf("RemoteAddr = %v, want %s", remote, tt.wantRemote)
+			}
+
+			buf := make([]byte, len(tt.wantRead))
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != tt.wantRead {
+				t.Errorf("Read = %q, %v, want %q", buf, err, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderDeadline(t *testing.T) {
+	// A trusted balancer that sends half a header and stalls
+	timeout := 200 * time.Millisecond
+	conn := acceptProxied(t, "127.0.0.0/8", timeout, []byte("PROXY TCP4 192.0.2.7"))
+
+	start := time.Now()
+	remote := conn.RemoteAddr()
+	waited := time.Since(start)
+	err := proxyError(remote)
+	if err == nil {
+		t.Fatalf("RemoteAddr = %v, want a PROXY header error", remote)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("header error %v, want a timeout", err)
+	}
+	if waited < timeout || waited > 10*timeout {
+		t.Errorf("gave up after %v, want about %v", waited, timeout)
+	}
+}
@@ -0,0 +1,246 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"tacacs-zitadel-server/breakglass"
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/policy"
+)
+
+// runtimeConfig is the reloadable part of the configuration; it is replaced
+// as a whole so handlers always see a consistent client registry and policy set
+type runtimeConfig struct {
+	config    *config.Config
+	listeners map[string]*listenerRuntime
+	// breakGlass is nil unless break-glass accounts are enabled
+	breakGlass *breakglass.Accounts
+	version    string
+	generation int
+	loadedAt   time.Time
+}
+
+// listenerRuntime holds the clients and policies served on one listener
+type listenerRuntime struct {
+	clients *ClientRegistry
+	policy  *policy.Engine
+}
+
+func newRuntimeConfig(cfg *config.Config, generation int) (*runtimeConfig, error) {
+	listeners := make(map[string]*listenerRuntime, len(cfg.Listeners))
+	for _, lc := range cfg.Listeners {
+		listener, err := newListenerRuntime(cfg, lc)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", lc.Name, err)
+		}
+		listeners[lc.Name] = listener
+	}
+
+	version, err := ConfigVersion(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The accounts file is part of the version so editing it alone is reloaded
+	var accounts *breakglass.Accounts
+	if cfg.BreakGlass.Enabled {
+		if accounts, err = breakglass.Load(cfg.BreakGlass.UsersFile); err != nil {
+			return nil, err
+		}
+		version = fmt.Sprintf("%s-%s", version, accounts.Digest())
+	}
+
+	return &runtimeConfig{
+		config:     cfg,
+		listeners:  listeners,
+		breakGlass: accounts,
+		version:    version,
+		generation: generation,
+		loadedAt:   time.Now(),
+	}, nil
+}
+
+// newListenerRuntime selects the clients and policies named by lc. A listener
+// restricted to some clients does not fall back to tacacs_secret, so devices
+// outside them are refused there.
+func newListenerRuntime(cfg *config.Config, lc config.ListenerConfig) (*listenerRuntime, error) {
+	clients, defaultSecret := cfg.Clients, cfg.TACACSSecret
+	if len(lc.Clients) > 0 {
+		clients, defaultSecret = selectClients(cfg.Clients, lc.Clients), ""
+	}
+	registry, err := NewClientRegistry(clients, defaultSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load clients: %w", err)
+	}
+
+	policies := cfg.Policies
+	if len(lc.Policies) > 0 {
+		policies = selectPolicies(cfg.Policies, lc.Policies)
+	}
+	policyEngine, err := policy.New(policies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	return &listenerRuntime{clients: registry, policy: policyEngine}, nil
+}
+
+func selectClients(clients []config.ClientConfig, names []string) []config.ClientConfig {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []config.ClientConfig
+	for _, client := range clients {
+		if wanted[client.Name] {
+			selected = append(selected, client)
+		}
+	}
+	return selected
+}
+
+func selectPolicies(policies []config.PolicyConfig, names []string) []config.PolicyConfig {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []config.PolicyConfig
+	for _, p := range policies {
+		if wanted[p.Name] {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// listener returns the clients and policies of the named listener, or nil
+// if a reload removed it while it is still bound
+func (rc *runtimeConfig) listener(name string) *listenerRuntime {
+	return rc.listeners[name]
+}
+
+// ConfigVersion fingerprints the effective configuration
+func ConfigVersion(cfg *config.Config) (string, error) {
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:6]), nil
+}
+
+// ConfigStatus describes the configuration in effect and the last failed reload
+type ConfigStatus struct {
+	Version     string
+	Generation  int
+	LoadedAt    time.Time
+	LastError   string
+	LastErrorAt *time.Time
+}
+
+func (ts *TacacsServer) active() *runtimeConfig {
+	return ts.runtime.Load()
+}
+
+// ConfigStatus reports the active configuration version
+func (ts *TacacsServer) ConfigStatus() ConfigStatus {
+	current := ts.active()
+	status := ConfigStatus{
+		Version:    current.version,
+		Generation: current.generation,
+		LoadedAt:   current.loadedAt,
+	}
+
+	ts.reloadMutex.Lock()
+	defer ts.reloadMutex.Unlock()
+	if ts.reloadError != nil {
+		at := ts.reloadErrorAt
+		status.LastError = ts.reloadError.Error()
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// ReloadFrom loads and validates the configuration at path and, if it is
+// valid, atomically swaps in its clients, policies, lockout settings and
+// limits. On any error the running configuration is kept. Sessions are never
+// touched. Settings that are bound at startup, such as listeners and storage,
+// only take effect after a restart.
+func (ts *TacacsServer) ReloadFrom(path string) (changed bool, err error) {
+	ts.reloadMutex.Lock()
+	defer ts.reloadMutex.Unlock()
+
+	defer func() {
+		switch {
+		case err != nil:
+			ts.reloadError = err
+			ts.reloadErrorAt = time.Now()
+			metrics.ConfigReloads.WithLabelValues("error").Inc()
+		case changed:
+			ts.reloadError = nil
+			metrics.ConfigReloads.WithLabelValues("success").Inc()
+		}
+	}()
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return false, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return false, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	current := ts.active()
+	next, err := newRuntimeConfig(cfg, current.generation+1)
+	if err != nil {
+		return false, err
+	}
+	if next.version == current.version {
+		return false, nil
+	}
+	for _, setting := range restartOnlySettings(current.config, cfg) {
+		ts.logger.Infof(context.Background(), "Configuration change to %s requires a restart to take effect", setting)
+	}
+
+	ts.runtime.Store(next)
+	ts.lockouts.Configure(cfg.Lockout)
+	ts.limiter.Configure(cfg.RateLimits)
+	ts.logger.Infof(context.Background(), "Configuration reloaded, version %s (generation %d)", next.version, next.generation)
+	return true, nil
+}
+
+// restartOnlySettings lists settings that differ between old and new but are not reloaded
+func restartOnlySettings(old, new *config.Config) []string {
+	var changed []string
+	compare := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	compare("listeners", listenerBindings(old.Listeners), listenerBindings(new.Listeners))
+	compare("http_listen_address", old.HTTPListenAddress, new.HTTPListenAddress)
+	compare("providers", old.Providers, new.Providers)
+	compare("exporters", old.Exporters, new.Exporters)
+	compare("store_backend", old.StoreBackend, new.StoreBackend)
+	compare("offline", []interface{}{old.Offline.Enabled, old.Offline.CacheFile}, []interface{}{new.Offline.Enabled, new.Offline.CacheFile})
+	compare("database", []string{old.DBHost, old.DBPort, old.DBName, old.DBUser, old.DBPassword, old.DBSchema, old.SQLitePath},
+		[]string{new.DBHost, new.DBPort, new.DBName, new.DBUser, new.DBPassword, new.DBSchema, new.SQLitePath})
+	return changed
+}
+
+// listenerBindings strips the reloadable client and policy selection from listeners
+func listenerBindings(listeners []config.ListenerConfig) []config.ListenerConfig {
+	bindings := make([]config.ListenerConfig, 0, len(listeners))
+	for _, lc := range listeners {
+		lc.Clients, lc.Policies = nil, nil
+		bindings = append(bindings, lc)
+	}
+	return bindings
+}
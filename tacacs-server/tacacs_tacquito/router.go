@@ -1,7 +1,29 @@
 package tacacs_tacquito
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/policy"
+	"tacacs-zitadel-server/tracing"
+
 	tq "github.com/facebookincubator/tacquito"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const (
+	nasContextKey      contextKey = "nas"
+	listenerContextKey contextKey = "listener"
+)
+
+const (
+	transportLegacy = "legacy"
+	transportTLS    = "tls"
 )
 
 type RouterHandler struct {
@@ -9,6 +31,12 @@ type RouterHandler struct {
 	authHandler *AuthHandler
 	authorHandler *AuthorHandler
 	acctHandler *AcctHandler
+	nas string
+	// client is the configured client the NAS belongs to, its NAS group
+	client string
+	listener string
+	// tls is the connection of a TLS listener, nil on the legacy transport
+	tls *tls.Conn
 }
 
 func NewRouterHandler(server *TacacsServer) *RouterHandler {
@@ -20,7 +48,87 @@ func NewRouterHandler(server *TacacsServer) *RouterHandler {
 	}
 }
 
+// forListener returns a copy of the router bound to a listener
+func (r *RouterHandler) forListener(name string) *RouterHandler {
+	bound := *r
+	bound.listener = name
+	return &bound
+}
+
+// forNAS returns a copy of the router bound to the NAS address of a
+// connection and the client it was matched to
+func (r *RouterHandler) forNAS(nas, client string) *RouterHandler {
+	bound := *r
+	bound.nas = nas
+	bound.client = client
+	return &bound
+}
+
+// overTLS returns a copy of the router bound to a TLS connection
+func (r *RouterHandler) overTLS(conn *tls.Conn) *RouterHandler {
+	bound := *r
+	bound.tls = conn
+	return &bound
+}
+
+func (r *RouterHandler) transport() string {
+	if r.tls != nil {
+		return transportTLS
+	}
+	return transportLegacy
+}
+
 func (r *RouterHandler) Handle(response tq.Response, request tq.Request) {
+	if request.Context == nil {
+		request.Context = context.Background()
+	}
+	// Requests arriving while the server drains are dropped with their connection
+	if !r.server.inflight.begin() {
+		return
+	}
+	defer r.server.inflight.end()
+
+	request.Context = context.WithValue(request.Context, nasContextKey, r.nas)
+	request.Context = context.WithValue(request.Context, listenerContextKey, r.listener)
+	request.Context = auth.WithNASGroup(request.Context, r.client)
+
+	// RFC 9887 forbids obfuscation over TLS, so packets there must carry the
+	// unencrypted flag; on the legacy transport the flag would put
+	// credentials on the wire in clear text. Either mismatch drops the connection.
+	if request.Header.Flags.Has(tq.UnencryptedFlag) != (r.tls != nil) {
+		r.server.logger.Errorf(request.Context, "Dropping connection from %s: unencrypted flag %t on %s transport",
+			r.nas, request.Header.Flags.Has(tq.UnencryptedFlag), r.transport())
+		metrics.Connections.WithLabelValues(r.transport(), "protocol_error").Inc()
+		if r.tls != nil {
+			r.tls.Close()
+		}
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(request.Context, "tacacs "+packetTypeName(request.Header.Type),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			tracing.SessionIDKey.Int64(int64(request.Header.SessionID)),
+			tracing.NASKey.String(r.nas),
+		),
+	)
+	defer span.End()
+	request.Context = ctx
+
+	packetType := packetTypeName(request.Header.Type)
+	client := r.client
+	if client == "" {
+		client = "unknown"
+	}
+	metrics.Requests.WithLabelValues(client, packetType).Inc()
+
+	if limit, ok := r.server.limiter.Allow(r.nas, packetType); !ok {
+		metrics.LimitRejections.WithLabelValues(limit, packetType).Inc()
+		r.server.logger.Debugf(request.Context, "Refusing %s request from %s: %s rate limit exceeded", packetType, r.nas, limit)
+		replyError(response, request.Header.Type, "Rate limit exceeded")
+		return
+	}
+
 	switch request.Header.Type {
 	case tq.Authenticate:
 		r.authHandler.Handle(response, request)
@@ -33,4 +141,57 @@ func (r *RouterHandler) Handle(response tq.Response, request tq.Request) {
 		// Just close the connection for unknown types
 		return
 	}
-}
\ No newline at end of file
+}
+
+// replyError answers a request of type t with the error status of its packet type
+func replyError(response tq.Response, t tq.HeaderType, message string) {
+	switch t {
+	case tq.Authenticate:
+		response.Reply(tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+			tq.SetAuthenReplyServerMsg(message),
+		))
+	case tq.Authorize:
+		response.Reply(tq.NewAuthorReply(
+			tq.SetAuthorReplyStatus(tq.AuthorStatusError),
+			tq.SetAuthorReplyServerMsg(message),
+		))
+	case tq.Accounting:
+		response.Reply(tq.NewAcctReply(
+			tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+			tq.SetAcctReplyServerMsg(message),
+		))
+	}
+}
+
+// packetTypeName maps a TACACS+ header type to a metric and span label
+func packetTypeName(t tq.HeaderType) string {
+	switch t {
+	case tq.Authenticate:
+		return "authentication"
+	case tq.Authorize:
+		return "authorization"
+	case tq.Accounting:
+		return "accounting"
+	default:
+		return "unknown"
+	}
+}
+
+// nasFromContext returns the NAS address attached by RouterHandler
+func nasFromContext(ctx context.Context) string {
+	if nas, ok := ctx.Value(nasContextKey).(string); ok && nas != "" {
+		return nas
+	}
+	return "unknown"
+}
+
+// policyFor returns the policies of the listener a request arrived on
+func (ts *TacacsServer) policyFor(ctx context.Context) (*policy.Engine, error) {
+	name, _ := ctx.Value(listenerContextKey).(string)
+	listener := ts.active().listener(name)
+	if listener == nil {
+		return nil, fmt.Errorf("listener %q is no longer configured", name)
+	}
+	return listener.policy, nil
+}
@@ -2,19 +2,24 @@ package tacacs_tacquito
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"tacacs-zitadel-server/audit"
 	"tacacs-zitadel-server/auth"
 	"tacacs-zitadel-server/config"
-	"tacacs-zitadel-server/zitadel"
+	"tacacs-zitadel-server/lockout"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/offline"
+	"tacacs-zitadel-server/ratelimit"
+	"tacacs-zitadel-server/store"
 
 	tq "github.com/facebookincubator/tacquito"
-	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -38,6 +43,12 @@ func (l *Logger) Fatalf(ctx context.Context, format string, args ...interface{})
 	l.logger.Fatalf(format, args...)
 }
 
+// Alert logs a high-severity security event; the event and severity fields
+// let log pipelines page on it
+func (l *Logger) Alert(ctx context.Context, event string, fields logrus.Fields, format string, args ...interface{}) {
+	l.logger.WithFields(fields).WithFields(logrus.Fields{"event": event, "severity": "critical"}).Errorf(format, args...)
+}
+
 func (l *Logger) Record(ctx context.Context, r map[string]string, obscure ...string) {
 	fields := logrus.Fields{}
 	for k, v := range r {
@@ -46,25 +57,107 @@ func (l *Logger) Record(ctx context.Context, r map[string]string, obscure ...str
 	l.logger.WithFields(fields).Info("TACACS+ Record")
 }
 
+// SecretProvider resolves NAS connections on one listener
 type SecretProvider struct {
-	secret  string
-	handler tq.Handler
+	server   *TacacsServer
+	handler  *RouterHandler
+	listener string
 }
 
+// Get resolves the NAS secret from the listener's active client registry; unknown NAS addresses are refused
 func (sp *SecretProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
-	return []byte(sp.secret), sp.handler, nil
+	host := getHost(remote)
+	listener := sp.server.active().listener(sp.listener)
+	if listener == nil {
+		return nil, nil, fmt.Errorf("listener %s is no longer configured", sp.listener)
+	}
+	addr, isTLS := remote.(*tlsAddr)
+	if err := proxyError(remote); err != nil {
+		transport := transportLegacy
+		if isTLS {
+			transport = transportTLS
+		}
+		metrics.Connections.WithLabelValues(transport, "proxy_error").Inc()
+		return nil, nil, err
+	}
+	clients := listener.clients
+	if isTLS {
+		return sp.getTLS(ctx, host, addr, clients)
+	}
+
+	client, secret, ok := clients.Lookup(net.ParseIP(host))
+	if !ok {
+		metrics.Connections.WithLabelValues(transportLegacy, "refused").Inc()
+		return nil, nil, fmt.Errorf("no client configured for %s", host)
+	}
+	metrics.Connections.WithLabelValues(transportLegacy, "accepted").Inc()
+	return secret, sp.handler.forNAS(host, client), nil
+}
+
+// getTLS completes the handshake of a TLS connection and identifies the NAS
+// by its client certificate, or by its address when it presented none
+func (sp *SecretProvider) getTLS(ctx context.Context, host string, addr *tlsAddr, clients *ClientRegistry) ([]byte, tq.Handler, error) {
+	refuse := func(result string, err error) ([]byte, tq.Handler, error) {
+		addr.conn.Close()
+		metrics.Connections.WithLabelValues(transportTLS, result).Inc()
+		return nil, nil, err
+	}
+
+	cert, err := addr.handshake(ctx)
+	if err != nil {
+		return refuse("handshake_failed", fmt.Errorf("TLS handshake with %s failed: %w", host, err))
+	}
+
+	var client string
+	if cert != nil {
+		names := certificateNames(cert)
+		name, ok := clients.LookupIdentity(names)
+		if !ok {
+			return refuse("refused", fmt.Errorf("certificate of %s (%v) does not match any client identity", host, names))
+		}
+		client = name
+	} else {
+		name, _, ok := clients.Lookup(net.ParseIP(host))
+		if !ok {
+			return refuse("refused", fmt.Errorf("no client configured for %s", host))
+		}
+		client = name
+	}
+
+	metrics.Connections.WithLabelValues(transportTLS, "accepted").Inc()
+	sp.server.logger.Debugf(ctx, "TLS connection from %s identified as client %q", host, client)
+	return tlsSecret, sp.handler.forNAS(host, client).overTLS(addr.conn), nil
 }
 
+// sessionPersistTimeout bounds writing interrupted sessions during shutdown,
+// independently of the drain deadline that may already have passed
+const sessionPersistTimeout = 5 * time.Second
+
+// nasLimiterIdle is how long the rate limit buckets of a quiet NAS are kept
+const nasLimiterIdle = 10 * time.Minute
+
 type TacacsServer struct {
 	config         *config.Config
 	logger         *Logger
-	authProvider   auth.AuthProvider
-	db             *sql.DB
-	server         *tq.Server
-	listener       net.Listener
+	authProvider   *auth.Chain
+	lockouts       *lockout.Tracker
+	limiter        *ratelimit.Limiter
+	offline        *offline.Cache
+	zitadelCalls   atomic.Int64
+	runtime        atomic.Pointer[runtimeConfig]
+	reloadMutex    sync.Mutex
+	reloadError    error
+	reloadErrorAt  time.Time
+	store          store.Store
+	router         *RouterHandler
+	listeners      map[string]net.Listener
+	listenerMutex  sync.RWMutex
+	cancelServe    context.CancelFunc
+	inflight       inflight
 	wg             sync.WaitGroup
 	stopChan       chan struct{}
 	sessions       map[string]*Session
+	revoked        map[string]time.Time
 	sessionsMutex  sync.RWMutex
 }
 
@@ -76,6 +169,9 @@ type Session struct {
 	StartTime time.Time
 	Commands  []Command
 	Active    bool
+	// AuthMode is how the user was authenticated, a store.AuthMode value
+	AuthMode string
+	Provider string
 }
 
 type Command struct {
@@ -84,24 +180,17 @@ type Command struct {
 	Allowed   bool
 }
 
-func NewTacacsServer(cfg *config.Config, logger *logrus.Logger) (*TacacsServer, error) {
-	// Create Zitadel auth provider
-	authProvider, err := zitadel.NewClient(cfg, logger)
+// NewTacacsServer creates the server on top of st; the server takes
+// ownership of the store and closes it in Stop
+func NewTacacsServer(cfg *config.Config, logger *logrus.Logger, st store.Store) (*TacacsServer, error) {
+	authProvider, err := newAuthChain(cfg, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Zitadel client: %w", err)
+		return nil, err
 	}
-	logger.Info("Using Zitadel as authentication provider")
 
-	db, err := sql.Open("postgres", fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName,
-	))
+	runtime, err := newRuntimeConfig(cfg, 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
 	tqLogger := &Logger{logger: logger}
@@ -110,137 +199,282 @@ func NewTacacsServer(cfg *config.Config, logger *logrus.Logger) (*TacacsServer,
 		config:       cfg,
 		logger:       tqLogger,
 		authProvider: authProvider,
-		db:           db,
+		lockouts:     lockout.NewTracker(cfg.Lockout),
+		limiter:      ratelimit.NewLimiter(cfg.RateLimits),
+		store:        st,
+		listeners:    make(map[string]net.Listener),
 		stopChan:     make(chan struct{}),
 		sessions:     make(map[string]*Session),
+		revoked:      make(map[string]time.Time),
 	}
+	ts.runtime.Store(runtime)
 
-	// Create router handler
-	routerHandler := NewRouterHandler(ts)
-	
-	secretProvider := &SecretProvider{
-		secret:  cfg.TACACSSecret,
-		handler: routerHandler,
+	if cfg.Offline.Enabled {
+		if ts.offline, err = offline.Open(cfg.Offline.CacheFile, logger.Errorf); err != nil {
+			return nil, err
+		}
+		logger.Infof("Offline logins enabled for users seen within %d hours", cfg.Offline.WindowHours)
 	}
 
-	// Create server
-	server := tq.NewServer(tqLogger, secretProvider)
-	ts.server = server
-
-	if err := ts.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
-	}
+	ts.router = NewRouterHandler(ts)
 
+	ts.wg.Add(1)
 	go ts.cleanupRoutine()
 
 	return ts, nil
 }
 
-func (ts *TacacsServer) createTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS tacacs_sessions (
-			id VARCHAR(255) PRIMARY KEY,
-			username VARCHAR(255) NOT NULL,
-			client_ip VARCHAR(45) NOT NULL,
-			start_time TIMESTAMP NOT NULL,
-			end_time TIMESTAMP,
-			status VARCHAR(50) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS tacacs_commands (
-			id SERIAL PRIMARY KEY,
-			session_id VARCHAR(255) REFERENCES tacacs_sessions(id),
-			command TEXT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			allowed BOOLEAN NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_sessions_username ON tacacs_sessions(username)`,
-		`CREATE INDEX IF NOT EXISTS idx_sessions_start_time ON tacacs_sessions(start_time)`,
-		`CREATE INDEX IF NOT EXISTS idx_commands_session_id ON tacacs_commands(session_id)`,
-	}
-
-	for _, query := range queries {
-		if _, err := ts.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %w", err)
+// Start binds every configured listener and serves until ctx is cancelled or
+// a listener fails. Listeners start together: if any address cannot be bound,
+// none are served. Cancelling ctx only stops accepting connections; requests
+// in flight keep running until Stop drains them.
+func (ts *TacacsServer) Start(ctx context.Context) error {
+	type binding struct {
+		config   config.ListenerConfig
+		listener tq.DeadlineListener
+	}
+	var bindings []binding
+	closeAll := func() {
+		for _, b := range bindings {
+			b.listener.Close()
 		}
 	}
 
-	return nil
-}
+	for _, lc := range ts.config.Listeners {
+		listener, err := ts.bind(lc)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("listener %s: %w", lc.Name, err)
+		}
+		bindings = append(bindings, binding{lc, listener})
+	}
 
-func (ts *TacacsServer) Start() error {
-	listener, err := net.Listen("tcp", ts.config.TACACSListenAddress)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", ts.config.TACACSListenAddress, err)
+	serveCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	errs := make(chan error, len(bindings))
+	ts.listenerMutex.Lock()
+	ts.cancelServe = cancel
+	for _, b := range bindings {
+		ts.listeners[b.config.Name] = b.listener
 	}
+	ts.listenerMutex.Unlock()
 
-	tcpListener, ok := listener.(*net.TCPListener)
-	if !ok {
-		return fmt.Errorf("listener must be a TCP listener")
+	for _, b := range bindings {
+		transport := transportLegacy
+		if b.config.TLS != nil {
+			transport = transportTLS
+		}
+		ts.logger.Infof(ctx, "TACACS+ listener %s started on %s (%s)", b.config.Name, b.listener.Addr(), transport)
+
+		server := tq.NewServer(ts.logger, &SecretProvider{
+			server:   ts,
+			handler:  ts.router.forListener(b.config.Name),
+			listener: b.config.Name,
+		})
+		ts.wg.Add(1)
+		go func(name string, listener tq.DeadlineListener) {
+			defer ts.wg.Done()
+			err := server.Serve(serveCtx, listener)
+			if err != nil {
+				err = fmt.Errorf("listener %s: %w", name, err)
+			}
+			errs <- err
+		}(b.config.Name, b.listener)
 	}
 
-	ts.listener = listener
-	ts.logger.Infof(context.Background(), "TACACS+ server started on %s", ts.config.TACACSListenAddress)
+	select {
+	case <-ctx.Done():
+		ts.closeListeners()
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// bind opens the socket of a listener and layers the PROXY protocol and TLS
+// on top as configured; the PROXY header precedes the TLS handshake
+func (ts *TacacsServer) bind(lc config.ListenerConfig) (tq.DeadlineListener, error) {
+	tcpListener, err := listen(lc)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx := context.Background()
-	return ts.server.Serve(ctx, tcpListener)
+	var listener tq.DeadlineListener = tcpListener
+	if lc.ProxyProtocol != nil {
+		if listener, err = newProxyListener(tcpListener, lc.ProxyProtocol.TrustedNetworks); err != nil {
+			tcpListener.Close()
+			return nil, err
+		}
+	}
+	if lc.TLS != nil {
+		tlsConfig, err := newTLSConfig(lc.TLS)
+		if err != nil {
+			tcpListener.Close()
+			return nil, err
+		}
+		listener = &tlsListener{DeadlineListener: listener, config: tlsConfig}
+	}
+	return listener, nil
 }
 
-func (ts *TacacsServer) Stop() error {
+// Stop shuts the server down: it closes every listener, waits until ctx is
+// done for requests in flight, persists sessions that are still active as
+// interrupted and closes the store, which flushes pending audit writes
+func (ts *TacacsServer) Stop(ctx context.Context) error {
 	close(ts.stopChan)
-	
-	if ts.listener != nil {
-		ts.listener.Close()
+	cancelServe := ts.closeListeners()
+
+	err := ts.inflight.drain(ctx)
+	if err != nil {
+		ts.logger.Errorf(ctx, "Shutdown deadline reached: %v", err)
+	}
+	if cancelServe != nil {
+		cancelServe()
 	}
-	
 	ts.wg.Wait()
-	
-	if ts.db != nil {
-		ts.db.Close()
+
+	ts.interruptSessions()
+	if ts.offline != nil {
+		ts.offline.Close()
+	}
+
+	if ts.store != nil {
+		if closeErr := ts.store.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close store: %w", closeErr))
+		}
+	}
+
+	return err
+}
+
+// closeListeners stops accepting connections and returns the function that
+// cancels the serving context
+func (ts *TacacsServer) closeListeners() context.CancelFunc {
+	ts.listenerMutex.Lock()
+	defer ts.listenerMutex.Unlock()
+
+	for name, listener := range ts.listeners {
+		listener.Close()
+		delete(ts.listeners, name)
+	}
+	return ts.cancelServe
+}
+
+// interruptSessions ends every active session with status interrupted so
+// stored sessions do not stay active across a restart
+func (ts *TacacsServer) interruptSessions() {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionPersistTimeout)
+	defer cancel()
+
+	ts.sessionsMutex.Lock()
+	var interrupted []string
+	for _, session := range ts.sessions {
+		if !session.Active {
+			continue
+		}
+		session.Active = false
+		metrics.ActiveSessions.Dec()
+		interrupted = append(interrupted, session.ID)
+	}
+	ts.sessionsMutex.Unlock()
+
+	for _, sessionID := range interrupted {
+		ts.endSession(ctx, sessionID, "interrupted")
+	}
+	if len(interrupted) > 0 {
+		ts.logger.Infof(ctx, "Persisted %d active sessions as interrupted", len(interrupted))
+	}
+}
+
+// AuthProvider returns the authentication provider used by the server
+func (ts *TacacsServer) AuthProvider() auth.AuthProvider {
+	return ts.authProvider
+}
+
+// Provider returns the provider of the authentication chain named name, or nil
+func (ts *TacacsServer) Provider(name string) auth.AuthProvider {
+	return ts.authProvider.Provider(name)
+}
+
+// Searcher returns an audit searcher over the session store
+func (ts *TacacsServer) Searcher() audit.Searcher {
+	return ts.store
+}
+
+// PingDB checks that the session store is reachable
+func (ts *TacacsServer) PingDB(ctx context.Context) error {
+	return ts.store.Ping(ctx)
+}
+
+// CheckListener reports an error unless every configured TACACS+ listener is bound
+func (ts *TacacsServer) CheckListener(ctx context.Context) error {
+	ts.listenerMutex.RLock()
+	defer ts.listenerMutex.RUnlock()
+
+	for _, lc := range ts.config.Listeners {
+		if ts.listeners[lc.Name] == nil {
+			return fmt.Errorf("TACACS+ listener %s is not bound", lc.Name)
+		}
 	}
-	
 	return nil
 }
 
-func (ts *TacacsServer) recordSession(session *Session) {
-	query := `INSERT INTO tacacs_sessions (id, username, client_ip, start_time, status) 
-			  VALUES ($1, $2, $3, $4, $5)`
-	
-	_, err := ts.db.Exec(query, session.ID, session.Username, session.ClientIP, session.StartTime, "active")
+func (ts *TacacsServer) recordSession(ctx context.Context, session *Session) {
+	err := ts.store.CreateSession(ctx, store.Session{
+		ID:        session.ID,
+		Username:  session.Username,
+		NAS:       session.ClientIP,
+		StartTime: session.StartTime,
+		Status:    "active",
+		AuthMode:  session.AuthMode,
+		Provider:  session.Provider,
+	})
 	if err != nil {
-		ts.logger.Errorf(context.Background(), "Failed to record session: %v", err)
+		ts.logger.Errorf(ctx, "Failed to record session: %v", err)
 	}
 }
 
-func (ts *TacacsServer) recordCommand(username, command string, allowed bool) {
-	sessionID := ts.findActiveSession(username)
-	if sessionID == "" {
-		sessionID = fmt.Sprintf("%s_unknown_%d", username, time.Now().Unix())
-	}
+// recordCommand adds a command to the session it was authorized in and persists it
+func (ts *TacacsServer) recordCommand(ctx context.Context, sessionID, command string, allowed bool) {
+	now := time.Now()
 
-	query := `INSERT INTO tacacs_commands (session_id, command, timestamp, allowed) 
-			  VALUES ($1, $2, $3, $4)`
-	
-	_, err := ts.db.Exec(query, sessionID, command, time.Now(), allowed)
+	ts.sessionsMutex.Lock()
+	if session, exists := ts.sessions[sessionID]; exists {
+		session.Commands = append(session.Commands, Command{
+			Command:   command,
+			Timestamp: now,
+			Allowed:   allowed,
+		})
+	}
+	ts.sessionsMutex.Unlock()
+
+	err := ts.store.RecordCommand(ctx, store.Command{
+		SessionID: sessionID,
+		Command:   command,
+		Timestamp: now,
+		Allowed:   allowed,
+	})
 	if err != nil {
-		ts.logger.Errorf(context.Background(), "Failed to record command: %v", err)
+		ts.logger.Errorf(ctx, "Failed to record command: %v", err)
 	}
 }
 
-func (ts *TacacsServer) findActiveSession(username string) string {
-	ts.sessionsMutex.RLock()
-	defer ts.sessionsMutex.RUnlock()
-	
-	for sessionID, session := range ts.sessions {
-		if session.Username == username && session.Active {
-			return sessionID
-		}
+// recordAccounting persists an accounting packet
+func (ts *TacacsServer) recordAccounting(ctx context.Context, record store.AccountingRecord) {
+	if err := ts.store.RecordAccounting(ctx, record); err != nil {
+		ts.logger.Errorf(ctx, "Failed to record accounting: %v", err)
+	}
+}
+
+// endSession marks a stored session as finished with the given status
+func (ts *TacacsServer) endSession(ctx context.Context, sessionID, status string) {
+	if err := ts.store.EndSession(ctx, sessionID, status, time.Now()); err != nil {
+		ts.logger.Errorf(ctx, "Failed to end session %s: %v", sessionID, err)
 	}
-	return ""
 }
 
 func (ts *TacacsServer) cleanupRoutine() {
+	defer ts.wg.Done()
+
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
@@ -251,33 +485,58 @@ func (ts *TacacsServer) cleanupRoutine() {
 		case <-ticker.C:
 			ts.authProvider.CleanupCache()
 			ts.cleanupExpiredSessions()
+			ts.lockouts.Prune()
+			ts.limiter.Prune(nasLimiterIdle)
+			ts.pruneOffline()
 		}
 	}
 }
 
 func (ts *TacacsServer) cleanupExpiredSessions() {
 	ts.sessionsMutex.Lock()
-	defer ts.sessionsMutex.Unlock()
 	
 	timeout := time.Duration(ts.config.SessionTimeout) * time.Second
 	cutoff := time.Now().Add(-timeout)
 	
+	// Sessions started before a termination have expired by now
+	for key, revokedAt := range ts.revoked {
+		if revokedAt.Before(cutoff) {
+			delete(ts.revoked, key)
+		}
+	}
+
+	var expired []string
 	for sessionID, session := range ts.sessions {
 		if session.StartTime.Before(cutoff) {
+			if session.Active {
+				metrics.ActiveSessions.Dec()
+			}
 			session.Active = false
 			delete(ts.sessions, sessionID)
-			
-			query := `UPDATE tacacs_sessions SET end_time = $1, status = $2 WHERE id = $3`
-			ts.db.Exec(query, time.Now(), "expired", sessionID)
+			expired = append(expired, sessionID)
 		}
 	}
+	ts.sessionsMutex.Unlock()
+
+	// Persist outside the lock; a full audit queue must not stall authorization
+	for _, sessionID := range expired {
+		ts.endSession(context.Background(), sessionID, "expired")
+	}
 }
 
 // Helper function to get client IP from connection
 func getClientIP(conn net.Conn) string {
-	addr := conn.RemoteAddr().String()
-	if strings.Contains(addr, ":") {
-		return strings.Split(addr, ":")[0]
+	return getHost(conn.RemoteAddr())
+}
+
+// getHost strips the port from a network address, handling IPv6 literals
+func getHost(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return strings.Trim(addr.String(), "[]")
 	}
-	return addr
+	return host
 }
\ No newline at end of file
@@ -0,0 +1,161 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/store"
+)
+
+// ErrSessionNotFound is returned when no in-memory session has the requested ID
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionExists is returned when a new session's ID is already in use
+var ErrSessionExists = errors.New("session ID already in use")
+
+// newSessionID returns a random 128-bit session ID in hex. IDs name
+// sessions in the admin API and the audit trail, so they must not collide
+// for logins of one user in the same second and must be safe in a URL path.
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// SessionFilter selects sessions returned by ListSessions; empty fields match everything
+type SessionFilter struct {
+	Username string
+	NAS      string
+	Role     string
+}
+
+func (f SessionFilter) matches(session *Session) bool {
+	if f.Username != "" && session.Username != f.Username {
+		return false
+	}
+	if f.NAS != "" && session.ClientIP != f.NAS {
+		return false
+	}
+	if f.Role != "" {
+		for _, role := range session.Roles {
+			if role == f.Role {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ListSessions returns copies of the active sessions matching filter, oldest first
+func (ts *TacacsServer) ListSessions(filter SessionFilter) []Session {
+	ts.sessionsMutex.RLock()
+	defer ts.sessionsMutex.RUnlock()
+
+	result := []Session{}
+	for _, session := range ts.sessions {
+		if session.Active && filter.matches(session) {
+			result = append(result, copySession(session))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result
+}
+
+// GetSession returns a copy of the session with the given ID
+func (ts *TacacsServer) GetSession(id string) (Session, error) {
+	ts.sessionsMutex.RLock()
+	defer ts.sessionsMutex.RUnlock()
+
+	session, exists := ts.sessions[id]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	return copySession(session), nil
+}
+
+// sessionKey identifies the sessions of a user on one NAS
+func sessionKey(username, nas string) string {
+	return username + "\x00" + nas
+}
+
+// sessionFor returns the newest active session of username on nas that
+// started after the last termination for that user and NAS, or nil.
+// Authorization and accounting packets do not carry the session of the
+// authentication, so the user and NAS are what binds them to it. The caller
+// holds sessionsMutex.
+func (ts *TacacsServer) sessionFor(username, nas string) *Session {
+	var found *Session
+	for _, session := range ts.candidateSessions(username, nas) {
+		if found == nil || session.StartTime.After(found.StartTime) ||
+			(session.StartTime.Equal(found.StartTime) && session.ID > found.ID) {
+			found = session
+		}
+	}
+	return found
+}
+
+// anyOfflineSession reports whether any session sessionFor chooses among is
+// offline. A command cannot be told apart between them, so one offline
+// login caps the privilege of all of them. The caller holds sessionsMutex.
+func (ts *TacacsServer) anyOfflineSession(username, nas string) bool {
+	for _, session := range ts.candidateSessions(username, nas) {
+		if session.AuthMode == store.AuthModeOffline {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateSessions returns the active sessions of username on nas that
+// started after the last termination for that user and NAS
+func (ts *TacacsServer) candidateSessions(username, nas string) []*Session {
+	revokedAt := ts.revoked[sessionKey(username, nas)]
+	var candidates []*Session
+	for _, session := range ts.sessions {
+		if session.Active && session.Username == username && session.ClientIP == nas && session.StartTime.After(revokedAt) {
+			candidates = append(candidates, session)
+		}
+	}
+	return candidates
+}
+
+// TerminateSession deactivates a session and revokes its user on its NAS,
+// so later authorization requests from there are denied until the user
+// logs in again. Other sessions of the user on that NAS cannot be told
+// apart from the terminated one and are cut off with it.
+func (ts *TacacsServer) TerminateSession(ctx context.Context, id string) error {
+	ts.sessionsMutex.Lock()
+	session, exists := ts.sessions[id]
+	if !exists || !session.Active {
+		ts.sessionsMutex.Unlock()
+		return ErrSessionNotFound
+	}
+	session.Active = false
+	ts.revoked[sessionKey(session.Username, session.ClientIP)] = time.Now()
+	ts.sessionsMutex.Unlock()
+
+	metrics.ActiveSessions.Dec()
+	ts.endSession(ctx, id, "terminated")
+	ts.logger.Infof(ctx, "Session %s for user %s terminated by administrator", id, session.Username)
+
+	return nil
+}
+
+func copySession(session *Session) Session {
+	c := *session
+	c.Roles = append([]string(nil), session.Roles...)
+	c.Commands = append([]Command(nil), session.Commands...)
+	return c
+}
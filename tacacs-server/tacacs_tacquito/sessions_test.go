@@ -0,0 +1,137 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/metrics"
+	"tacacs-zitadel-server/store"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func newSessionTestServer(t *testing.T) *TacacsServer {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &TacacsServer{
+		config:   &config.Config{SessionTimeout: 3600},
+		logger:   &Logger{logger: logger},
+		store:    store.NewMemory(),
+		sessions: make(map[string]*Session),
+		revoked:  make(map[string]time.Time),
+	}
+}
+
+func (ts *TacacsServer) addTestSession(id, username, nas string, start time.Time) {
+	ts.sessions[id] = &Session{ID: id, Username: username, ClientIP: nas, StartTime: start, Active: true}
+}
+
+func (ts *TacacsServer) sessionIDFor(username, nas string) string {
+	ts.sessionsMutex.RLock()
+	defer ts.sessionsMutex.RUnlock()
+	if session := ts.sessionFor(username, nas); session != nil {
+		return session.ID
+	}
+	return ""
+}
+
+func TestSessionForBindsUserAndNAS(t *testing.T) {
+	ts := newSessionTestServer(t)
+	start := time.Now().Add(-time.Minute)
+	ts.addTestSession("a1", "alice", "10.0.0.1", start)
+	ts.addTestSession("a2", "alice", "10.0.0.1", start.Add(time.Second))
+	ts.addTestSession("b1", "alice", "10.0.0.2", start)
+
+	tests := []struct {
+		name     string
+		username string
+		nas      string
+		want     string
+	}{
+		{"newest session on the NAS", "alice", "10.0.0.1", "a2"},
+		{"other NAS", "alice", "10.0.0.2", "b1"},
+		{"unknown NAS", "alice", "10.0.0.3", ""},
+		{"other user", "bob", "10.0.0.1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ts.sessionIDFor(tt.username, tt.nas); got != tt.want {
+				t.Errorf("sessionFor(%q, %q) = %q, want %q", tt.username, tt.nas, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminateSessionRevokesUserOnNAS(t *testing.T) {
+	ts := newSessionTestServer(t)
+	start := time.Now().Add(-time.Minute)
+	ts.addTestSession("a1", "alice", "10.0.0.1", start)
+	ts.addTestSession("a2", "alice", "10.0.0.1", start.Add(time.Second))
+	ts.addTestSession("b1", "alice", "10.0.0.2", start)
+
+	if err := ts.TerminateSession(context.Background(), "a2"); err != nil {
+		t.Fatalf("TerminateSession: %v", err)
+	}
+	if got := ts.sessionIDFor("alice", "10.0.0.1"); got != "" {
+		t.Errorf("terminated NAS still authorizes through session %q", got)
+	}
+	if got := ts.sessionIDFor("alice", "10.0.0.2"); got != "b1" {
+		t.Errorf("session on another NAS = %q, want b1", got)
+	}
+	if err := ts.TerminateSession(context.Background(), "a2"); err != ErrSessionNotFound {
+		t.Errorf("second TerminateSession = %v, want ErrSessionNotFound", err)
+	}
+
+	// A new login after the termination authorizes again
+	ts.addTestSession("a3", "alice", "10.0.0.1", time.Now().Add(time.Second))
+	if got := ts.sessionIDFor("alice", "10.0.0.1"); got != "a3" {
+		t.Errorf("session after a new login = %q, want a3", got)
+	}
+}
+
+func TestNewSessionIDIsOpaqueAndUnique(t *testing.T) {
+	hex128 := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := newSessionID()
+		if err != nil {
+			t.Fatalf("newSessionID: %v", err)
+		}
+		if !hex128.MatchString(id) || seen[id] {
+			t.Fatalf("newSessionID = %q, want a new 128-bit hex ID", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestAdmitSessionRefusesTakenID(t *testing.T) {
+	ts := newSessionTestServer(t)
+	ts.config.MaxConcurrentSessions = 10
+	ts.runtime.Store(&runtimeConfig{config: ts.config})
+	start := time.Now()
+
+	// Two logins of one user in the same second, from two NAS
+	first := &Session{ID: "same", Username: "alice", ClientIP: "10.0.0.1", StartTime: start, Active: true}
+	second := &Session{ID: "same", Username: "alice", ClientIP: "10.0.0.2", StartTime: start, Active: true}
+	before := testutil.ToFloat64(metrics.ActiveSessions)
+	if limit, err := ts.admitSession(first); err != nil || limit != "" {
+		t.Fatalf("admitSession(first) = %q, %v", limit, err)
+	}
+	if limit, err := ts.admitSession(second); !errors.Is(err, ErrSessionExists) || limit != "" {
+		t.Fatalf("admitSession(second) = %q, %v, want ErrSessionExists", limit, err)
+	}
+
+	if got := testutil.ToFloat64(metrics.ActiveSessions) - before; got != 1 {
+		t.Errorf("active sessions gauge grew by %v, want 1", got)
+	}
+	if got := ts.sessionIDFor("alice", "10.0.0.1"); got != "same" {
+		t.Errorf("first session replaced: sessionFor on its NAS = %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package tacacs_tacquito
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"tacacs-zitadel-server/config"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// tlsHandshakeTimeout bounds the TLS handshake of a new NAS connection
+const tlsHandshakeTimeout = 10 * time.Second
+
+// tlsSecret stands in for the shared secret on TLS connections. RFC 9887
+// forbids obfuscation over TLS, so every packet carries the unencrypted flag
+// and the secret is never used to decode a body.
+var tlsSecret = []byte("tacacs+tls")
+
+// newTLSConfig builds a TLS 1.3 only server configuration for a listener
+func newTLSConfig(cfg *config.ListenerTLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS13,
+		ClientAuth:   tls.NoClientCert,
+	}
+	if cfg.ClientCAFile != "" {
+		pool, err := config.LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// tlsListener accepts TCP connections and wraps them in a TLS server
+// connection. The handshake runs lazily, in SecretProvider.Get, so a slow
+// client cannot stall the accept loop.
+type tlsListener struct {
+	tq.DeadlineListener
+	config *tls.Config
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	conn, err := l.DeadlineListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &tlsConn{Conn: tls.Server(conn, l.config)}, nil
+}
+
+// tlsConn exposes the TLS connection through its remote address, the only
+// connection detail tacquito hands to the SecretProvider
+type tlsConn struct {
+	*tls.Conn
+}
+
+func (c *tlsConn) RemoteAddr() net.Addr {
+	return &tlsAddr{Addr: c.Conn.RemoteAddr(), conn: c.Conn}
+}
+
+type tlsAddr struct {
+	net.Addr
+	conn *tls.Conn
+}
+
+// handshake completes the TLS handshake and returns the verified client
+// certificate, or nil if the NAS did not present one
+func (a *tlsAddr) handshake(ctx context.Context) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	if err := a.conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := a.conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	return state.PeerCertificates[0], nil
+}
+
+// certificateNames lists the names a client certificate can be mapped by:
+// DNS, URI and IP subject alternative names, then the subject common name
+func certificateNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return names
+}
@@ -3,7 +3,9 @@ package zitadel
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,14 +13,18 @@ import (
 	"time"
 
 	"tacacs-zitadel-server/auth"
+	"tacacs-zitadel-server/circuit"
 	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/httpx"
+	"tacacs-zitadel-server/metrics"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
 )
 
 type Client struct {
-	httpClient   *http.Client
+	upstream     *httpx.Upstream
+	breaker      *circuit.Breaker
 	config       *config.Config
 	logger       *logrus.Logger
 	tokenCache   map[string]*CachedToken
@@ -55,10 +61,20 @@ type ZitadelUserInfo struct {
 }
 
 func NewClient(cfg *config.Config, logger *logrus.Logger) (*Client, error) {
+	cb := cfg.Providers.Zitadel.CircuitBreaker
+	breaker := circuit.NewBreaker("zitadel", cb.FailureThreshold, time.Duration(cb.OpenSeconds)*time.Second)
 	return &Client{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+		upstream: &httpx.Upstream{
+			Name: "zitadel",
+			// Each call is bounded by the timeout of its endpoint in do
+			Client:  &http.Client{},
+			Breaker: breaker,
+			Observe: metrics.ObserveZitadel,
+			Refused: func(endpoint string) {
+				metrics.ZitadelRequests.WithLabelValues(endpoint, "circuit_open").Inc()
+			},
 		},
+		breaker:    breaker,
 		config:     cfg,
 		logger:     logger,
 		tokenCache: make(map[string]*CachedToken),
@@ -81,12 +97,12 @@ func (c *Client) getClientToken(ctx context.Context) (*TokenResponse, error) {
 		return c.clientToken, nil
 	}
 
-	tokenURL := fmt.Sprintf("%s/oauth/v2/token", c.config.ZitadelURL)
+	tokenURL := fmt.Sprintf("%s/oauth/v2/token", c.config.Providers.Zitadel.URL)
 	
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
-	data.Set("client_id", c.config.ZitadelClientID)
-	data.Set("client_secret", c.config.ZitadelClientSecret)
+	data.Set("client_id", c.config.Providers.Zitadel.ClientID)
+	data.Set("client_secret", c.config.Providers.Zitadel.ClientSecret)
 	data.Set("scope", "openid profile email urn:zitadel:iam:org:project:id:zitadel:aud")
 
 	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
@@ -96,7 +112,7 @@ func (c *Client) getClientToken(ctx context.Context) (*TokenResponse, error) {
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doIdempotent(req, "token")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client token: %w", err)
 	}
@@ -123,12 +139,14 @@ func (c *Client) AuthenticateUser(ctx context.Context, username, password string
 	c.cacheMutex.RLock()
 	if cached, exists := c.tokenCache[cacheKey]; exists && time.Now().Before(cached.Expiry) {
 		c.cacheMutex.RUnlock()
+		metrics.CacheHit("token", true)
 		return &auth.UserInfo{
 			Username: username,
 			Roles:    cached.Roles,
 		}, nil
 	}
 	c.cacheMutex.RUnlock()
+	metrics.CacheHit("token", false)
 
 	// Get user token using Resource Owner Password Credentials flow
 	token, err := c.authenticateWithPassword(ctx, username, password)
@@ -172,12 +190,12 @@ func (c *Client) AuthenticateUser(ctx context.Context, username, password string
 }
 
 func (c *Client) authenticateWithPassword(ctx context.Context, username, password string) (*TokenResponse, error) {
-	tokenURL := fmt.Sprintf("%s/oauth/v2/token", c.config.ZitadelURL)
+	tokenURL := fmt.Sprintf("%s/oauth/v2/token", c.config.Providers.Zitadel.URL)
 	
 	data := url.Values{}
 	data.Set("grant_type", "password")
-	data.Set("client_id", c.config.ZitadelClientID)
-	data.Set("client_secret", c.config.ZitadelClientSecret)
+	data.Set("client_id", c.config.Providers.Zitadel.ClientID)
+	data.Set("client_secret", c.config.Providers.Zitadel.ClientSecret)
 	data.Set("username", username)
 	data.Set("password", password)
 	data.Set("scope", "openid profile email urn:zitadel:iam:org:project:id:zitadel:aud")
@@ -189,7 +207,7 @@ func (c *Client) authenticateWithPassword(ctx context.Context, username, passwor
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, "token")
 	if err != nil {
 		return nil, fmt.Errorf("failed to authenticate: %w", err)
 	}
@@ -207,8 +225,73 @@ func (c *Client) authenticateWithPassword(ctx context.Context, username, passwor
 	return &token, nil
 }
 
+// do executes one HTTP request against Zitadel, bounded by the endpoint's
+// timeout; see httpx.Upstream.Do
+func (c *Client) do(req *http.Request, endpoint string) (*http.Response, error) {
+	return c.upstream.Do(req, endpoint, c.timeout(endpoint))
+}
+
+// doIdempotent runs do and retries calls that found Zitadel unavailable,
+// up to the configured number of retries, after an exponentially growing
+// and fully jittered pause. Calls refused by the open breaker are not retried.
+func (c *Client) doIdempotent(req *http.Request, endpoint string) (*http.Response, error) {
+	zc := c.config.Providers.Zitadel
+	backoff := time.Duration(zc.RetryBackoffMS) * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(req, endpoint)
+		if err == nil || attempt >= zc.Retries || !errors.Is(err, auth.ErrUnavailable) || errors.Is(err, circuit.ErrOpen) {
+			return resp, err
+		}
+
+		pause := time.Duration(rand.Int63n(int64(backoff<<attempt) + 1))
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"endpoint": endpoint,
+			"attempt":  attempt + 1,
+		}).Debug("Retrying Zitadel request")
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(pause):
+		}
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// timeout returns the per-attempt timeout of an endpoint
+func (c *Client) timeout(endpoint string) time.Duration {
+	timeouts := c.config.Providers.Zitadel.Timeouts
+	ms := timeouts.Management
+	switch endpoint {
+	case "token":
+		ms = timeouts.Token
+	case "userinfo":
+		ms = timeouts.UserInfo
+	case "discovery":
+		ms = timeouts.Discovery
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// CheckCircuit reports an error while the circuit breaker fails Zitadel calls fast
+func (c *Client) CheckCircuit(ctx context.Context) error {
+	return c.breaker.Check(ctx)
+}
+
+// CircuitState returns the state of the Zitadel circuit breaker
+func (c *Client) CircuitState() circuit.State {
+	return c.breaker.State()
+}
+
 func (c *Client) getUserInfo(ctx context.Context, accessToken string) (*ZitadelUserInfo, error) {
-	userInfoURL := fmt.Sprintf("%s/oidc/v1/userinfo", c.config.ZitadelURL)
+	userInfoURL := fmt.Sprintf("%s/oidc/v1/userinfo", c.config.Providers.Zitadel.URL)
 	
 	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
 	if err != nil {
@@ -217,7 +300,7 @@ func (c *Client) getUserInfo(ctx context.Context, accessToken string) (*ZitadelU
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doIdempotent(req, "userinfo")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -273,44 +356,88 @@ func (c *Client) extractRolesFromToken(accessToken string) []string {
 	return roles
 }
 
-func (c *Client) GetPrivilegeLevel(roles []string) int {
-	for _, role := range roles {
-		switch strings.ToLower(role) {
-		case "network-admin", "admin", "zitadel.admin":
-			return 15
-		case "network-user", "user", "zitadel.user":
-			return 1
-		case "network-readonly", "readonly", "viewer":
-			return 0
-		}
+// CheckDiscovery verifies that Zitadel serves its OpenID discovery document.
+// It bypasses the circuit breaker, whose state CheckCircuit reports.
+func (c *Client) CheckDiscovery(ctx context.Context) error {
+	discoveryURL := fmt.Sprintf("%s/.well-known/openid-configuration", c.config.Providers.Zitadel.URL)
+
+	req, err := http.NewRequestWithContext(httpx.WithProbe(ctx), "GET", discoveryURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.doIdempotent(req, "discovery")
+	if err != nil {
+		return fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery request failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// CheckServiceToken verifies that the service account can obtain a valid
+// client token. It bypasses the circuit breaker like CheckDiscovery.
+func (c *Client) CheckServiceToken(ctx context.Context) error {
+	token, err := c.getClientToken(httpx.WithProbe(ctx))
+	if err != nil {
+		return err
 	}
-	return 0
+	if token.AccessToken == "" {
+		return fmt.Errorf("client token is empty")
+	}
+	return nil
 }
 
-func (c *Client) IsAuthorized(roles []string, command string) bool {
-	privilegeLevel := c.GetPrivilegeLevel(roles)
-	
-	if privilegeLevel >= 15 {
-		return true
+// ProjectRole is a role defined on the Zitadel project
+type ProjectRole struct {
+	Key         string `json:"key"`
+	DisplayName string `json:"displayName"`
+	Group       string `json:"group"`
+}
+
+// ServiceToken returns the service account's client credentials token,
+// requesting a new one when the cached token is about to expire
+func (c *Client) ServiceToken(ctx context.Context) (*TokenResponse, error) {
+	return c.getClientToken(ctx)
+}
+
+// ProjectRoles lists the roles defined on the configured project
+func (c *Client) ProjectRoles(ctx context.Context) ([]ProjectRole, error) {
+	token, err := c.getClientToken(ctx)
+	if err != nil {
+		return nil, err
 	}
-	
-	if privilegeLevel >= 1 {
-		return true
+
+	rolesURL := fmt.Sprintf("%s/management/v1/projects/%s/roles/_search",
+		c.config.Providers.Zitadel.URL, url.PathEscape(c.config.Providers.Zitadel.ProjectID))
+	req, err := http.NewRequestWithContext(ctx, "POST", rolesURL, strings.NewReader(`{"query":{"limit":1000}}`))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	
-	if privilegeLevel >= 0 {
-		readOnlyCommands := []string{
-			"show", "ping", "traceroute", "telnet", "ssh",
-		}
-		
-		for _, cmd := range readOnlyCommands {
-			if strings.HasPrefix(strings.ToLower(command), cmd) {
-				return true
-			}
-		}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.doIdempotent(req, "project_roles")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project roles: %w", err)
 	}
-	
-	return false
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("project roles request failed with status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result []ProjectRole `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode project roles response: %w", err)
+	}
+	return result.Result, nil
 }
 
 func (c *Client) CleanupCache() {
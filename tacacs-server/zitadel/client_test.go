@@ -0,0 +1,127 @@
+package zitadel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"tacacs-zitadel-server/circuit"
+	"tacacs-zitadel-server/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newProbeTestClient returns a client of a stub Zitadel that answers with
+// status while it is not zero, and a breaker that opens after two failures
+func newProbeTestClient(t *testing.T, status *atomic.Int32) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != 0 {
+			w.WriteHeader(code)
+			return
+		}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": "http://" + r.Host})
+		case "/oauth/v2/token":
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "service-token", ExpiresIn: 3600})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := &config.Config{}
+	cfg.Providers.Zitadel = config.ZitadelConfig{
+		URL:            server.URL,
+		Timeouts:       config.ZitadelTimeouts{Token: 1000, UserInfo: 1000, Discovery: 1000, Management: 1000},
+		CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 2, OpenSeconds: 60},
+	}
+	client, err := NewClient(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestReadinessProbesBypassOpenCircuit(t *testing.T) {
+	var status atomic.Int32
+	client := newProbeTestClient(t, &status)
+	ctx := context.Background()
+
+	client.breaker.Failure()
+	client.breaker.Failure()
+	if err := client.CheckCircuit(ctx); !errors.Is(err, circuit.ErrOpen) {
+		t.Fatalf("CheckCircuit = %v, want the circuit open", err)
+	}
+
+	if err := client.CheckDiscovery(ctx); err != nil {
+		t.Errorf("CheckDiscovery with the circuit open = %v, want Zitadel's answer", err)
+	}
+	if err := client.CheckServiceToken(ctx); err != nil {
+		t.Errorf("CheckServiceToken with the circuit open = %v, want Zitadel's answer", err)
+	}
+	if state := client.CircuitState(); state != circuit.Open {
+		t.Errorf("circuit %s after the probes, want them to leave it open", state)
+	}
+	if _, err := client.ServiceToken(ctx); err != nil {
+		t.Errorf("ServiceToken = %v, want the token cached by the probe", err)
+	}
+}
+
+func TestFailingReadinessProbesDoNotOpenCircuit(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	client := newProbeTestClient(t, &status)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := client.CheckDiscovery(ctx); err == nil {
+			t.Fatal("CheckDiscovery passed against a failing Zitadel")
+		}
+		if err := client.CheckServiceToken(ctx); err == nil {
+			t.Fatal("CheckServiceToken passed against a failing Zitadel")
+		}
+	}
+	if state := client.CircuitState(); state != circuit.Closed {
+		t.Errorf("circuit %s after failed probes, want closed", state)
+	}
+
+	// Calls other than the probes still count
+	for i := 0; i < 2; i++ {
+		client.ProjectRoles(ctx)
+	}
+	if state := client.CircuitState(); state != circuit.Open {
+		t.Errorf("circuit %s after failed calls, want open", state)
+	}
+}
+
+func TestDoIdempotentDoesNotRetryOpenCircuit(t *testing.T) {
+	var status atomic.Int32
+	client := newProbeTestClient(t, &status)
+	client.config.Providers.Zitadel.Retries = 3
+	client.config.Providers.Zitadel.RetryBackoffMS = 1
+
+	var refused int
+	client.upstream.Refused = func(string) { refused++ }
+	client.breaker.Failure()
+	client.breaker.Failure()
+
+	req, err := http.NewRequest("GET", client.config.Providers.Zitadel.URL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.doIdempotent(req, "discovery"); !errors.Is(err, circuit.ErrOpen) {
+		t.Fatalf("doIdempotent = %v, want ErrOpen", err)
+	}
+	if refused != 1 {
+		t.Errorf("breaker refused %d attempts, want 1 without retries", refused)
+	}
+}
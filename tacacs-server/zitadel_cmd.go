@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"tacacs-zitadel-server/config"
+	"tacacs-zitadel-server/policy"
+	"tacacs-zitadel-server/zitadel"
+
+	"github.com/sirupsen/logrus"
+)
+
+const checkZitadelUsage = `Usage: tacacs-server check-zitadel [flags]
+
+Fetches the OpenID discovery document, performs the client credentials flow
+with the configured service account and lists the project roles together with
+the privilege level the policies grant each of them.
+`
+
+// runCheckZitadel implements the check-zitadel subcommand and returns the process exit code
+func runCheckZitadel(args []string) int {
+	fs := flag.NewFlagSet("check-zitadel", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, checkZitadelUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	timeout := fs.Duration("timeout", 30*time.Second, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-zitadel: %v\n", err)
+		return 1
+	}
+	engine, err := policy.New(cfg.Policies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-zitadel: %v\n", err)
+		return 1
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client, err := zitadel.NewClient(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-zitadel: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	zc := cfg.Providers.Zitadel
+	fmt.Printf("zitadel:    %s\n", zc.URL)
+	fmt.Printf("project:    %s\n", zc.ProjectID)
+	fmt.Printf("client id:  %s\n", zc.ClientID)
+
+	if err := client.CheckDiscovery(ctx); err != nil {
+		fmt.Printf("discovery:  FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Println("discovery:  ok")
+
+	token, err := client.ServiceToken(ctx)
+	if err != nil {
+		fmt.Printf("token:      FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Printf("token:      ok, %s, expires in %s\n", token.TokenType, time.Duration(token.ExpiresIn)*time.Second)
+
+	roles, err := client.ProjectRoles(ctx)
+	if err != nil {
+		fmt.Printf("roles:      FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Printf("roles:      %d\n\n", len(roles))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tDISPLAY NAME\tGROUP\tPRIVILEGE LEVEL")
+	for _, role := range roles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", role.Key, role.DisplayName, role.Group, engine.PrivilegeLevel([]string{role.Key}))
+	}
+	w.Flush()
+	return 0
+}